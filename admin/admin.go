@@ -0,0 +1,229 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/relayer"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxBodySize is the largest request body the admin server will read
+var MaxBodySize int64 = 1 << 20
+
+// ShutdownTimeout is how long the admin server waits for in flight requests when closing
+var ShutdownTimeout = 5 * time.Second
+
+// Server exposes endpoints to inspect and control a running message relayer
+type Server interface {
+	http.Handler
+	Start(context.Context)
+	DoneChannel() chan bool
+	SetLogger(logging.Logger)
+}
+
+// HTTPServer serves the admin endpoints, queues are addressed by message type wire name:
+//
+//	GET    /subscribers             subscriber registrations and their buffer fill
+//	GET    /queues/{type}?limit=n   queued messages, next to be broadcast first, without removing them
+//	POST   /queues/{type}/pause     stop broadcasting the type
+//	POST   /queues/{type}/resume    restart broadcasting the type
+//	DELETE /queues/{type}           purge the queue
+//	POST   /messages                enqueue a test message
+//	GET    /summary                 the relayer's WorkSummary
+//	GET    /stats                   the relayer's counters by message type and subscriber
+//
+// None of them are authenticated unless the server was created with NewAuthenticated, it must only listen on
+// loopback or a private management network.
+type HTTPServer struct {
+	addr    string
+	relayer relayer.Relayer
+	token   string // bearer token every request must carry, empty when unauthenticated
+	mux     *http.ServeMux
+	logger  logging.Logger
+	done    chan bool
+}
+
+// QueueState is the body returned when inspecting or controlling a queue
+type QueueState struct {
+	Type     constants.MessageType `json:"type"`
+	Size     int                   `json:"size"`
+	Paused   bool                  `json:"paused"`
+	Messages []constants.Message   `json:"messages,omitempty"`
+}
+
+// New returns an admin server controlling the provided relayer
+func New(addr string, msgRelayer relayer.Relayer) Server {
+	s := &HTTPServer{
+		addr:    addr,
+		relayer: msgRelayer,
+		mux:     http.NewServeMux(),
+		logger:  logging.Default(),
+		done:    make(chan bool),
+	}
+	s.mux.HandleFunc("GET /subscribers", s.handleSubscribers)
+	s.mux.HandleFunc("GET /queues/{type}", s.handlePeek)
+	s.mux.HandleFunc("POST /queues/{type}/pause", s.handlePause)
+	s.mux.HandleFunc("POST /queues/{type}/resume", s.handleResume)
+	s.mux.HandleFunc("DELETE /queues/{type}", s.handlePurge)
+	s.mux.HandleFunc("POST /messages", s.handleInject)
+	s.mux.HandleFunc("GET /summary", s.handleSummary)
+	s.mux.HandleFunc("GET /stats", s.handleStats)
+	return s
+}
+
+// NewAuthenticated returns an admin server that rejects requests without an "Authorization: Bearer <token>" header
+func NewAuthenticated(addr string, msgRelayer relayer.Relayer, token string) Server {
+	s := New(addr, msgRelayer).(*HTTPServer)
+	s.token = token
+	return s
+}
+
+// ServeHTTP checks the bearer token when one is configured and routes the request to the admin handlers
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, []byte("Bearer "+s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start listens on the configured address until the context is cancelled
+func (s *HTTPServer) Start(ctx context.Context) {
+	srv := &http.Server{Addr: s.addr, Handler: s}
+	go func() {
+		s.logger.Info("admin server listening", "addr", s.addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("admin server stopped", "addr", s.addr, logging.ErrorKey, err)
+		}
+	}()
+	<-ctx.Done()
+	s.logger.Info("closing admin server", "addr", s.addr)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	s.done <- true
+}
+
+// DoneChannel returns the admin servers done channel so the parent process can wait until it completes to exit
+func (s *HTTPServer) DoneChannel() chan bool {
+	return s.done
+}
+
+// SetLogger replaces the logger of the admin server, it must be called before Start
+func (s *HTTPServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+func (s *HTTPServer) handleSubscribers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.relayer.Subscribers())
+}
+
+func (s *HTTPServer) handlePeek(w http.ResponseWriter, r *http.Request) {
+	msgType, err := queueType(r, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", value))
+			return
+		}
+	}
+	state := s.state(msgType)
+	state.Messages = s.relayer.Peek(msgType, limit)
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (s *HTTPServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	msgType, err := queueType(r, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.relayer.Pause(msgType)
+	writeJSON(w, http.StatusOK, s.state(msgType))
+}
+
+func (s *HTTPServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	msgType, err := queueType(r, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.relayer.Resume(msgType)
+	writeJSON(w, http.StatusOK, s.state(msgType))
+}
+
+func (s *HTTPServer) handlePurge(w http.ResponseWriter, r *http.Request) {
+	msgType, err := queueType(r, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"purged": s.relayer.Purge(msgType)})
+}
+
+// handleInject enqueues a single message, unlike the ingest server it does not turn messages away from a
+// saturated queue so engineers can always get a test message through
+func (s *HTTPServer) handleInject(w http.ResponseWriter, r *http.Request) {
+	var msg constants.Message
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodySize)).Decode(&msg); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("malformed message: %w", err))
+		return
+	}
+	if msg.Type == 0 && constants.TypeOfTopic(msg.Topic) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("message is missing a type"))
+		return
+	}
+	s.relayer.Enqueue(msg)
+	writeJSON(w, http.StatusAccepted, map[string]int{"accepted": 1})
+}
+
+func (s *HTTPServer) handleSummary(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.relayer.Summary())
+}
+
+func (s *HTTPServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.relayer.Stats())
+}
+
+// state returns the size and pause state of the queue of msgType, for All the sizes of both queues are summed
+func (s *HTTPServer) state(msgType constants.MessageType) QueueState {
+	return QueueState{Type: msgType, Size: s.relayer.Queued(msgType), Paused: s.relayer.Paused(msgType)}
+}
+
+// queueType parses the message type in the request path, All addresses both queues and is only accepted when
+// allowAll is set
+func queueType(r *http.Request, allowAll bool) (constants.MessageType, error) {
+	msgType, err := constants.ParseMessageType(r.PathValue("type"))
+	if err != nil {
+		return 0, err
+	}
+	if msgType == constants.All && !allowAll {
+		return 0, errors.New("a single queue must be requested, not All")
+	}
+	return msgType, nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,104 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"messagerelayer/admin"
+	"messagerelayer/constants"
+	"messagerelayer/relayer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func request(handler http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestQueueControl(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := admin.New(":0", msgrelayer)
+
+	rec := request(server, http.MethodPost, "/messages", `{"type": "ReceivedAnswer", "data": "YQ=="}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code, "message injected")
+	request(server, http.MethodPost, "/messages", `{"type": "ReceivedAnswer", "data": "Yg=="}`)
+	assert.Equal(t, http.StatusBadRequest, request(server, http.MethodPost, "/messages", `{"data": "Yg=="}`).Code, "missing type rejected")
+
+	rec = request(server, http.MethodGet, "/queues/ReceivedAnswer?limit=1", "")
+	assert.Equal(t, http.StatusOK, rec.Code, "peek ok")
+	var state admin.QueueState
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &state), "peek body decodes")
+	assert.Equal(t, 2, state.Size, "queue size")
+	assert.Equal(t, 1, len(state.Messages), "peek limited")
+	assert.Equal(t, []byte("b"), state.Messages[0].Data, "most recent message is next")
+	assert.NotEmpty(t, state.Messages[0].ID, "enqueue assigns an id")
+	assert.Equal(t, 2, len(msgrelayer.Peek(constants.ReceivedAnswer, 0)), "peek does not pop")
+	assert.Equal(t, http.StatusBadRequest, request(server, http.MethodGet, "/queues/All", "").Code, "peek needs a single queue")
+	assert.Equal(t, http.StatusBadRequest, request(server, http.MethodGet, "/queues/Bogus", "").Code, "unknown type rejected")
+
+	rec = request(server, http.MethodPost, "/queues/All/pause", "")
+	assert.Equal(t, http.StatusOK, rec.Code, "pause ok")
+	assert.True(t, msgrelayer.Paused(constants.StartNewRound), "start round paused")
+	assert.True(t, msgrelayer.Paused(constants.ReceivedAnswer), "recieved answer paused")
+	request(server, http.MethodPost, "/queues/StartNewRound/resume", "")
+	assert.False(t, msgrelayer.Paused(constants.StartNewRound), "start round resumed")
+	assert.True(t, msgrelayer.Paused(constants.ReceivedAnswer), "recieved answer still paused")
+
+	rec = request(server, http.MethodDelete, "/queues/ReceivedAnswer", "")
+	assert.Equal(t, http.StatusOK, rec.Code, "purge ok")
+	assert.JSONEq(t, `{"purged": 2}`, rec.Body.String(), "purged count")
+
+	rec = request(server, http.MethodGet, "/summary", "")
+	var summary relayer.WorkSummary
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &summary), "summary body decodes")
+	assert.Equal(t, 2, summary.QueuedMsgs, "queued count")
+	assert.Equal(t, 2, summary.DiscardedMsgs, "purged messages are discarded")
+
+	rec = request(server, http.MethodGet, "/stats", "")
+	var stats relayer.StatsSnapshot
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &stats), "stats body decodes")
+	assert.Equal(t, relayer.TypeStats{Queued: 2, Discarded: 2}, stats.Types[constants.ReceivedAnswer], "recieved answer counters")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, request(server, http.MethodGet, "/messages", "").Code, "inject needs POST")
+}
+
+func TestListSubscribers(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := admin.New(":0", msgrelayer)
+	busy := make(chan constants.Message, 4)
+	busy <- constants.Message{}
+	msgrelayer.SubscribeToMessages(constants.StartNewRound, busy, relayer.Named("busy"))
+	msgrelayer.SubscribeToMessages(constants.All, make(chan constants.Message, 1), relayer.Named("workers"), relayer.InGroup("pool", relayer.RoundRobin))
+	assert.Nil(t, msgrelayer.SubscribeToTopic("round.answer.*", make(chan constants.Message, 2), relayer.Named("topical")), "subscribe err is nil")
+
+	rec := request(server, http.MethodGet, "/subscribers", "")
+	assert.Equal(t, http.StatusOK, rec.Code, "list ok")
+	var infos []relayer.SubscriberInfo
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &infos), "list body decodes")
+	assert.Equal(t, []relayer.SubscriberInfo{
+		{Name: "busy", Type: constants.StartNewRound, Buffered: 1, Capacity: 4, Fill: 0.25},
+		{Name: "topical", Topic: "round.answer.*", Capacity: 2},
+		{Name: "workers", Type: constants.StartNewRound, Group: "pool", Capacity: 1},
+		{Name: "workers", Type: constants.ReceivedAnswer, Group: "pool", Capacity: 1},
+	}, infos, "subscriber registrations")
+}
+
+func TestAuthenticated(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := admin.NewAuthenticated(":0", msgrelayer, "secret")
+	assert.Equal(t, http.StatusUnauthorized, request(server, http.MethodDelete, "/queues/All", "").Code, "missing token rejected")
+	req := httptest.NewRequest(http.MethodDelete, "/queues/All", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "wrong token rejected")
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, "valid token accepted")
+}
@@ -0,0 +1,107 @@
+package codec
+
+import (
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/middleware"
+	"sort"
+	"sync"
+)
+
+// ContentTypeHeader is the message header declaring the encoding of a message's data
+const ContentTypeHeader = "content-type"
+
+// Codec converts between encoded payloads and a generic value made of nil, bool, int64, uint64, float64, string,
+// []byte, []interface{} and map[string]interface{}
+type Codec interface {
+	ContentType() string
+	Marshal(interface{}) ([]byte, error)
+	Unmarshal([]byte) (interface{}, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	Register(JSON)
+	Register(MessagePack)
+}
+
+// Register makes a codec available for its content type, replacing any codec registered for it before
+func Register(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.ContentType()] = c
+}
+
+// Lookup returns the codec registered for contentType
+func Lookup(contentType string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[contentType]
+	if !ok {
+		return nil, fmt.Errorf("no codec registered for %q", contentType)
+	}
+	return c, nil
+}
+
+// ContentTypes returns the registered content types in order
+func ContentTypes() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	types := make([]string, 0, len(codecs))
+	for contentType := range codecs {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Transcode re-encodes data from one content type to another
+func Transcode(data []byte, from string, to string) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+	source, err := Lookup(from)
+	if err != nil {
+		return nil, err
+	}
+	target, err := Lookup(to)
+	if err != nil {
+		return nil, err
+	}
+	value, err := source.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %v: %w", from, err)
+	}
+	encoded, err := target.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %v: %w", to, err)
+	}
+	return encoded, nil
+}
+
+// Transcoder returns an interceptor re-encoding message data to contentType, messages without a
+// ContentTypeHeader are assumed to be JSON
+func Transcoder(contentType string) middleware.Interceptor {
+	return middleware.Func("transcode to "+contentType, func(msg constants.Message) ([]constants.Message, error) {
+		from := msg.Headers[ContentTypeHeader]
+		if from == "" {
+			from = JSON.ContentType()
+		}
+		data, err := Transcode(msg.Data, from, contentType)
+		if err != nil {
+			return nil, err
+		}
+		headers := make(map[string]string, len(msg.Headers)+1)
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		headers[ContentTypeHeader] = contentType
+		msg.Data = data
+		msg.Headers = headers
+		return []constants.Message{msg}, nil
+	})
+}
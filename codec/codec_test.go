@@ -0,0 +1,51 @@
+package codec_test
+
+import (
+	"bytes"
+	"messagerelayer/codec"
+	"messagerelayer/constants"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscodeRoundTrip(t *testing.T) {
+	original := `{"answer":1850.5,"feed":"eth-usd","nodes":[{"id":7,"ok":true},null],"round":-3,"big":18446744073709551615}`
+	packed, err := codec.Transcode([]byte(original), "application/json", "application/msgpack")
+	assert.Nil(t, err, "transcode err is nil")
+	assert.Less(t, len(packed), len(original), "msgpack is more compact")
+	unpacked, err := codec.Transcode(packed, "application/msgpack", "application/json")
+	assert.Nil(t, err, "transcode err is nil")
+	assert.JSONEq(t, original, string(unpacked))
+}
+
+func TestMessagePackEncoding(t *testing.T) {
+	encoded, err := codec.MessagePack.Marshal(map[string]interface{}{"a": int64(1), "b": []interface{}{"x", false}})
+	assert.Nil(t, err, "marshal err is nil")
+	assert.Equal(t, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x92, 0xa1, 'x', 0xc2}, encoded)
+	_, err = codec.MessagePack.Unmarshal(encoded[:len(encoded)-1])
+	assert.NotNil(t, err, "truncated data fails")
+	_, err = codec.MessagePack.Unmarshal([]byte{0x81, 0x01, 0x01})
+	assert.NotNil(t, err, "non string keys fail")
+}
+
+func TestMessagePackMaxDepth(t *testing.T) {
+	// one element arrays nested a million deep
+	nested := append(bytes.Repeat([]byte{0x91}, 1<<20), 0x01)
+	_, err := codec.MessagePack.Unmarshal(nested)
+	assert.EqualError(t, err, "msgpack: exceeded max depth of 10000")
+	_, err = codec.MessagePack.Unmarshal(append(bytes.Repeat([]byte{0x91}, 100), 0x01))
+	assert.Nil(t, err, "moderate nesting decodes")
+}
+
+func TestTranscoder(t *testing.T) {
+	msg := constants.Message{Data: []byte(`{"a":1}`), Headers: map[string]string{"key": "k"}}
+	msgs, err := codec.Transcoder("application/msgpack").Intercept(msg)
+	assert.Nil(t, err, "intercept err is nil")
+	assert.Equal(t, []byte{0x81, 0xa1, 'a', 0x01}, msgs[0].Data)
+	assert.Equal(t, "application/msgpack", msgs[0].Headers[codec.ContentTypeHeader])
+	assert.Equal(t, "", msg.Headers[codec.ContentTypeHeader], "original headers are untouched")
+	_, err = codec.Transcoder("application/unknown").Intercept(msg)
+	assert.NotNil(t, err, "unknown content type fails")
+	assert.Equal(t, []string{"application/json", "application/msgpack"}, codec.ContentTypes())
+}
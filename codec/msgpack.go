@@ -0,0 +1,255 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// MessagePack encodes values in the compact MessagePack binary format, map keys are written in sorted order so
+// equal values always encode to equal bytes
+var MessagePack Codec = msgpackCodec{}
+
+var errTruncated = errors.New("msgpack: truncated data")
+
+// maxDepth bounds how deeply arrays and maps may nest in decoded data, the same limit encoding/json applies, so
+// untrusted input can't exhaust the stack
+const maxDepth = 10000
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return appendMsgpack(nil, v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte) (interface{}, error) {
+	d := &msgpackDecoder{data: data}
+	v := d.value()
+	if d.err == nil && len(d.data) > 0 {
+		d.err = fmt.Errorf("msgpack: %d unexpected bytes after value", len(d.data))
+	}
+	return v, d.err
+}
+
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if value {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return appendInt(b, int64(value)), nil
+	case int64:
+		return appendInt(b, value), nil
+	case uint64:
+		if value <= math.MaxInt64 {
+			return appendInt(b, int64(value)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), value), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(value)), nil
+	case string:
+		b = appendLength(b, len(value), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		return append(b, value...), nil
+	case []byte:
+		b = appendLength(b, len(value), 0, 0, 0xc4, 0xc5, 0xc6)
+		return append(b, value...), nil
+	case []interface{}:
+		b = appendLength(b, len(value), 0x90, 15, 0, 0xdc, 0xdd)
+		var err error
+		for _, element := range value {
+			if b, err = appendMsgpack(b, element); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		b = appendLength(b, len(value), 0x80, 15, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			b, _ = appendMsgpack(b, k)
+			if b, err = appendMsgpack(b, value[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("msgpack: cannot encode %v", reflect.TypeOf(v))
+}
+
+func appendInt(b []byte, i int64) []byte {
+	if i >= 0 && i <= 0x7f {
+		return append(b, byte(i))
+	}
+	if i < 0 && i >= -32 {
+		return append(b, byte(i))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+}
+
+// appendLength writes the header of a string, binary, array or map of size n. fixed is the prefix of the compact
+// form holding sizes up to fixedMax, a zero code means the format has no such width.
+func appendLength(b []byte, n int, fixed byte, fixedMax int, code8 byte, code16 byte, code32 byte) []byte {
+	switch {
+	case fixed != 0 && n <= fixedMax:
+		return append(b, fixed|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+}
+
+// msgpackDecoder consumes values from data, the first error sticks and later reads return zero values
+type msgpackDecoder struct {
+	data  []byte
+	depth int // arrays and maps currently being decoded
+	err   error
+}
+
+// enter descends into an array or map, failing once maxDepth is exceeded
+func (d *msgpackDecoder) enter() bool {
+	d.depth++
+	if d.depth > maxDepth {
+		if d.err == nil {
+			d.err = fmt.Errorf("msgpack: exceeded max depth of %d", maxDepth)
+		}
+		return false
+	}
+	return true
+}
+
+func (d *msgpackDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.data) < n {
+		d.err = errTruncated
+		return nil
+	}
+	v := d.data[:n]
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *msgpackDecoder) uint(size int) uint64 {
+	b := d.take(size)
+	if b == nil {
+		return 0
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (d *msgpackDecoder) value() interface{} {
+	code := d.take(1)
+	if code == nil {
+		return nil
+	}
+	c := code[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c)
+	case c >= 0xe0:
+		return int64(int8(c))
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return string(d.take(int(c & 0x1f)))
+	}
+	switch c {
+	case 0xc0:
+		return nil
+	case 0xc2:
+		return false
+	case 0xc3:
+		return true
+	case 0xc4, 0xc5, 0xc6:
+		return append([]byte(nil), d.take(int(d.uint(1<<(c-0xc4))))...)
+	case 0xca:
+		return float64(math.Float32frombits(uint32(d.uint(4))))
+	case 0xcb:
+		return math.Float64frombits(d.uint(8))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v := d.uint(1 << (c - 0xcc))
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return v
+	case 0xd0:
+		return int64(int8(d.uint(1)))
+	case 0xd1:
+		return int64(int16(d.uint(2)))
+	case 0xd2:
+		return int64(int32(d.uint(4)))
+	case 0xd3:
+		return int64(d.uint(8))
+	case 0xd9, 0xda, 0xdb:
+		return string(d.take(int(d.uint(1 << (c - 0xd9)))))
+	case 0xdc, 0xdd:
+		return d.arrayOf(int(d.uint(2 << (c - 0xdc))))
+	case 0xde, 0xdf:
+		return d.mapOf(int(d.uint(2 << (c - 0xde))))
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("msgpack: unsupported type code %#x", c)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) arrayOf(n int) interface{} {
+	if n > len(d.data) { // every element takes at least a byte
+		d.err = errTruncated
+		return nil
+	}
+	if !d.enter() {
+		return nil
+	}
+	defer func() { d.depth-- }()
+	arr := make([]interface{}, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		arr = append(arr, d.value())
+	}
+	return arr
+}
+
+func (d *msgpackDecoder) mapOf(n int) interface{} {
+	if n > len(d.data)/2 { // every entry takes at least two bytes
+		d.err = errTruncated
+		return nil
+	}
+	if !d.enter() {
+		return nil
+	}
+	defer func() { d.depth-- }()
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		key, ok := d.value().(string)
+		if !ok && d.err == nil {
+			d.err = errors.New("msgpack: map keys must be strings")
+		}
+		m[key] = d.value()
+	}
+	return m
+}
@@ -0,0 +1,264 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/metrics"
+	"messagerelayer/middleware"
+	"sync/atomic"
+	"time"
+)
+
+// EncodingHeader is the message header naming the algorithm a message's data is compressed with
+const EncodingHeader = "content-encoding"
+
+// DefaultThreshold is the data size in bytes from which messages are compressed when New is given no threshold
+var DefaultThreshold = 1024
+
+// MaxDecompressedSize caps the size of decompressed data so a small malicious payload cannot exhaust memory
+var MaxDecompressedSize = 16 << 20
+
+// Algorithm is a compression algorithm
+type Algorithm int
+
+const (
+	// Gzip compresses with gzip, which carries a checksum of the data
+	Gzip Algorithm = iota
+	// Deflate compresses with raw deflate, the smallest and fastest of the stdlib formats
+	Deflate
+	// Snappy compresses with the snappy block format, much faster than deflate at a lower ratio
+	Snappy
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case Deflate:
+		return "deflate"
+	case Snappy:
+		return "snappy"
+	}
+	return "gzip"
+}
+
+// ParseAlgorithm returns the algorithm for the provided name
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch name {
+	case "gzip":
+		return Gzip, nil
+	case "deflate":
+		return Deflate, nil
+	case "snappy":
+		return Snappy, nil
+	}
+	return 0, fmt.Errorf("unknown compression algorithm %q", name)
+}
+
+// Stats reports the work a compressor has done
+type Stats struct {
+	Compressed     int64         // messages compressed
+	Decompressed   int64         // messages decompressed
+	Passed         int64         // messages below the threshold left uncompressed
+	BytesIn        int64         // data size of the compressed messages before compression
+	BytesOut       int64         // data size of the compressed messages after compression
+	CompressTime   time.Duration // time spent compressing
+	DecompressTime time.Duration // time spent decompressing
+}
+
+// Ratio returns the compressed size as a fraction of the original size, lower is better
+func (s Stats) Ratio() float64 {
+	if s.BytesIn == 0 {
+		return 1
+	}
+	return float64(s.BytesOut) / float64(s.BytesIn)
+}
+
+// Compressor compresses message data above a size threshold and decompresses compressed messages
+type Compressor struct {
+	algorithm      Algorithm
+	threshold      int
+	compressed     atomic.Int64
+	decompressed   atomic.Int64
+	passed         atomic.Int64
+	bytesIn        atomic.Int64
+	bytesOut       atomic.Int64
+	compressTime   atomic.Int64
+	decompressTime atomic.Int64
+}
+
+// New returns a compressor using algorithm for messages whose data is at least threshold bytes, a threshold
+// of 0 uses DefaultThreshold
+func New(algorithm Algorithm, threshold int) *Compressor {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &Compressor{
+		algorithm: algorithm,
+		threshold: threshold,
+	}
+}
+
+// Compress returns msg with its data compressed and EncodingHeader set, messages below the threshold or
+// already carrying an encoding are returned untouched
+func (c *Compressor) Compress(msg constants.Message) (constants.Message, error) {
+	if len(msg.Data) < c.threshold || msg.Headers[EncodingHeader] != "" {
+		c.passed.Add(1)
+		return msg, nil
+	}
+	start := time.Now()
+	data, err := compress(c.algorithm, msg.Data)
+	if err != nil {
+		return msg, err
+	}
+	c.compressTime.Add(int64(time.Since(start)))
+	c.compressed.Add(1)
+	c.bytesIn.Add(int64(len(msg.Data)))
+	c.bytesOut.Add(int64(len(data)))
+	msg.Data = data
+	msg.Headers = withHeader(msg.Headers, EncodingHeader, c.algorithm.String())
+	return msg, nil
+}
+
+// Decompress returns msg with its data decompressed according to its EncodingHeader, messages without one
+// are returned untouched
+func (c *Compressor) Decompress(msg constants.Message) (constants.Message, error) {
+	encoding := msg.Headers[EncodingHeader]
+	if encoding == "" {
+		return msg, nil
+	}
+	algorithm, err := ParseAlgorithm(encoding)
+	if err != nil {
+		return msg, err
+	}
+	start := time.Now()
+	data, err := decompress(algorithm, msg.Data)
+	if err != nil {
+		return msg, err
+	}
+	c.decompressTime.Add(int64(time.Since(start)))
+	c.decompressed.Add(1)
+	msg.Data = data
+	msg.Headers = withHeader(msg.Headers, EncodingHeader, "")
+	return msg, nil
+}
+
+// Stats returns the work the compressor has done so far
+func (c *Compressor) Stats() Stats {
+	return Stats{
+		Compressed:     c.compressed.Load(),
+		Decompressed:   c.decompressed.Load(),
+		Passed:         c.passed.Load(),
+		BytesIn:        c.bytesIn.Load(),
+		BytesOut:       c.bytesOut.Load(),
+		CompressTime:   time.Duration(c.compressTime.Load()),
+		DecompressTime: time.Duration(c.decompressTime.Load()),
+	}
+}
+
+// Collect returns the compressor's stats as metric families labelled with its algorithm so it can be registered
+// with a metrics.Registry, sinks sharing an algorithm should share a compressor to keep the labels unique
+func (c *Compressor) Collect() []metrics.Family {
+	stats := c.Stats()
+	labels := []metrics.Label{{Name: "algorithm", Value: c.algorithm.String()}}
+	family := func(name string, help string, value float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.Counter, Samples: []metrics.Sample{{Labels: labels, Value: value}}}
+	}
+	return []metrics.Family{
+		family("compress_compressed_messages_total", "Messages whose data was compressed.", float64(stats.Compressed)),
+		family("compress_decompressed_messages_total", "Messages whose data was decompressed.", float64(stats.Decompressed)),
+		family("compress_passed_messages_total", "Messages left uncompressed below the threshold.", float64(stats.Passed)),
+		family("compress_bytes_in_total", "Data size of the compressed messages before compression.", float64(stats.BytesIn)),
+		family("compress_bytes_out_total", "Data size of the compressed messages after compression.", float64(stats.BytesOut)),
+		family("compress_compress_seconds_total", "Time spent compressing.", stats.CompressTime.Seconds()),
+		family("compress_decompress_seconds_total", "Time spent decompressing.", stats.DecompressTime.Seconds()),
+	}
+}
+
+// Compressing returns an interceptor compressing messages with c
+func (c *Compressor) Compressing() middleware.Interceptor {
+	return middleware.Func("compress "+c.algorithm.String(), func(msg constants.Message) ([]constants.Message, error) {
+		msg, err := c.Compress(msg)
+		if err != nil {
+			return nil, err
+		}
+		return []constants.Message{msg}, nil
+	})
+}
+
+// Decompressing returns an interceptor decompressing messages with c, the relayer already decompresses messages
+// before its delivery stage
+func (c *Compressor) Decompressing() middleware.Interceptor {
+	return middleware.Func("decompress", func(msg constants.Message) ([]constants.Message, error) {
+		msg, err := c.Decompress(msg)
+		if err != nil {
+			return nil, err
+		}
+		return []constants.Message{msg}, nil
+	})
+}
+
+func compress(algorithm Algorithm, data []byte) ([]byte, error) {
+	if algorithm == Snappy {
+		return snappyEncode(data), nil
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if algorithm == Deflate {
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(algorithm Algorithm, data []byte) ([]byte, error) {
+	if algorithm == Snappy {
+		return snappyDecode(data, MaxDecompressedSize)
+	}
+	var r io.ReadCloser
+	if algorithm == Deflate {
+		r = flate.NewReader(bytes.NewReader(data))
+	} else {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(MaxDecompressedSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > MaxDecompressedSize {
+		return nil, fmt.Errorf("decompressed data exceeds %d bytes", MaxDecompressedSize)
+	}
+	return out, nil
+}
+
+// withHeader returns a copy of headers with name set to value, or removed when value is empty, leaving the
+// original map which other subscribers may share untouched
+func withHeader(headers map[string]string, name string, value string) map[string]string {
+	copied := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		copied[k] = v
+	}
+	if value == "" {
+		delete(copied, name)
+	} else {
+		copied[name] = value
+	}
+	if len(copied) == 0 {
+		return nil
+	}
+	return copied
+}
@@ -0,0 +1,103 @@
+package compress_test
+
+import (
+	"bytes"
+	"math/rand"
+	"messagerelayer/compress"
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/metrics"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	for _, algorithm := range []compress.Algorithm{compress.Gzip, compress.Deflate, compress.Snappy} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			c := compress.New(algorithm, 100)
+			headers := map[string]string{"key": "k"}
+			original := constants.Message{Data: bytes.Repeat([]byte("answer "), 100), Headers: headers}
+			compressed, err := c.Compress(original)
+			assert.Nil(t, err, "compress err is nil")
+			assert.Equal(t, algorithm.String(), compressed.Headers[compress.EncodingHeader])
+			assert.Less(t, len(compressed.Data), len(original.Data), "data shrinks")
+			assert.Equal(t, map[string]string{"key": "k"}, headers, "original headers are untouched")
+			decompressed, err := c.Decompress(compressed)
+			assert.Nil(t, err, "decompress err is nil")
+			assert.Equal(t, original, decompressed)
+			stats := c.Stats()
+			assert.Equal(t, int64(1), stats.Compressed)
+			assert.Equal(t, int64(1), stats.Decompressed)
+			assert.Equal(t, int64(700), stats.BytesIn)
+			assert.Less(t, stats.Ratio(), 0.5, "repetitive data compresses well")
+		})
+	}
+}
+
+func TestCompressBelowThreshold(t *testing.T) {
+	c := compress.New(compress.Gzip, 100)
+	msg := constants.Message{Data: []byte("small")}
+	compressed, err := c.Compress(msg)
+	assert.Nil(t, err, "compress err is nil")
+	assert.Equal(t, msg, compressed, "small messages pass through")
+	assert.Equal(t, int64(1), c.Stats().Passed)
+	_, err = c.Decompress(constants.Message{Data: []byte("garbage"), Headers: map[string]string{compress.EncodingHeader: "gzip"}})
+	assert.NotNil(t, err, "corrupt data fails")
+	_, err = c.Decompress(constants.Message{Data: []byte("x"), Headers: map[string]string{compress.EncodingHeader: "zstd"}})
+	assert.NotNil(t, err, "unknown encoding fails")
+}
+
+func TestSnappyRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("abc"),
+		"repetitive": bytes.Repeat([]byte("a"), 1000),
+		"random":     random,
+		// repeats of a random block more than 64KiB apart need 4 byte offsets
+		"far repeats": append(append(append([]byte{}, random[:5000]...), random...), random[:5000]...),
+	}
+	c := compress.New(compress.Snappy, 1)
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			compressed, err := c.Compress(constants.Message{Data: data, Headers: map[string]string{}})
+			assert.Nil(t, err, "compress err is nil")
+			decompressed, err := c.Decompress(compressed)
+			assert.Nil(t, err, "decompress err is nil")
+			assert.Equal(t, len(data), len(decompressed.Data))
+			assert.True(t, bytes.Equal(data, decompressed.Data), "data survives the round trip")
+		})
+	}
+	_, err := c.Decompress(constants.Message{Data: []byte{0x05, 0x01, 0x00}, Headers: map[string]string{compress.EncodingHeader: "snappy"}})
+	assert.NotNil(t, err, "copy before any literal fails")
+	_, err = c.Decompress(constants.Message{Data: []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, Headers: map[string]string{compress.EncodingHeader: "snappy"}})
+	assert.NotNil(t, err, "declared size above MaxDecompressedSize fails")
+}
+
+func TestCompressorMetrics(t *testing.T) {
+	c := compress.New(compress.Snappy, 10)
+	c.Compress(constants.Message{Data: bytes.Repeat([]byte("a"), 100)})
+	c.Compress(constants.Message{Data: []byte("a")})
+	registry := metrics.NewRegistry()
+	registry.Register(c)
+	var out strings.Builder
+	registry.WriteText(&out)
+	assert.Contains(t, out.String(), `compress_compressed_messages_total{algorithm="snappy"} 1`)
+	assert.Contains(t, out.String(), `compress_passed_messages_total{algorithm="snappy"} 1`)
+	assert.Contains(t, out.String(), `compress_bytes_in_total{algorithm="snappy"} 100`)
+}
+
+func TestFramingRejectsUnknownEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	writer := framing.NewWriter(&buf, framing.LengthPrefixed)
+	err := writer.Write(constants.Message{Type: constants.StartNewRound, Data: []byte("x"), Headers: map[string]string{compress.EncodingHeader: "br"}})
+	assert.NotNil(t, err, "unknown encoding fails")
+	assert.Equal(t, 0, buf.Len(), "nothing is written")
+	assert.Nil(t, writer.Write(constants.Message{Type: constants.StartNewRound, Data: []byte("x"), Headers: map[string]string{compress.EncodingHeader: "snappy"}}))
+	msg := framing.DecodeLengthPrefixed(buf.Bytes()[4:])
+	assert.Equal(t, constants.StartNewRound, msg.Type, "type survives the snappy flag")
+	assert.Equal(t, "snappy", msg.Headers[compress.EncodingHeader])
+}
@@ -0,0 +1,161 @@
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errCorrupt is returned when snappy data cannot be decoded
+var errCorrupt = errors.New("snappy: corrupt input")
+
+// snappy element tags, the low two bits of the first byte of every element
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+)
+
+const (
+	snappyMinMatch  = 4
+	snappyTableBits = 14
+)
+
+// snappyEncode compresses src into the snappy block format: the uvarint length of src followed by literal and copy
+// elements. Matches are found greedily through a hash table of 4 byte sequences, favouring speed over ratio.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+	table := make([]int, 1<<snappyTableBits) // hash -> position + 1 of the last sequence seen, 0 when none
+	literal := 0
+	for i := 0; i+snappyMinMatch <= len(src); {
+		sequence := binary.LittleEndian.Uint32(src[i:])
+		h := (sequence * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := table[h] - 1
+		table[h] = i + 1
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != sequence {
+			i++
+			continue
+		}
+		length := snappyMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = appendLiteral(dst, src[literal:i])
+		dst = appendCopy(dst, i-candidate, length)
+		i += length
+		literal = i
+	}
+	return appendLiteral(dst, src[literal:])
+}
+
+func appendLiteral(dst []byte, literal []byte) []byte {
+	if len(literal) == 0 {
+		return dst
+	}
+	n := uint32(len(literal) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, literal...)
+}
+
+// appendCopy appends copy elements repeating length bytes from offset bytes back, split in elements of at most 64
+func appendCopy(dst []byte, offset int, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > 64 {
+			n = 64
+		}
+		switch {
+		case n >= 4 && n <= 11 && offset < 2048:
+			dst = append(dst, byte(offset>>8)<<5|byte(n-4)<<2|tagCopy1, byte(offset))
+		case offset < 1<<16:
+			dst = append(dst, byte(n-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+		default:
+			dst = append(dst, byte(n-1)<<2|tagCopy4, byte(offset), byte(offset>>8), byte(offset>>16), byte(offset>>24))
+		}
+		length -= n
+	}
+	return dst
+}
+
+// snappyDecode decompresses a snappy block, refusing blocks that decode to more than max bytes
+func snappyDecode(src []byte, max int) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errCorrupt
+	}
+	if size > uint64(max) {
+		return nil, fmt.Errorf("decompressed data exceeds %d bytes", max)
+	}
+	dst := make([]byte, 0, size)
+	for s := n; s < len(src); {
+		tag := src[s]
+		var offset, length int
+		switch tag & 0x03 {
+		case tagLiteral:
+			length = int(tag >> 2)
+			s++
+			if length >= 60 {
+				extra := length - 59
+				if s+extra > len(src) {
+					return nil, errCorrupt
+				}
+				length = 0
+				for j := 0; j < extra; j++ {
+					length |= int(src[s+j]) << (8 * j)
+				}
+				s += extra
+			}
+			length++
+			if length > len(src)-s || uint64(len(dst)+length) > size {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[s:s+length]...)
+			s += length
+			continue
+		case tagCopy1:
+			if s+2 > len(src) {
+				return nil, errCorrupt
+			}
+			length = 4 + int(tag>>2&0x07)
+			offset = int(tag>>5)<<8 | int(src[s+1])
+			s += 2
+		case tagCopy2:
+			if s+3 > len(src) {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+		case tagCopy4:
+			if s+5 > len(src) {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > size {
+			return nil, errCorrupt
+		}
+		// copies may overlap the bytes they produce, so they are made a byte at a time
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
@@ -1,5 +1,11 @@
 package constants
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 type MessageType int
 
 const (
@@ -18,7 +24,85 @@ func (mt MessageType) String() string {
 	return "all"
 }
 
+// messageTypeNames maps the wire name of each message type to its value
+var messageTypeNames = map[string]MessageType{
+	"StartNewRound":  StartNewRound,
+	"ReceivedAnswer": ReceivedAnswer,
+	"All":            All,
+}
+
+// ParseMessageType returns the message type for the provided wire name
+func ParseMessageType(name string) (MessageType, error) {
+	mt, ok := messageTypeNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown message type %q", name)
+	}
+	return mt, nil
+}
+
+// MarshalText encodes the message type as its wire name
+func (mt MessageType) MarshalText() ([]byte, error) {
+	for name, t := range messageTypeNames {
+		if t == mt {
+			return []byte(name), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown message type %d", int(mt))
+}
+
+// UnmarshalText decodes a message type from its wire name
+func (mt *MessageType) UnmarshalText(text []byte) error {
+	parsed, err := ParseMessageType(string(text))
+	if err != nil {
+		return err
+	}
+	*mt = parsed
+	return nil
+}
+
+// KeyHeader is the header holding a message's partitioning key, used to route related messages to the same
+// member of a subscriber group
+const KeyHeader = "key"
+
+// root topics the message types map onto, a message published to a topic under one of them is queued as that type
+const (
+	StartNewRoundTopic  = "round.start"
+	ReceivedAnswerTopic = "round.answer"
+)
+
+// Topic returns the root topic of the message type, All has none
+func (mt MessageType) Topic() string {
+	if mt == StartNewRound {
+		return StartNewRoundTopic
+	}
+	if mt == ReceivedAnswer {
+		return ReceivedAnswerTopic
+	}
+	return ""
+}
+
+// TypeOfTopic returns the message type whose root topic is or contains topic, or 0 when it is under neither
+func TypeOfTopic(topic string) MessageType {
+	for _, mt := range []MessageType{StartNewRound, ReceivedAnswer} {
+		root := mt.Topic()
+		if topic == root || strings.HasPrefix(topic, root+".") {
+			return mt
+		}
+	}
+	return 0
+}
+
 type Message struct {
-	Type MessageType
-	Data []byte
+	// ID identifies the message in logs, the relayer assigns one when a message is enqueued without it
+	ID      string            `json:"id,omitempty"`
+	Type    MessageType       `json:"type"`
+	Topic   string            `json:"topic,omitempty"`
+	Data    []byte            `json:"data"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// EnqueuedAt is when the relayer accepted the message
+	EnqueuedAt time.Time `json:"enqueued_at,omitzero"`
+	// DeliveredAt is when the relayer handed the message to the subscriber holding it, it stays in process
+	DeliveredAt time.Time `json:"-"`
+	// DequeuedAt is when the subscriber holding the message took it off its channel, it stays in process
+	DequeuedAt time.Time `json:"-"`
 }
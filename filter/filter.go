@@ -0,0 +1,223 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"messagerelayer/constants"
+	"strconv"
+	"strings"
+)
+
+// RoundIDHeader is the header holding the numeric round a message belongs to
+const RoundIDHeader = "round_id"
+
+// Filter decides whether a subscriber wants to receive a message
+type Filter interface {
+	Match(constants.Message) bool
+	String() string
+}
+
+// HeaderEquals matches messages whose header name has exactly the value provided
+func HeaderEquals(name string, value string) Filter {
+	return headerEquals{name: name, value: value}
+}
+
+type headerEquals struct {
+	name  string
+	value string
+}
+
+func (f headerEquals) Match(msg constants.Message) bool {
+	v, ok := msg.Headers[f.name]
+	return ok && v == f.value
+}
+
+func (f headerEquals) String() string {
+	return "header." + f.name + " == " + strconv.Quote(f.value)
+}
+
+// DataPrefix matches messages whose data starts with prefix
+func DataPrefix(prefix []byte) Filter {
+	return dataPrefix{prefix: prefix}
+}
+
+type dataPrefix struct {
+	prefix []byte
+}
+
+func (f dataPrefix) Match(msg constants.Message) bool {
+	return bytes.HasPrefix(msg.Data, f.prefix)
+}
+
+func (f dataPrefix) String() string {
+	return "data startswith " + strconv.Quote(string(f.prefix))
+}
+
+// RoundRange matches messages whose RoundIDHeader is a number between min and max inclusive
+func RoundRange(min uint64, max uint64) Filter {
+	return roundRange{min: min, max: max}
+}
+
+type roundRange struct {
+	min uint64
+	max uint64
+}
+
+func (f roundRange) Match(msg constants.Message) bool {
+	round, err := strconv.ParseUint(msg.Headers[RoundIDHeader], 10, 64)
+	return err == nil && round >= f.min && round <= f.max
+}
+
+func (f roundRange) String() string {
+	return "round in " + strconv.FormatUint(f.min, 10) + ".." + strconv.FormatUint(f.max, 10)
+}
+
+// JSONPath matches messages whose data is a JSON document with the value at path comparing to value with op.
+// Paths look like $.price or $.feeds[0].name, op is one of == != < <= > >= and value is a string, float64, bool or nil.
+func JSONPath(path string, op string, value interface{}) (Filter, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if !validOps[op] {
+		return nil, syntaxError("unknown operator " + op)
+	}
+	return jsonPath{path: path, steps: steps, op: op, value: value}, nil
+}
+
+var validOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+type jsonPath struct {
+	path  string
+	steps []interface{} // string keys and int indexes
+	op    string
+	value interface{}
+}
+
+func (f jsonPath) Match(msg constants.Message) bool {
+	var doc interface{}
+	if err := json.Unmarshal(msg.Data, &doc); err != nil {
+		return false
+	}
+	for _, step := range f.steps {
+		switch s := step.(type) {
+		case string:
+			obj, ok := doc.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if doc, ok = obj[s]; !ok {
+				return false
+			}
+		case int:
+			arr, ok := doc.([]interface{})
+			if !ok || s >= len(arr) {
+				return false
+			}
+			doc = arr[s]
+		}
+	}
+	return compare(doc, f.op, f.value)
+}
+
+func (f jsonPath) String() string {
+	encoded, _ := json.Marshal(f.value)
+	return f.path + " " + f.op + " " + string(encoded)
+}
+
+// compare applies op to two decoded JSON values, ordering operators only apply to numbers and strings
+func compare(actual interface{}, op string, expected interface{}) bool {
+	switch op {
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	}
+	if a, ok := actual.(float64); ok {
+		if e, ok := expected.(float64); ok {
+			return ordered(op, a < e, a == e)
+		}
+	}
+	if a, ok := actual.(string); ok {
+		if e, ok := expected.(string); ok {
+			return ordered(op, a < e, a == e)
+		}
+	}
+	return false
+}
+
+func ordered(op string, less bool, equal bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	case ">=":
+		return !less
+	}
+	return false
+}
+
+// parsePath splits a path like $.feeds[0].name into its keys and indexes
+func parsePath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, syntaxError("json path must start with $: " + path)
+	}
+	rest := path[1:]
+	var steps []interface{}
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, syntaxError("empty key in json path " + path)
+			}
+			steps = append(steps, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, syntaxError("unterminated index in json path " + path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, syntaxError("invalid index in json path " + path)
+			}
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		default:
+			return nil, syntaxError("unexpected character in json path " + path)
+		}
+	}
+	return steps, nil
+}
+
+// And matches messages matched by every one of filters
+func And(filters ...Filter) Filter {
+	return and(filters)
+}
+
+type and []Filter
+
+func (f and) Match(msg constants.Message) bool {
+	for _, filter := range f {
+		if !filter.Match(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f and) String() string {
+	parts := make([]string, 0, len(f))
+	for _, filter := range f {
+		parts = append(parts, filter.String())
+	}
+	return strings.Join(parts, " && ")
+}
@@ -0,0 +1,72 @@
+package filter_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/filter"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestParse(t *testing.T) {
+	msg := constants.Message{
+		Type:    constants.ReceivedAnswer,
+		Data:    []byte(`{"feed": "eth-usd", "answer": 1850.5, "nodes": [{"name": "node7"}]}`),
+		Headers: map[string]string{"source": "chainlink", filter.RoundIDHeader: "42"},
+	}
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`header.source == "chainlink"`, true},
+		{`header.source == "other"`, false},
+		{`header.missing == ""`, false},
+		{`data startswith "{\"feed\""`, true},
+		{`data startswith "["`, false},
+		{`round in 40..50`, true},
+		{`round in 43..50`, false},
+		{`$.feed == "eth-usd"`, true},
+		{`$.answer > 1800`, true},
+		{`$.answer <= 1800`, false},
+		{`$.nodes[0].name != "node1"`, true},
+		{`$.nodes[1].name == "node1"`, false},
+		{`$.feed == "eth-usd" && round in 0..100 && header.source == "chainlink"`, true},
+		{`$.feed == "eth-usd" && round in 0..10`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := filter.Parse(tt.expr)
+			assert.Nil(t, err, "parse err is nil")
+			assert.Equal(t, tt.expected, f.Match(msg))
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`header.source = "x"`,
+		`header.source == unquoted`,
+		`data startswith`,
+		`round in 10..5`,
+		`$.feed ~ "x"`,
+		`feed == "x"`,
+		`$.feed == "x" &&`,
+		`$.feed == "unterminated`,
+	} {
+		_, err := filter.Parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestString(t *testing.T) {
+	f, err := filter.Parse(`header.source == "x" && $.answer >= 2`)
+	assert.Nil(t, err, "parse err is nil")
+	assert.Equal(t, `header.source == "x" && $.answer >= 2`, f.String())
+}
@@ -0,0 +1,180 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// syntaxError describes an invalid filter expression
+type syntaxError string
+
+func (e syntaxError) Error() string {
+	return "invalid filter: " + string(e)
+}
+
+// token is a lexical element of a filter expression
+type token struct {
+	text   string
+	quoted bool
+}
+
+// Parse compiles a filter expression made of clauses joined by &&, each clause being one of
+//
+//	header.<name> == "<value>"
+//	data startswith "<prefix>"
+//	round in <min>..<max>
+//	$.<json path> <op> <literal>
+func Parse(expr string) (Filter, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	var filters []Filter
+	for len(tokens) > 0 {
+		end := len(tokens)
+		for i, t := range tokens {
+			if t.text == "&&" && !t.quoted {
+				end = i
+				break
+			}
+		}
+		f, err := parseClause(tokens[:end])
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+		if end == len(tokens) {
+			break
+		}
+		tokens = tokens[end+1:]
+		if len(tokens) == 0 {
+			return nil, syntaxError("expression ends with &&")
+		}
+	}
+	if len(filters) == 0 {
+		return nil, syntaxError("empty expression")
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return And(filters...), nil
+}
+
+func parseClause(tokens []token) (Filter, error) {
+	if len(tokens) != 3 {
+		return nil, syntaxError("expected 3 terms in clause " + joinTokens(tokens))
+	}
+	subject, verb, object := tokens[0], tokens[1], tokens[2]
+	switch {
+	case strings.HasPrefix(subject.text, "header."):
+		if verb.text != "==" || !object.quoted {
+			return nil, syntaxError("header clauses must be header.<name> == \"<value>\"")
+		}
+		return HeaderEquals(strings.TrimPrefix(subject.text, "header."), object.text), nil
+	case subject.text == "data":
+		if verb.text != "startswith" || !object.quoted {
+			return nil, syntaxError("data clauses must be data startswith \"<prefix>\"")
+		}
+		return DataPrefix([]byte(object.text)), nil
+	case subject.text == "round":
+		bounds := strings.Split(object.text, "..")
+		if verb.text != "in" || len(bounds) != 2 {
+			return nil, syntaxError("round clauses must be round in <min>..<max>")
+		}
+		min, err := strconv.ParseUint(bounds[0], 10, 64)
+		if err != nil {
+			return nil, syntaxError("invalid round " + bounds[0])
+		}
+		max, err := strconv.ParseUint(bounds[1], 10, 64)
+		if err != nil || max < min {
+			return nil, syntaxError("invalid round " + bounds[1])
+		}
+		return RoundRange(min, max), nil
+	case strings.HasPrefix(subject.text, "$"):
+		value, err := parseLiteral(object)
+		if err != nil {
+			return nil, err
+		}
+		return JSONPath(subject.text, verb.text, value)
+	}
+	return nil, syntaxError("unknown clause " + joinTokens(tokens))
+}
+
+func parseLiteral(t token) (interface{}, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch t.text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, syntaxError("invalid literal " + t.text)
+	}
+	return number, nil
+}
+
+// tokenize splits an expression into quoted strings, operators and words
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, syntaxError("unterminated string")
+			}
+			text, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, syntaxError("invalid string " + expr[i:end+1])
+			}
+			tokens = append(tokens, token{text: text, quoted: true})
+			i = end + 1
+		case strings.ContainsRune("=!<>&", rune(c)):
+			end := i + 1
+			for end < len(expr) && strings.ContainsRune("=!<>&", rune(expr[end])) {
+				end++
+			}
+			op := expr[i:end]
+			if op != "&&" && !validOps[op] {
+				return nil, syntaxError("unknown operator " + op)
+			}
+			tokens = append(tokens, token{text: op})
+			i = end
+		default:
+			end := i
+			for end < len(expr) && !strings.ContainsRune(" \t\"=!<>&", rune(expr[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: expr[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func joinTokens(tokens []token) string {
+	parts := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if t.quoted {
+			parts = append(parts, strconv.Quote(t.text))
+		} else {
+			parts = append(parts, t.text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,197 @@
+package framing
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"messagerelayer/compress"
+	"messagerelayer/constants"
+)
+
+// Format describes how messages are delimited on a byte stream
+type Format int
+
+const (
+	// JSONL writes one JSON encoded message per line
+	JSONL Format = iota
+	// LengthPrefixed writes a 4 byte big endian length followed by a 1 byte message type and the message data.
+	// The high bits of the type byte flag compressed data, see encodingFlags.
+	LengthPrefixed
+)
+
+// encodingFlags are the type byte bits marking the compression of length prefixed frames, which have no headers
+// to carry compress.EncodingHeader in
+var encodingFlags = map[string]byte{
+	compress.Gzip.String():    0x80,
+	compress.Deflate.String(): 0x40,
+	compress.Snappy.String():  0xc0,
+}
+
+const encodingFlagMask = 0xc0
+
+// MaxFrameSize is the largest frame a reader will accept
+var MaxFrameSize = 1 << 20
+
+// ErrFrameTooLarge is returned when a frame exceeds MaxFrameSize
+var ErrFrameTooLarge = errors.New("frame exceeds max frame size")
+
+func (f Format) String() string {
+	if f == LengthPrefixed {
+		return "length-prefixed"
+	}
+	return "jsonl"
+}
+
+// ParseFormat returns the format for the provided name
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "jsonl":
+		return JSONL, nil
+	case "length-prefixed":
+		return LengthPrefixed, nil
+	}
+	return 0, fmt.Errorf("unknown framing format %q", name)
+}
+
+// Writer writes framed messages to an underlying stream
+type Writer struct {
+	w          *bufio.Writer
+	format     Format
+	compressor *compress.Compressor
+}
+
+// NewWriter returns a writer framing messages with the provided format
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{
+		w:      bufio.NewWriter(w),
+		format: format,
+	}
+}
+
+// Compress makes the writer compress messages with c before framing them
+func (fw *Writer) Compress(c *compress.Compressor) {
+	fw.compressor = c
+}
+
+// Write frames and flushes a single message. Length prefixed frames fail for data compressed with an encoding
+// they have no flag for.
+func (fw *Writer) Write(msg constants.Message) error {
+	if fw.compressor != nil {
+		compressed, err := fw.compressor.Compress(msg)
+		if err != nil {
+			return err
+		}
+		msg = compressed
+	}
+	if fw.format == LengthPrefixed {
+		encoding := msg.Headers[compress.EncodingHeader]
+		flag, ok := encodingFlags[encoding]
+		if encoding != "" && !ok {
+			return fmt.Errorf("content-encoding %q cannot be carried by length prefixed frames", encoding)
+		}
+		header := make([]byte, 5)
+		binary.BigEndian.PutUint32(header, uint32(len(msg.Data)+1))
+		header[4] = byte(msg.Type) | flag
+		if _, err := fw.w.Write(header); err != nil {
+			return err
+		}
+		if _, err := fw.w.Write(msg.Data); err != nil {
+			return err
+		}
+		return fw.w.Flush()
+	}
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.w.Write(append(encoded, '\n')); err != nil {
+		return err
+	}
+	return fw.w.Flush()
+}
+
+// Reader reads framed messages from an underlying stream
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+}
+
+// NewReader returns a reader decoding messages with the provided format
+func NewReader(r io.Reader, format Format) *Reader {
+	return &Reader{
+		r:      bufio.NewReader(r),
+		format: format,
+	}
+}
+
+// Read returns the next message on the stream
+func (fr *Reader) Read() (constants.Message, error) {
+	if fr.format == LengthPrefixed {
+		return fr.readLengthPrefixed()
+	}
+	return fr.readLine()
+}
+
+func (fr *Reader) readLengthPrefixed() (constants.Message, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(fr.r, header); err != nil {
+		return constants.Message{}, err
+	}
+	size := int(binary.BigEndian.Uint32(header))
+	if size > MaxFrameSize {
+		return constants.Message{}, ErrFrameTooLarge
+	}
+	if size == 0 {
+		return constants.Message{}, errors.New("empty frame")
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(fr.r, body); err != nil {
+		return constants.Message{}, err
+	}
+	return DecodeLengthPrefixed(body), nil
+}
+
+// DecodeLengthPrefixed parses the body of a length prefixed frame, the type byte followed by the data. Compressed
+// frames get compress.EncodingHeader set so the data can be decompressed downstream.
+func DecodeLengthPrefixed(body []byte) constants.Message {
+	msg := constants.Message{
+		Type: constants.MessageType(body[0] &^ encodingFlagMask),
+		Data: body[1:],
+	}
+	for encoding, flag := range encodingFlags {
+		if body[0]&encodingFlagMask == flag {
+			msg.Headers = map[string]string{compress.EncodingHeader: encoding}
+		}
+	}
+	return msg
+}
+
+func (fr *Reader) readLine() (constants.Message, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := fr.r.ReadLine()
+		if err != nil {
+			return constants.Message{}, err
+		}
+		line = append(line, chunk...)
+		if len(line) > MaxFrameSize {
+			return constants.Message{}, ErrFrameTooLarge
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	return Decode(line)
+}
+
+// Decode parses a single JSON encoded message
+func Decode(data []byte) (constants.Message, error) {
+	var msg constants.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return constants.Message{}, fmt.Errorf("malformed message: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,84 @@
+package grpcapi
+
+import (
+	"context"
+	"messagerelayer/constants"
+
+	"google.golang.org/grpc"
+)
+
+// Client calls the relayer service from Go without generated stubs, using ContentSubtype
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a client issuing calls over the provided connection
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// Publish enqueues a single message
+func (c *Client) Publish(ctx context.Context, msg constants.Message, opts ...grpc.CallOption) error {
+	resp := &PublishResponse{}
+	return c.cc.Invoke(ctx, "/messagerelayer.v1.Relayer/Publish", &Message{Type: msg.Type, Data: msg.Data}, resp, append(opts, grpc.CallContentSubtype(ContentSubtype))...)
+}
+
+// PublishStream opens a client stream enqueuing every message sent on it
+func (c *Client) PublishStream(ctx context.Context, opts ...grpc.CallOption) (*PublishStream, error) {
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/messagerelayer.v1.Relayer/PublishStream", append(opts, grpc.CallContentSubtype(ContentSubtype))...)
+	if err != nil {
+		return nil, err
+	}
+	return &PublishStream{stream: stream}, nil
+}
+
+// PublishStream is an open PublishStream call
+type PublishStream struct {
+	stream grpc.ClientStream
+}
+
+// Send publishes a message on the stream
+func (ps *PublishStream) Send(msg constants.Message) error {
+	return ps.stream.SendMsg(&Message{Type: msg.Type, Data: msg.Data})
+}
+
+// CloseAndRecv closes the stream and returns the number of messages the server enqueued
+func (ps *PublishStream) CloseAndRecv() (int, error) {
+	if err := ps.stream.CloseSend(); err != nil {
+		return 0, err
+	}
+	resp := &PublishResponse{}
+	if err := ps.stream.RecvMsg(resp); err != nil {
+		return 0, err
+	}
+	return int(resp.Accepted), nil
+}
+
+// Subscribe opens a server stream of broadcasts for the provided message types, cancelling ctx unsubscribes
+func (c *Client) Subscribe(ctx context.Context, types []constants.MessageType, bufferSize int, opts ...grpc.CallOption) (*SubscribeStream, error) {
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[1], "/messagerelayer.v1.Relayer/Subscribe", append(opts, grpc.CallContentSubtype(ContentSubtype))...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&SubscribeRequest{Types: types, BufferSize: uint32(bufferSize)}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &SubscribeStream{stream: stream}, nil
+}
+
+// SubscribeStream is an open Subscribe call
+type SubscribeStream struct {
+	stream grpc.ClientStream
+}
+
+// Recv blocks until the next broadcast arrives
+func (ss *SubscribeStream) Recv() (constants.Message, error) {
+	msg := &Message{}
+	if err := ss.stream.RecvMsg(msg); err != nil {
+		return constants.Message{}, err
+	}
+	return constants.Message{Type: msg.Type, Data: msg.Data}, nil
+}
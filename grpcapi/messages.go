@@ -0,0 +1,182 @@
+package grpcapi
+
+import (
+	"fmt"
+	"messagerelayer/constants"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The types below are hand written equivalents of the messages in relayer.proto so the service can be served
+// without a protoc toolchain. They encode to the same protobuf wire format, so clients generated from
+// relayer.proto interoperate with them as long as they call with ContentSubtype.
+
+// ContentSubtype is the content-subtype calls to the relayer service are made with, their content-type is
+// application/grpc+messagerelayer. It selects the codec of the hand written messages without replacing the proto
+// codec other services registered on the same grpc.Server rely on.
+const ContentSubtype = "messagerelayer"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// wireMessage is implemented by every message the codec can encode
+type wireMessage interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// Message is the wire representation of constants.Message
+type Message struct {
+	Type constants.MessageType
+	Data []byte
+}
+
+// PublishResponse reports how many messages a publish call enqueued
+type PublishResponse struct {
+	Accepted uint32
+}
+
+// SubscribeRequest selects the message types and buffer size of a subscription stream
+type SubscribeRequest struct {
+	Types      []constants.MessageType
+	BufferSize uint32
+}
+
+func (m *Message) marshal() []byte {
+	var b []byte
+	if m.Type != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.Type))
+	}
+	if len(m.Data) > 0 {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Data)
+	}
+	return b
+}
+
+func (m *Message) unmarshal(b []byte) error {
+	*m = Message{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			m.Type = constants.MessageType(v)
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			m.Data = append([]byte(nil), v...)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+func (r *PublishResponse) marshal() []byte {
+	var b []byte
+	if r.Accepted != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Accepted))
+	}
+	return b
+}
+
+func (r *PublishResponse) unmarshal(b []byte) error {
+	*r = PublishResponse{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			r.Accepted = uint32(v)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+func (r *SubscribeRequest) marshal() []byte {
+	var b []byte
+	if len(r.Types) > 0 {
+		var packed []byte
+		for _, t := range r.Types {
+			packed = protowire.AppendVarint(packed, uint64(t))
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	if r.BufferSize != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.BufferSize))
+	}
+	return b
+}
+
+func (r *SubscribeRequest) unmarshal(b []byte) error {
+	*r = SubscribeRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.Types = append(r.Types, constants.MessageType(v))
+			return n
+		case num == 1 && typ == protowire.BytesType:
+			packed, n := protowire.ConsumeBytes(b)
+			for len(packed) > 0 {
+				v, m := protowire.ConsumeVarint(packed)
+				if m < 0 {
+					return m
+				}
+				r.Types = append(r.Types, constants.MessageType(v))
+				packed = packed[m:]
+			}
+			return n
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.BufferSize = uint32(v)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// consumeFields walks the fields of an encoded message, handing each value to consume which returns the
+// number of bytes it used or a negative protowire error code
+func consumeFields(b []byte, consume func(protowire.Number, protowire.Type, []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n = consume(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// codec encodes the hand written messages in the protobuf wire format
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("grpcapi: cannot marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("grpcapi: cannot unmarshal into %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (codec) Name() string {
+	return ContentSubtype
+}
@@ -0,0 +1,256 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/relayer"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultStreamBuffer is the number of broadcasts buffered per Subscribe stream when the request leaves it unset
+var DefaultStreamBuffer = 10
+
+// MaxStreamBuffer caps the buffer size a Subscribe request may ask for
+var MaxStreamBuffer = 1000
+
+// ShutdownTimeout is how long the server waits for in flight calls before forcefully closing them
+var ShutdownTimeout = 5 * time.Second
+
+// Server exposes a message relayer as a gRPC service
+type Server interface {
+	Start(context.Context)
+	Register(*grpc.Server)
+	DoneChannel() chan bool
+	SetLogger(logging.Logger)
+}
+
+// RelayerServer implements the messagerelayer.v1.Relayer service described in relayer.proto
+type RelayerServer struct {
+	addr    string
+	relayer relayer.Relayer
+	closing chan struct{}
+	logger  logging.Logger
+	done    chan bool
+}
+
+// relayerService is the handler type the service description is registered against
+type relayerService interface {
+	Publish(context.Context, *Message) (*PublishResponse, error)
+	PublishStream(grpc.ServerStream) error
+	Subscribe(*SubscribeRequest, grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "messagerelayer.v1.Relayer",
+	HandlerType: (*relayerService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Publish",
+			Handler:    publishHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PublishStream",
+			Handler:       publishStreamHandler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       subscribeHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "relayer.proto",
+}
+
+// New returns a gRPC server publishing to and subscribing from the provided relayer
+func New(addr string, msgRelayer relayer.Relayer) Server {
+	return &RelayerServer{
+		addr:    addr,
+		relayer: msgRelayer,
+		closing: make(chan struct{}),
+		logger:  logging.Default(),
+		done:    make(chan bool),
+	}
+}
+
+// Register adds the relayer service to a grpc.Server, which may serve other services too
+func (s *RelayerServer) Register(srv *grpc.Server) {
+	srv.RegisterService(&serviceDesc, s)
+}
+
+// Start serves the relayer service on the configured address until the context is cancelled
+func (s *RelayerServer) Start(ctx context.Context) {
+	srv := grpc.NewServer()
+	s.Register(srv)
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.logger.Error("grpc server unable to listen", "addr", s.addr, logging.ErrorKey, err)
+		<-ctx.Done()
+		s.done <- true
+		return
+	}
+	go func() {
+		s.logger.Info("grpc server listening", "addr", s.addr)
+		if err := srv.Serve(listener); err != nil {
+			s.logger.Error("grpc server stopped", "addr", s.addr, logging.ErrorKey, err)
+		}
+	}()
+	<-ctx.Done()
+	s.logger.Info("closing grpc server", "addr", s.addr)
+	close(s.closing) // ends open Subscribe streams so the graceful stop can complete
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(ShutdownTimeout):
+		srv.Stop()
+	}
+	s.done <- true
+}
+
+// DoneChannel returns the servers done channel so the parent process can wait until it completes to exit
+func (s *RelayerServer) DoneChannel() chan bool {
+	return s.done
+}
+
+// SetLogger replaces the logger of the grpc server, it must be called before Start
+func (s *RelayerServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+// Publish enqueues a single message
+func (s *RelayerServer) Publish(ctx context.Context, msg *Message) (*PublishResponse, error) {
+	if err := s.enqueue(ctx, msg); err != nil {
+		return nil, err
+	}
+	return &PublishResponse{Accepted: 1}, nil
+}
+
+// PublishStream enqueues every message sent on the stream, responding with the count once the client closes it
+func (s *RelayerServer) PublishStream(stream grpc.ServerStream) error {
+	accepted := uint32(0)
+	for {
+		msg := &Message{}
+		err := stream.RecvMsg(msg)
+		if err == io.EOF {
+			return stream.SendMsg(&PublishResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.enqueue(stream.Context(), msg); err != nil {
+			return err
+		}
+		accepted++
+	}
+}
+
+func (s *RelayerServer) enqueue(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	if !validType(msg.Type) {
+		return status.Errorf(codes.InvalidArgument, "invalid message type %d", int(msg.Type))
+	}
+	if s.relayer.Saturated(msg.Type) {
+		return status.Errorf(codes.ResourceExhausted, "%v queue is saturated", msg.Type)
+	}
+	s.relayer.Enqueue(constants.Message{Type: msg.Type, Data: msg.Data})
+	return nil
+}
+
+// Subscribe streams broadcasts of the requested message types until the call is cancelled or its deadline passes.
+// Each stream gets its own bounded buffer per message type, once a slow client lets it fill the relayer skips the
+// stream. A message of type All is streamed once.
+func (s *RelayerServer) Subscribe(req *SubscribeRequest, stream grpc.ServerStream) error {
+	bufferSize := int(req.BufferSize)
+	if bufferSize == 0 {
+		bufferSize = DefaultStreamBuffer
+	}
+	if bufferSize > MaxStreamBuffer {
+		bufferSize = MaxStreamBuffer
+	}
+	types := map[constants.MessageType]bool{}
+	for _, t := range req.Types {
+		if !validType(t) {
+			return status.Errorf(codes.InvalidArgument, "invalid message type %d", int(t))
+		}
+		types[t] = true
+	}
+	msgType := constants.All
+	if len(types) == 1 {
+		for t := range types {
+			msgType = t
+		}
+	}
+	msgs := make(chan constants.Message)
+	done := make(chan struct{})
+	bridge := relayer.NewBridge(s.relayer, msgType, bufferSize, func(msg constants.Message) {
+		select {
+		case msgs <- msg:
+		case <-done:
+		}
+	})
+	bridge.Subscribe()
+	defer bridge.Unsubscribe()
+	defer close(done)
+	ctx := stream.Context()
+	for {
+		select {
+		case msg := <-msgs:
+			if err := stream.SendMsg(&Message{Type: msg.Type, Data: msg.Data}); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.closing:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+func validType(t constants.MessageType) bool {
+	return t == constants.StartNewRound || t == constants.ReceivedAnswer || t == constants.All
+}
+
+func publishHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	msg := &Message{}
+	if err := dec(msg); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(relayerService).Publish(ctx, msg)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/messagerelayer.v1.Relayer/Publish",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(relayerService).Publish(ctx, req.(*Message))
+	}
+	return interceptor(ctx, msg, info, handler)
+}
+
+func publishStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(relayerService).PublishStream(stream)
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &SubscribeRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(relayerService).Subscribe(req, stream)
+}
@@ -0,0 +1,144 @@
+package grpcapi_test
+
+import (
+	"context"
+	"messagerelayer/constants"
+	"messagerelayer/grpcapi"
+	"messagerelayer/relayer"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Exit(code)
+}
+
+// serve starts the relayer service next to the standard health service over an in-memory listener and returns a
+// client connected to it and its connection
+func serve(t *testing.T, msgRelayer relayer.Relayer) (*grpcapi.Client, *grpc.ClientConn) {
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	grpcapi.New("", msgRelayer).Register(srv)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthServer)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.Nil(t, err, "dial err is nil")
+	t.Cleanup(func() { conn.Close() })
+	return grpcapi.NewClient(conn), conn
+}
+
+func TestPublish(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	client, _ := serve(t, msgrelayer)
+	ctx := context.Background()
+	err := client.Publish(ctx, constants.Message{Type: constants.StartNewRound, Data: []byte("a")})
+	assert.Nil(t, err, "publish err is nil")
+	err = client.Publish(ctx, constants.Message{Type: 3, Data: []byte("a")})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "invalid type rejected")
+
+	expired, cancel := context.WithTimeout(ctx, -time.Second)
+	defer cancel()
+	err = client.Publish(expired, constants.Message{Type: constants.StartNewRound, Data: []byte("a")})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "deadline propagated")
+
+	stream, err := client.PublishStream(ctx)
+	assert.Nil(t, err, "open stream err is nil")
+	for i := 0; i < 3; i++ {
+		stream.Send(constants.Message{Type: constants.ReceivedAnswer, Data: []byte("b")})
+	}
+	accepted, err := stream.CloseAndRecv()
+	assert.Nil(t, err, "close stream err is nil")
+	assert.Equal(t, 3, accepted, "accepted count")
+	assert.Equal(t, 4, msgrelayer.Summary().QueuedMsgs, "queued message count")
+}
+
+func TestPublishRejectsWhenSaturated(t *testing.T) {
+	relayer.QueueSize = 1
+	defer func() { relayer.QueueSize = 50 }()
+	client, _ := serve(t, relayer.NewMessageRelayer(nil))
+	ctx := context.Background()
+	assert.Nil(t, client.Publish(ctx, constants.Message{Type: constants.StartNewRound, Data: []byte("a")}))
+	err := client.Publish(ctx, constants.Message{Type: constants.StartNewRound, Data: []byte("b")})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "saturated queue")
+}
+
+func TestSubscribe(t *testing.T) {
+	relayer.BroadcastInterval = 0 * time.Second
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	client, _ := serve(t, msgrelayer)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgrelayer.Start(ctx)
+
+	subCtx, unsubscribe := context.WithCancel(ctx)
+	stream, err := client.Subscribe(subCtx, []constants.MessageType{constants.ReceivedAnswer}, 5)
+	assert.Nil(t, err, "subscribe err is nil")
+	time.Sleep(100 * time.Millisecond) // artificial wait time to allow the subscription to register
+	client.Publish(ctx, constants.Message{Type: constants.StartNewRound, Data: []byte("ignored")})
+	client.Publish(ctx, constants.Message{Type: constants.ReceivedAnswer, Data: []byte("42")})
+	msg, err := stream.Recv()
+	assert.Nil(t, err, "recv err is nil")
+	assert.Equal(t, constants.ReceivedAnswer, msg.Type)
+	assert.Equal(t, "42", string(msg.Data))
+
+	unsubscribe()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err), "cancellation ends the stream")
+	time.Sleep(100 * time.Millisecond) // artificial wait time to allow the server to unsubscribe
+	broadcasted := msgrelayer.Summary().BroadcastedMsgs
+	client.Publish(ctx, constants.Message{Type: constants.ReceivedAnswer, Data: []byte("43")})
+	time.Sleep(100 * time.Millisecond) // artificial wait time to allow the message to be processed
+	assert.Equal(t, broadcasted, msgrelayer.Summary().BroadcastedMsgs, "unsubscribed stream no longer receives broadcasts")
+	cancel()
+	<-msgrelayer.DoneChannel()
+}
+
+func TestSubscribeStreamsAllOnce(t *testing.T) {
+	defer func(interval time.Duration) { relayer.BroadcastInterval = interval }(relayer.BroadcastInterval)
+	relayer.BroadcastInterval = 0 * time.Second
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	client, _ := serve(t, msgrelayer)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		<-msgrelayer.DoneChannel()
+	}()
+	go msgrelayer.Start(ctx)
+
+	subCtx, stop := context.WithTimeout(ctx, time.Second)
+	defer stop()
+	stream, err := client.Subscribe(subCtx, []constants.MessageType{constants.All}, 5)
+	assert.Nil(t, err, "subscribe err is nil")
+	time.Sleep(100 * time.Millisecond) // artificial wait time to allow the subscription to register
+	client.Publish(ctx, constants.Message{Type: constants.All, Data: []byte("both")})
+	msg, err := stream.Recv()
+	assert.Nil(t, err, "recv err is nil")
+	assert.Equal(t, "both", string(msg.Data))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "the All message is streamed once")
+}
+
+func TestSharedServer(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	client, conn := serve(t, msgrelayer)
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err, "proto service on the same server works")
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	assert.Nil(t, client.Publish(context.Background(), constants.Message{Type: constants.StartNewRound, Data: []byte("a")}), "relayer service works")
+}
@@ -0,0 +1,75 @@
+package health_test
+
+import (
+	"encoding/json"
+	"messagerelayer/health"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stalledProbe struct {
+	last time.Time
+}
+
+func (sp stalledProbe) Started() bool {
+	return true
+}
+
+func (sp stalledProbe) LastBeat() time.Time {
+	return sp.last
+}
+
+func probe(handler http.Handler, path string) (int, health.Report) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var report health.Report
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	return rec.Code, report
+}
+
+func TestHeartbeat(t *testing.T) {
+	heartbeat := health.NewHeartbeat()
+	assert.False(t, heartbeat.Started(), "not started before the first beat")
+	assert.True(t, heartbeat.LastBeat().IsZero(), "no last beat")
+	heartbeat.Beat()
+	assert.True(t, heartbeat.Started(), "started after the first beat")
+	assert.WithinDuration(t, time.Now(), heartbeat.LastBeat(), time.Second, "last beat is recent")
+}
+
+func TestReadiness(t *testing.T) {
+	server := health.New(":0")
+	loop := health.NewHeartbeat()
+	subscriber := health.NewHeartbeat()
+	server.Register("loop", loop, time.Minute)
+	server.Register("subscriber", subscriber, 0)
+
+	code, report := probe(server, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not ready before components start")
+	assert.Equal(t, map[string]string{"loop": "not started", "subscriber": "not started"}, report.Checks, "checks")
+	code, _ = probe(server, "/healthz")
+	assert.Equal(t, http.StatusOK, code, "starting components are alive")
+
+	loop.Beat()
+	subscriber.Beat()
+	code, report = probe(server, "/readyz")
+	assert.Equal(t, http.StatusOK, code, "ready once every component started")
+	assert.Equal(t, "ok", report.Status, "status")
+}
+
+func TestLiveness(t *testing.T) {
+	server := health.New(":0")
+	server.Register("relayer", stalledProbe{last: time.Now().Add(-time.Minute)}, 10*time.Second)
+	server.Register("subscriber", stalledProbe{last: time.Now().Add(-time.Hour)}, 0)
+	code, report := probe(server, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "stalled component fails liveness")
+	assert.Contains(t, report.Checks["relayer"], "no progress for 1m0", "stalled check")
+	assert.Equal(t, "ok", report.Checks["subscriber"], "components without a window are not checked for progress")
+
+	server.Register("relayer", stalledProbe{last: time.Now()}, 10*time.Second)
+	code, _ = probe(server, "/healthz")
+	assert.Equal(t, http.StatusOK, code, "alive once the component makes progress")
+}
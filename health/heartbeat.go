@@ -0,0 +1,42 @@
+package health
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Probe reports whether a component has started and when it last made progress
+type Probe interface {
+	Started() bool
+	LastBeat() time.Time
+}
+
+// Heartbeat is a Probe a component beats from its main loop, it is safe for concurrent use and its zero value is
+// a component that has not started
+type Heartbeat struct {
+	last atomic.Int64 // unix nanoseconds of the last beat, zero before the first
+}
+
+// NewHeartbeat returns a heartbeat that has not been beaten yet
+func NewHeartbeat() *Heartbeat {
+	return &Heartbeat{}
+}
+
+// Beat records that the component is running and made progress now, the first beat marks it started
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Started reports whether the heartbeat has been beaten at least once
+func (h *Heartbeat) Started() bool {
+	return h.last.Load() != 0
+}
+
+// LastBeat returns when the heartbeat was last beaten, the zero time if it never was
+func (h *Heartbeat) LastBeat() time.Time {
+	last := h.last.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
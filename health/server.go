@@ -0,0 +1,145 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"messagerelayer/logging"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ShutdownTimeout is how long the health server waits for in flight probes when closing
+var ShutdownTimeout = 5 * time.Second
+
+// Server serves the liveness and readiness of the registered components
+type Server interface {
+	http.Handler
+	Start(context.Context)
+	DoneChannel() chan bool
+	Register(name string, probe Probe, window time.Duration)
+	SetLogger(logging.Logger)
+}
+
+// HTTPServer serves GET /healthz and GET /readyz. /readyz fails until every registered component has started,
+// /healthz fails once a component registered with a window has not made progress within it.
+type HTTPServer struct {
+	addr     string
+	mux      *http.ServeMux
+	checksMu sync.RWMutex
+	checks   map[string]check // component name -> check
+	logger   logging.Logger
+	done     chan bool
+}
+
+type check struct {
+	probe  Probe
+	window time.Duration
+}
+
+// Report is the body returned by both endpoints, holding the status of each component
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+const statusOK = "ok"
+
+// New returns a health server listening on addr with no components registered
+func New(addr string) Server {
+	s := &HTTPServer{
+		addr:   addr,
+		mux:    http.NewServeMux(),
+		checks: make(map[string]check),
+		logger: logging.Default(),
+		done:   make(chan bool),
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleLiveness)
+	s.mux.HandleFunc("GET /readyz", s.handleReadiness)
+	return s
+}
+
+// Register adds a component to the probes. A window of zero only checks the component has started, otherwise
+// liveness also fails when its last beat is older than window.
+func (s *HTTPServer) Register(name string, probe Probe, window time.Duration) {
+	s.checksMu.Lock()
+	s.checks[name] = check{probe: probe, window: window}
+	s.checksMu.Unlock()
+}
+
+// ServeHTTP routes the request to the probe handlers
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start listens on the configured address until the context is cancelled
+func (s *HTTPServer) Start(ctx context.Context) {
+	srv := &http.Server{Addr: s.addr, Handler: s}
+	go func() {
+		s.logger.Info("health server listening", "addr", s.addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("health server stopped", "addr", s.addr, logging.ErrorKey, err)
+		}
+	}()
+	<-ctx.Done()
+	s.logger.Info("closing health server", "addr", s.addr)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	s.done <- true
+}
+
+// DoneChannel returns the health servers done channel so the parent process can wait until it completes to exit
+func (s *HTTPServer) DoneChannel() chan bool {
+	return s.done
+}
+
+// SetLogger replaces the logger of the health server, it must be called before Start
+func (s *HTTPServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+// handleLiveness only fails on stalled components, one that has not started yet is still coming up and is left
+// to the readiness probe so the orchestrator does not restart a slow starting process
+func (s *HTTPServer) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	s.respond(w, func(c check) string {
+		if c.window == 0 || !c.probe.Started() {
+			return statusOK
+		}
+		if stalled := now.Sub(c.probe.LastBeat()); stalled > c.window {
+			return fmt.Sprintf("no progress for %v", stalled.Round(time.Millisecond))
+		}
+		return statusOK
+	})
+}
+
+func (s *HTTPServer) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	s.respond(w, func(c check) string {
+		if !c.probe.Started() {
+			return "not started"
+		}
+		return statusOK
+	})
+}
+
+// respond writes the status of every component, failing with a 503 when any is not ok
+func (s *HTTPServer) respond(w http.ResponseWriter, status func(check) string) {
+	s.checksMu.RLock()
+	report := Report{Status: statusOK, Checks: make(map[string]string, len(s.checks))}
+	for name, c := range s.checks {
+		report.Checks[name] = status(c)
+		if report.Checks[name] != statusOK {
+			report.Status = "failing"
+		}
+	}
+	s.checksMu.RUnlock()
+	code := http.StatusOK
+	if report.Status != statusOK {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
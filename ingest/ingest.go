@@ -0,0 +1,202 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/relayer"
+	"messagerelayer/schema"
+	"net/http"
+	"time"
+)
+
+// MaxBodySize is the largest request body the ingest server will read
+var MaxBodySize int64 = 1 << 20
+
+// ShutdownTimeout is how long the ingest server waits for in flight requests when closing
+var ShutdownTimeout = 5 * time.Second
+
+// Server accepts messages pushed over HTTP and enqueues them to a message relayer
+type Server interface {
+	http.Handler
+	Start(context.Context)
+	DoneChannel() chan bool
+	SetLogger(logging.Logger)
+}
+
+// HTTPServer serves POST /messages, accepting a single JSON message or a JSON array of messages
+type HTTPServer struct {
+	addr      string
+	relayer   relayer.Relayer
+	validator *schema.Validator
+	mux       *http.ServeMux
+	logger    logging.Logger
+	done      chan bool
+}
+
+// New returns an ingest server that enqueues messages to the provided relayer
+func New(addr string, msgRelayer relayer.Relayer) Server {
+	s := &HTTPServer{
+		addr:    addr,
+		relayer: msgRelayer,
+		mux:     http.NewServeMux(),
+		logger:  logging.Default(),
+		done:    make(chan bool),
+	}
+	s.mux.HandleFunc("/messages", s.handleMessages)
+	return s
+}
+
+// NewValidated returns an ingest server checking messages against validator before enqueueing them. When the
+// validator rejects a message the whole request fails with its reason, quarantined messages are left out of the
+// accepted count.
+func NewValidated(addr string, msgRelayer relayer.Relayer, validator *schema.Validator) Server {
+	s := New(addr, msgRelayer).(*HTTPServer)
+	s.validator = validator
+	return s
+}
+
+// ServeHTTP routes the request to the ingest handlers
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start listens on the configured address until the context is cancelled
+func (s *HTTPServer) Start(ctx context.Context) {
+	srv := &http.Server{Addr: s.addr, Handler: s}
+	go func() {
+		s.logger.Info("ingest server listening", "addr", s.addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("ingest server stopped", "addr", s.addr, logging.ErrorKey, err)
+		}
+	}()
+	<-ctx.Done()
+	s.logger.Info("closing ingest server", "addr", s.addr)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	s.done <- true
+}
+
+// DoneChannel returns the ingest servers done channel so the parent process can wait until it completes to exit
+func (s *HTTPServer) DoneChannel() chan bool {
+	return s.done
+}
+
+// SetLogger replaces the logger of the ingest server, it must be called before Start
+func (s *HTTPServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+func (s *HTTPServer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only POST is supported"))
+		return
+	}
+	msgs, err := decodeMessages(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// reject the whole batch up front so producers never have to work out which part was accepted
+	if msgType, ok := s.fits(msgs); !ok {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, fmt.Errorf("%v queue is saturated", msgType))
+		return
+	}
+	quarantined := 0
+	if s.validator != nil {
+		valid := make([]constants.Message, 0, len(msgs))
+		for i, msg := range msgs {
+			isQuarantined, err := s.validator.Check(msg)
+			if isQuarantined {
+				quarantined++
+				continue
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("message %d: %w", i, err))
+				return
+			}
+			valid = append(valid, msg)
+		}
+		msgs = valid
+	}
+	for _, msg := range msgs {
+		s.relayer.Enqueue(msg)
+	}
+	if s.validator == nil {
+		writeJSON(w, http.StatusAccepted, map[string]int{"accepted": len(msgs)})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]int{"accepted": len(msgs), "quarantined": quarantined})
+}
+
+// fits reports whether every queue has room for the messages of the batch bound for it, messages of type All
+// counting against both queues and messages with a topic against the queue the topic routes them to, and
+// otherwise returns the type of the first queue without
+func (s *HTTPServer) fits(msgs []constants.Message) (constants.MessageType, bool) {
+	counts := map[constants.MessageType]int{}
+	for _, msg := range msgs {
+		msgType := msg.Type
+		if t := constants.TypeOfTopic(msg.Topic); t != 0 {
+			msgType = t
+		}
+		if msgType == constants.All {
+			counts[constants.StartNewRound]++
+			counts[constants.ReceivedAnswer]++
+			continue
+		}
+		counts[msgType]++
+	}
+	for _, msgType := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer} {
+		if counts[msgType] > 0 && counts[msgType] > s.relayer.Space(msgType) {
+			return msgType, false
+		}
+	}
+	return 0, true
+}
+
+// decodeMessages parses either a single message object or an array of messages and validates their types
+func decodeMessages(body io.Reader) ([]constants.Message, error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimSpace(raw)
+	var msgs []constants.Message
+	if len(raw) > 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &msgs)
+	} else {
+		var msg constants.Message
+		err = json.Unmarshal(raw, &msg)
+		msgs = append(msgs, msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed message: %w", err)
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("no messages provided")
+	}
+	for i, msg := range msgs {
+		if msg.Type == 0 && constants.TypeOfTopic(msg.Topic) == 0 {
+			return nil, fmt.Errorf("message %d is missing a type", i)
+		}
+	}
+	return msgs, nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
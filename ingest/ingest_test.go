@@ -0,0 +1,133 @@
+package ingest_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/ingest"
+	"messagerelayer/relayer"
+	"messagerelayer/schema"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Exit(code)
+}
+
+func post(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIngestMessages(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := ingest.New(":0", msgrelayer)
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "single message",
+			body:           `{"type": "StartNewRound", "data": "YQ=="}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "batch",
+			body:           `[{"type": "ReceivedAnswer", "data": "Yg=="}, {"type": "All", "data": "Yw=="}]`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "topic without a type",
+			body:           `{"topic": "round.answer.eth-usd", "data": "YQ=="}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "topic outside both queues",
+			body:           `{"topic": "price.eth-usd", "data": "YQ=="}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown type",
+			body:           `{"type": "Bogus", "data": "YQ=="}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing type",
+			body:           `{"data": "YQ=="}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty batch",
+			body:           `[]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(server, tt.body)
+			assert.Equal(t, tt.expectedStatus, rec.Code, rec.Body.String())
+		})
+	}
+	assert.Equal(t, 5, msgrelayer.Summary().QueuedMsgs, "queued message count")
+}
+
+func TestIngestRejectsWhenSaturated(t *testing.T) {
+	relayer.QueueSize = 2
+	defer func() { relayer.QueueSize = 50 }()
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := ingest.New(":0", msgrelayer)
+	body := `[{"type": "StartNewRound", "data": "YQ=="}, {"type": "StartNewRound", "data": "Yg=="}]`
+	assert.Equal(t, http.StatusAccepted, post(server, body).Code)
+	rec := post(server, body)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Equal(t, 2, msgrelayer.Summary().QueuedMsgs, "rejected batch is not enqueued")
+}
+
+func TestIngestRejectsBatchLargerThanSpace(t *testing.T) {
+	relayer.QueueSize = 3
+	defer func() { relayer.QueueSize = 50 }()
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := ingest.New(":0", msgrelayer)
+	assert.Equal(t, http.StatusAccepted, post(server, `{"type": "ReceivedAnswer", "data": "YQ=="}`).Code)
+	// two answers and one message for both queues need three slots in the answer queue, only two are left
+	body := `[{"type": "ReceivedAnswer", "data": "YQ=="}, {"type": "ReceivedAnswer", "data": "Yg=="}, {"type": "All", "data": "Yw=="}]`
+	rec := post(server, body)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	assert.Equal(t, 1, msgrelayer.Summary().QueuedMsgs, "nothing from the rejected batch is enqueued")
+	assert.Equal(t, http.StatusAccepted, post(server, `[{"type": "ReceivedAnswer", "data": "YQ=="}, {"type": "All", "data": "Yw=="}]`).Code)
+	rec = post(server, `{"topic": "round.answer.eth-usd", "data": "YQ=="}`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "topic-only messages count against the queue of their topic")
+}
+
+func TestIngestMethodNotAllowed(t *testing.T) {
+	server := ingest.New(":0", relayer.NewMessageRelayer(nil))
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/messages", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestIngestValidatesMessages(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	validator := schema.NewValidator(schema.Reject, nil)
+	answerSchema, err := schema.JSONSchema([]byte(`{"type": "object", "required": ["answer"]}`))
+	assert.Nil(t, err, "compile err is nil")
+	validator.Register(constants.ReceivedAnswer, answerSchema)
+	server := ingest.NewValidated(":0", msgrelayer, validator)
+	// data is base64 for {"answer": 1} and {}
+	rec := post(server, `[{"type": "ReceivedAnswer", "data": "eyJhbnN3ZXIiOiAxfQ=="}, {"type": "ReceivedAnswer", "data": "e30="}]`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `message 1: invalid recieved answer message: missing required property \"answer\"`)
+	assert.Equal(t, 0, msgrelayer.Summary().QueuedMsgs, "rejected batch is not enqueued")
+	rec = post(server, `{"type": "ReceivedAnswer", "data": "eyJhbnN3ZXIiOiAxfQ=="}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `{"accepted": 1, "quarantined": 0}`, rec.Body.String())
+}
@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger writes leveled log records, args are alternating keys and values added to the record as fields.
+// *slog.Logger implements it.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// keys of the fields components attach to their records
+const (
+	MessageIDKey  = "message_id"
+	TypeKey       = "type"
+	TopicKey      = "topic"
+	SubscriberKey = "subscriber"
+	GroupKey      = "group"
+	ErrorKey      = "error"
+)
+
+// Format is the encoding of log records
+type Format int
+
+const (
+	// Text writes records as key=value pairs
+	Text Format = iota
+	// JSON writes one JSON object per record
+	JSON
+)
+
+func (f Format) String() string {
+	if f == JSON {
+		return "json"
+	}
+	return "text"
+}
+
+// ParseFormat returns the format for the provided name
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "text":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	}
+	return 0, fmt.Errorf("unknown log format %q", name)
+}
+
+// ParseLevel returns the level for the provided name, one of debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// New returns a logger writing records at level and above to w in the provided format
+func New(w io.Writer, level slog.Level, format Format) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == JSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Default returns the logger components use until one is injected, info level text on stderr
+func Default() Logger {
+	return defaultLogger
+}
+
+var defaultLogger = New(os.Stderr, slog.LevelInfo, Text)
+
+// Discard returns a logger dropping every record
+func Discard() Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// SampleInterval is the window the sampling counts are reset after
+var SampleInterval = 1 * time.Second
+
+// SampleFirst is how many records with the same message a sampled logger writes per SampleInterval before sampling
+var SampleFirst = 10
+
+// SampleThereafter makes a sampled logger write every SampleThereafter-th record with the same message once
+// SampleFirst have been written in the current interval
+var SampleThereafter = 100
+
+// Sampled wraps l for hot paths, records are counted per level and message so frequent ones are thinned out
+// while rare ones still get through, see SampleFirst and SampleThereafter. Errors are never sampled.
+func Sampled(l Logger) Logger {
+	return &sampled{Logger: l, counts: make(map[sampleKey]int)}
+}
+
+type sampleKey struct {
+	level slog.Level
+	msg   string
+}
+
+type sampled struct {
+	Logger
+	mu     sync.Mutex
+	counts map[sampleKey]int
+	reset  time.Time
+}
+
+// allow reports whether the n-th record with the key in the current interval should be written
+func (s *sampled) allow(level slog.Level, msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.After(s.reset) {
+		clear(s.counts)
+		s.reset = now.Add(SampleInterval)
+	}
+	key := sampleKey{level: level, msg: msg}
+	s.counts[key]++
+	n := s.counts[key]
+	return n <= SampleFirst || (SampleThereafter > 0 && (n-SampleFirst)%SampleThereafter == 0)
+}
+
+func (s *sampled) Debug(msg string, args ...interface{}) {
+	if s.allow(slog.LevelDebug, msg) {
+		s.Logger.Debug(msg, args...)
+	}
+}
+
+func (s *sampled) Info(msg string, args ...interface{}) {
+	if s.allow(slog.LevelInfo, msg) {
+		s.Logger.Info(msg, args...)
+	}
+}
+
+func (s *sampled) Warn(msg string, args ...interface{}) {
+	if s.allow(slog.LevelWarn, msg) {
+		s.Logger.Warn(msg, args...)
+	}
+}
@@ -0,0 +1,57 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, slog.LevelInfo, logging.JSON)
+	logger.Debug("hidden")
+	logger.Info("queued message", logging.TypeKey, constants.StartNewRound, logging.MessageIDKey, "abc")
+	var record map[string]interface{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &record), "one JSON record written")
+	assert.Equal(t, "INFO", record["level"], "level")
+	assert.Equal(t, "queued message", record["msg"], "message")
+	assert.Equal(t, "StartNewRound", record[logging.TypeKey], "message type encoded by name")
+	assert.Equal(t, "abc", record[logging.MessageIDKey], "message id")
+}
+
+func TestParse(t *testing.T) {
+	level, err := logging.ParseLevel("warn")
+	assert.Nil(t, err, "parse err is nil")
+	assert.Equal(t, slog.LevelWarn, level, "level")
+	_, err = logging.ParseLevel("loud")
+	assert.NotNil(t, err, "unknown level")
+	format, err := logging.ParseFormat("json")
+	assert.Nil(t, err, "parse err is nil")
+	assert.Equal(t, logging.JSON, format, "format")
+	_, err = logging.ParseFormat("xml")
+	assert.NotNil(t, err, "unknown format")
+}
+
+func TestSampled(t *testing.T) {
+	logging.SampleInterval = time.Hour
+	logging.SampleFirst = 2
+	logging.SampleThereafter = 3
+	var out bytes.Buffer
+	logger := logging.Sampled(logging.New(&out, slog.LevelDebug, logging.Text))
+	for i := 0; i < 10; i++ {
+		logger.Debug("hot")
+		logger.Error("failed")
+	}
+	logger.Info("rare")
+	text := out.String()
+	assert.Equal(t, 4, strings.Count(text, "msg=hot"), "first 2 then every 3rd")
+	assert.Equal(t, 10, strings.Count(text, "msg=failed"), "errors are not sampled")
+	assert.Equal(t, 1, strings.Count(text, "msg=rare"), "rare records get through")
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"messagerelayer/admin"
 	"messagerelayer/constants"
+	"messagerelayer/health"
+	"messagerelayer/logging"
+	"messagerelayer/metrics"
 	"messagerelayer/poller"
 	"messagerelayer/relayer"
+	"messagerelayer/schema"
 	"messagerelayer/subscriber"
+	"messagerelayer/supervisor"
+	"messagerelayer/tracing"
 	"os"
 	"os/signal"
 	"syscall"
@@ -16,6 +23,48 @@ import (
 
 const READ_INTERVAL_SECS = 5
 
+// ADAPTIVE_POLLING makes the poller read in batches while the socket has messages and back off while it has none
+// instead of reading one message every READ_INTERVAL_SECS
+const ADAPTIVE_POLLING = false
+
+const METRICS_ADDR = ":9090"
+
+// ADMIN_ADDR is where the admin API listens, it can purge queues and inject messages so it is bound to loopback
+// and must not be exposed beyond a trusted network
+const ADMIN_ADDR = "127.0.0.1:9091"
+
+// ADMIN_TOKEN is the bearer token the admin API requires, it is unauthenticated when empty
+const ADMIN_TOKEN = ""
+
+const HEALTH_ADDR = ":9092"
+
+// LIVENESS_WINDOW_SECS is how long the broadcast loop and poller may go without progress before /healthz fails,
+// it has to exceed READ_INTERVAL_SECS
+const LIVENESS_WINDOW_SECS = 30
+
+// TRACE_FILE is the file spans are appended to as JSON lines, tracing is disabled when it and OTLP_ENDPOINT are empty
+const TRACE_FILE = ""
+
+// OTLP_ENDPOINT is the OTLP/HTTP traces endpoint of a collector spans are sent to, like http://localhost:4318/v1/traces
+const OTLP_ENDPOINT = ""
+
+// LOG_LEVEL is the lowest level logged, one of debug, info, warn or error
+const LOG_LEVEL = "info"
+
+// LOG_FORMAT is the encoding of log records, text or json
+const LOG_FORMAT = "text"
+
+// DRAIN_TIMEOUT_SECS bounds how long the relayer flushes its queues, and then subscribers their buffers, on shutdown
+const DRAIN_TIMEOUT_SECS = 10
+
+// UNDELIVERED_FILE is the file messages still queued after draining are appended to as JSON lines, they are only
+// logged and counted as discarded when it is empty
+const UNDELIVERED_FILE = ""
+
+// SHUTDOWN_TIMEOUT_SECS is how long the relayer and each subscriber may take to stop, it has to exceed
+// DRAIN_TIMEOUT_SECS
+const SHUTDOWN_TIMEOUT_SECS = 15
+
 type MockNetworkSocket struct {
 	Messages                 []constants.Message
 	DelaySecsBetweenMessages func(int) time.Duration // take in the number of messages and return a delay
@@ -58,54 +107,156 @@ func main() {
 	/*
 	 * Service configuration and setup
 	 */
-	rootCtx, cancel := context.WithCancel(context.Background())
+	logger := newLogger()
+	relayer.DrainTimeout = DRAIN_TIMEOUT_SECS * time.Second
+	subscriber.DrainTimeout = DRAIN_TIMEOUT_SECS * time.Second
 	msgRelayer := relayer.NewMessageRelayer(&MockNetworkSocket{ProcessedMsgs: 0})
-	msgPoller := poller.New(READ_INTERVAL_SECS * time.Second)
-	go handleSigInt(cancel, msgRelayer, msgPoller)
+	msgRelayer.SetLogger(logger)
+	spill := newSpill(logger)
+	if spill != nil {
+		msgRelayer.SpillTo(spill)
+	}
+	tracer := newTracer(logger)
+	msgRelayer.SetTracer(tracer)
+	validator := schema.NewValidator(schema.Reject, nil)
+	validator.SetLogger(logger)
+	msgRelayer.Use(relayer.EnqueueStage, validator.Interceptor())
+	msgPoller := newPoller()
+	msgPoller.SetLogger(logger)
+	registry := metrics.NewRegistry()
+	registry.Register(msgRelayer)
+	registry.Register(msgPoller)
+	registry.Register(validator)
+	metricsServer := metrics.NewServer(METRICS_ADDR, registry)
+	metricsServer.SetLogger(logger)
+	adminServer := newAdminServer(msgRelayer)
+	adminServer.SetLogger(logger)
+	healthServer := health.New(HEALTH_ADDR)
+	healthServer.SetLogger(logger)
+	healthServer.Register("relayer", msgRelayer.Heartbeat(), LIVENESS_WINDOW_SECS*time.Second)
+	healthServer.Register("poller", msgPoller.Heartbeat(), LIVENESS_WINDOW_SECS*time.Second)
+	sup := supervisor.New()
+	sup.SetLogger(logger)
+	sup.Add("health server", healthServer)
 	/*
 	 * Add subscribers
 	 */
+	subscriberNames := []string{}
 	for _, s := range subscribers {
+		s.SetLogger(logger)
+		if acking, ok := s.(subscriber.Acking); ok {
+			acking.AckTo(msgRelayer)
+		}
+		name := "subscriber " + s.Name()
+		healthServer.Register(name, s.Heartbeat(), 0)
 		subscriberType := s.Type()
 		if subscriberType == constants.StartNewRound || subscriberType == constants.All {
 			subscriberChan := s.Channel(constants.StartNewRound)
-			msgRelayer.SubscribeToMessages(constants.StartNewRound, subscriberChan)
+			msgRelayer.SubscribeToMessages(constants.StartNewRound, subscriberChan, relayer.Named(s.Name()))
 		}
 		if subscriberType == constants.ReceivedAnswer || subscriberType == constants.All {
 			subscriberChan := s.Channel(constants.ReceivedAnswer)
-			msgRelayer.SubscribeToMessages(constants.ReceivedAnswer, subscriberChan)
+			msgRelayer.SubscribeToMessages(constants.ReceivedAnswer, subscriberChan, relayer.Named(s.Name()))
 		}
-		go s.Start(rootCtx)
+		sup.Add(name, s, supervisor.StopTimeout(SHUTDOWN_TIMEOUT_SECS*time.Second))
+		subscriberNames = append(subscriberNames, name)
 	}
+	// the poller stops reading first, then the relayer flushes its queues to subscribers that are still running
+	sup.Add("relayer", msgRelayer, supervisor.DependsOn(subscriberNames...), supervisor.StopTimeout(SHUTDOWN_TIMEOUT_SECS*time.Second))
+	sup.Add("poller", supervisor.ComponentFunc(func(ctx context.Context) {
+		msgPoller.Start(ctx, msgRelayer)
+	}, msgPoller.DoneChannel()), supervisor.DependsOn("relayer"))
+	sup.Add("metrics server", metricsServer, supervisor.DependsOn("relayer", "poller"))
+	sup.Add("admin server", adminServer, supervisor.DependsOn("relayer"))
 	/*
-	 * Start service
+	 * Start service, blocking until sigint detected
 	 */
-	log.Println("starting message relayer & poller...")
-	go msgRelayer.Start(rootCtx)
-	go msgPoller.Start(rootCtx, msgRelayer)
-	select {} // block until sigint detected
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger.Info("starting message relayer & poller")
+	statuses, err := sup.Run(ctx)
+	if err != nil {
+		fatal(logger, "unable to run components", err)
+	}
+	if spill != nil {
+		if err := spill.Close(); err != nil {
+			logger.Error("unable to close undelivered messages file", "path", UNDELIVERED_FILE, logging.ErrorKey, err)
+		}
+	}
+	// flush the spans of the messages relayed before closing
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			logger.Error("unable to flush traces", logging.ErrorKey, err)
+		}
+	}
+	for _, status := range statuses {
+		if status.State != supervisor.Stopped {
+			logger.Error("component did not stop gracefully", "component", status.Name)
+			os.Exit(1)
+		}
+	}
+	logger.Info("exiting gracefully")
 }
 
-func handleSigInt(cancel context.CancelFunc, msgRelayer relayer.Relayer, msgPoller poller.Poller) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
-	log.Println("detected signal interrupt, cleaning up and exiting..")
-	cancel()
-	// wait for all subscribers to close gracefully
-	for _, s := range subscribers {
-		<-s.DoneChannel()
-		close(s.DoneChannel())
-		log.Printf("subscriber %v is now closed", s.Name())
+// newLogger returns the logger configured by LOG_LEVEL and LOG_FORMAT
+func newLogger() *slog.Logger {
+	level, err := logging.ParseLevel(LOG_LEVEL)
+	if err != nil {
+		fatal(logging.Default(), "invalid LOG_LEVEL", err)
+	}
+	format, err := logging.ParseFormat(LOG_FORMAT)
+	if err != nil {
+		fatal(logging.Default(), "invalid LOG_FORMAT", err)
+	}
+	return logging.New(os.Stderr, level, format)
+}
+
+// fatal logs err and exits
+func fatal(logger logging.Logger, msg string, err error) {
+	logger.Error(msg, logging.ErrorKey, err)
+	os.Exit(1)
+}
+
+// newAdminServer returns the admin server, requiring ADMIN_TOKEN when it is set
+func newAdminServer(msgRelayer relayer.Relayer) admin.Server {
+	if ADMIN_TOKEN != "" {
+		return admin.NewAuthenticated(ADMIN_ADDR, msgRelayer, ADMIN_TOKEN)
+	}
+	return admin.New(ADMIN_ADDR, msgRelayer)
+}
+
+// newPoller returns the poller configured by ADAPTIVE_POLLING
+func newPoller() poller.Poller {
+	if ADAPTIVE_POLLING {
+		return poller.NewAdaptive(READ_INTERVAL_SECS * time.Second)
+	}
+	return poller.New(READ_INTERVAL_SECS * time.Second)
+}
+
+// newTracer returns a tracer exporting to OTLP_ENDPOINT, or to TRACE_FILE when no endpoint is set, and nil when
+// tracing is disabled
+func newTracer(logger logging.Logger) *tracing.Tracer {
+	if OTLP_ENDPOINT != "" {
+		return tracing.NewTracer(tracing.NewOTLPExporter(OTLP_ENDPOINT))
+	}
+	if TRACE_FILE == "" {
+		return nil
+	}
+	exporter, err := tracing.NewFileExporter(TRACE_FILE)
+	if err != nil {
+		fatal(logger, "unable to open trace file", err)
+	}
+	return tracing.NewTracer(exporter)
+}
+
+// newSpill returns the file undelivered messages are written to on shutdown, nil when UNDELIVERED_FILE is empty
+func newSpill(logger logging.Logger) *schema.FileDeadLetter {
+	if UNDELIVERED_FILE == "" {
+		return nil
+	}
+	spill, err := schema.NewFileDeadLetter(UNDELIVERED_FILE)
+	if err != nil {
+		fatal(logger, "unable to open undelivered messages file", err)
 	}
-	// wait for message relayer to close gracefully
-	<-msgRelayer.DoneChannel()
-	log.Printf("message relayer is now closed")
-	close(msgRelayer.DoneChannel())
-	// wait for poller to close gracefully
-	<-msgPoller.DoneChannel()
-	log.Printf("poller is now closed")
-	close(msgPoller.DoneChannel())
-	log.Println("exiting gracefully")
-	os.Exit(0)
+	return spill
 }
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are latency bucket upper bounds in seconds, from a millisecond to a minute
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// HistogramValue counts observations into cumulative buckets, it is safe for concurrent use
+type HistogramValue struct {
+	mu      sync.Mutex
+	buckets []float64 // upper bounds, sorted
+	counts  []uint64  // observations per bucket, not cumulative, the last one is +Inf
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram returns a histogram with the provided bucket upper bounds, nil uses DefaultBuckets
+func NewHistogram(buckets []float64) *HistogramValue {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &HistogramValue{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe records a value
+func (h *HistogramValue) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// ObserveDuration records a duration in seconds
+func (h *HistogramValue) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Snapshot is a point in time copy of a histogram
+type Snapshot struct {
+	Buckets []float64 // upper bounds
+	Counts  []uint64  // cumulative count per bucket, the final entry is the +Inf bucket
+	Sum     float64
+	Count   uint64
+}
+
+// Snapshot returns the current state of the histogram
+func (h *HistogramValue) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cumulative := make([]uint64, len(h.counts))
+	total := uint64(0)
+	for i, c := range h.counts {
+		total += c
+		cumulative[i] = total
+	}
+	return Snapshot{
+		Buckets: append([]float64(nil), h.buckets...),
+		Counts:  cumulative,
+		Sum:     h.sum,
+		Count:   h.count,
+	}
+}
+
+// Quantile estimates the value below which q of the observations fall by interpolating within buckets
+func (s Snapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count)
+	lower := 0.0
+	previous := uint64(0)
+	for i, upper := range s.Buckets {
+		if float64(s.Counts[i]) >= rank {
+			inBucket := s.Counts[i] - previous
+			if inBucket == 0 {
+				return upper
+			}
+			return lower + (upper-lower)*(rank-float64(previous))/float64(inBucket)
+		}
+		lower = upper
+		previous = s.Counts[i]
+	}
+	if len(s.Buckets) == 0 {
+		return math.Inf(1)
+	}
+	return s.Buckets[len(s.Buckets)-1] // above the highest bound, the best estimate is the bound
+}
+
+// Mean returns the average observation
+func (s Snapshot) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Samples returns the _bucket, _sum and _count samples of the snapshot with labels added to each
+func (s Snapshot) Samples(labels ...Label) []Sample {
+	samples := make([]Sample, 0, len(s.Counts)+2)
+	for i, count := range s.Counts {
+		le := "+Inf"
+		if i < len(s.Buckets) {
+			le = strconv.FormatFloat(s.Buckets[i], 'g', -1, 64)
+		}
+		bucketLabels := append(append([]Label(nil), labels...), Label{Name: "le", Value: le})
+		samples = append(samples, Sample{Suffix: "_bucket", Labels: bucketLabels, Value: float64(count)})
+	}
+	samples = append(samples,
+		Sample{Suffix: "_sum", Labels: labels, Value: s.Sum},
+		Sample{Suffix: "_count", Labels: labels, Value: float64(s.Count)},
+	)
+	return samples
+}
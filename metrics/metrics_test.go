@@ -0,0 +1,62 @@
+package metrics_test
+
+import (
+	"messagerelayer/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.Register(metrics.CollectorFunc(func() []metrics.Family {
+		return []metrics.Family{{
+			Name:    "b_total",
+			Help:    "Second family.",
+			Type:    metrics.Counter,
+			Samples: []metrics.Sample{{Labels: []metrics.Label{{Name: "name", Value: `quote " and \ slash`}}, Value: 2}},
+		}}
+	}))
+	registry.Register(metrics.CollectorFunc(func() []metrics.Family {
+		h := metrics.NewHistogram([]float64{1, 2})
+		h.Observe(0.5)
+		h.Observe(1.5)
+		h.Observe(3)
+		return []metrics.Family{
+			{Name: "a_seconds", Help: "First family.", Type: metrics.Histogram, Samples: h.Snapshot().Samples()},
+			{Name: "b_total", Help: "Second family.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: 1}}},
+		}
+	}))
+	server := metrics.NewServer(":0", registry)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP a_seconds First family.
+# TYPE a_seconds histogram
+a_seconds_bucket{le="1"} 1
+a_seconds_bucket{le="2"} 2
+a_seconds_bucket{le="+Inf"} 3
+a_seconds_sum 5
+a_seconds_count 3
+# HELP b_total Second family.
+# TYPE b_total counter
+b_total{name="quote \" and \\ slash"} 2
+b_total 1
+`, rec.Body.String())
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := metrics.NewHistogram([]float64{10, 20, 30})
+	for i := 1; i <= 30; i++ {
+		h.Observe(float64(i))
+	}
+	snapshot := h.Snapshot()
+	assert.Equal(t, uint64(30), snapshot.Count)
+	assert.InDelta(t, 15.5, snapshot.Mean(), 0.001)
+	assert.InDelta(t, 15, snapshot.Quantile(0.5), 0.001)
+	assert.InDelta(t, 30, snapshot.Quantile(1), 0.001)
+	assert.Equal(t, 0.0, metrics.NewHistogram(nil).Snapshot().Quantile(0.5), "empty histogram")
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"messagerelayer/logging"
+	"net/http"
+	"time"
+)
+
+// ShutdownTimeout is how long the metrics server waits for in flight scrapes when closing
+var ShutdownTimeout = 5 * time.Second
+
+// Server serves a registry on /metrics
+type Server interface {
+	http.Handler
+	Start(context.Context)
+	DoneChannel() chan bool
+	SetLogger(logging.Logger)
+}
+
+// HTTPServer serves GET /metrics
+type HTTPServer struct {
+	addr   string
+	mux    *http.ServeMux
+	logger logging.Logger
+	done   chan bool
+}
+
+// NewServer returns a server exposing the registry's metrics on addr
+func NewServer(addr string, registry *Registry) Server {
+	s := &HTTPServer{
+		addr:   addr,
+		mux:    http.NewServeMux(),
+		logger: logging.Default(),
+		done:   make(chan bool),
+	}
+	s.mux.Handle("/metrics", registry)
+	return s
+}
+
+// ServeHTTP routes the request to the metrics handler
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start listens on the configured address until the context is cancelled
+func (s *HTTPServer) Start(ctx context.Context) {
+	srv := &http.Server{Addr: s.addr, Handler: s}
+	go func() {
+		s.logger.Info("metrics server listening", "addr", s.addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("metrics server stopped", "addr", s.addr, logging.ErrorKey, err)
+		}
+	}()
+	<-ctx.Done()
+	s.logger.Info("closing metrics server", "addr", s.addr)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	s.done <- true
+}
+
+// DoneChannel returns the metrics servers done channel so the parent process can wait until it completes to exit
+func (s *HTTPServer) DoneChannel() chan bool {
+	return s.done
+}
+
+// SetLogger replaces the logger of the metrics server, it must be called before Start
+func (s *HTTPServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
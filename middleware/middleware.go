@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/filter"
+	"strings"
+)
+
+// Interceptor transforms a message on its way through the relayer. Returning no messages drops it, returning
+// several splits it. A message an interceptor returns an error for is dropped.
+type Interceptor interface {
+	Name() string
+	Intercept(constants.Message) ([]constants.Message, error)
+}
+
+// Chain is an ordered list of interceptors, the output of each feeding the next
+type Chain []Interceptor
+
+// Apply runs msg through the chain and returns the resulting messages along with the number of messages an
+// interceptor dropped, onError is called for every message an interceptor fails or panics on
+func (c Chain) Apply(msg constants.Message, onError func(Interceptor, error)) (msgs []constants.Message, dropped int) {
+	msgs = []constants.Message{msg}
+	for _, interceptor := range c {
+		next := make([]constants.Message, 0, len(msgs))
+		for _, m := range msgs {
+			out, err := intercept(interceptor, m)
+			if err != nil {
+				onError(interceptor, err)
+				continue
+			}
+			if len(out) == 0 {
+				dropped++
+			}
+			next = append(next, out...)
+		}
+		msgs = next
+		if len(msgs) == 0 {
+			break
+		}
+	}
+	return msgs, dropped
+}
+
+// intercept runs interceptor on msg, turning a panic into an error so a faulty interceptor only fails the message
+func intercept(interceptor Interceptor, msg constants.Message) (out []constants.Message, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("interceptor panicked: %v", r)
+		}
+	}()
+	return interceptor.Intercept(msg)
+}
+
+// Func adapts a function to the Interceptor interface
+func Func(name string, fn func(constants.Message) ([]constants.Message, error)) Interceptor {
+	return funcInterceptor{name: name, fn: fn}
+}
+
+type funcInterceptor struct {
+	name string
+	fn   func(constants.Message) ([]constants.Message, error)
+}
+
+func (f funcInterceptor) Name() string {
+	return f.name
+}
+
+func (f funcInterceptor) Intercept(msg constants.Message) ([]constants.Message, error) {
+	return f.fn(msg)
+}
+
+// SetHeaders enriches messages with headers, overwriting existing values
+func SetHeaders(headers map[string]string) Interceptor {
+	return Func("set headers", func(msg constants.Message) ([]constants.Message, error) {
+		// the header map may be shared with other subscribers of the message so it is copied before writing
+		enriched := make(map[string]string, len(msg.Headers)+len(headers))
+		for k, v := range msg.Headers {
+			enriched[k] = v
+		}
+		for k, v := range headers {
+			enriched[k] = v
+		}
+		msg.Headers = enriched
+		return []constants.Message{msg}, nil
+	})
+}
+
+// Redacted replaces the values of fields removed by Redact
+const Redacted = "[REDACTED]"
+
+// Redact replaces the JSON payload fields at the provided dotted paths, like user.email, with Redacted. Messages
+// whose payload is not a JSON object fail.
+func Redact(fields ...string) Interceptor {
+	return Func("redact", func(msg constants.Message) ([]constants.Message, error) {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(msg.Data, &doc); err != nil {
+			return nil, fmt.Errorf("payload is not a json object: %w", err)
+		}
+		for _, field := range fields {
+			redact(doc, strings.Split(field, "."))
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = data
+		return []constants.Message{msg}, nil
+	})
+}
+
+func redact(doc map[string]interface{}, path []string) {
+	value, ok := doc[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		doc[path[0]] = Redacted
+		return
+	}
+	if nested, ok := value.(map[string]interface{}); ok {
+		redact(nested, path[1:])
+	}
+}
+
+// Reencode replaces message payloads with the output of encode
+func Reencode(name string, encode func([]byte) ([]byte, error)) Interceptor {
+	return Func(name, func(msg constants.Message) ([]constants.Message, error) {
+		data, err := encode(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = data
+		return []constants.Message{msg}, nil
+	})
+}
+
+// DropIf drops the messages f matches
+func DropIf(f filter.Filter) Interceptor {
+	return Func("drop if "+f.String(), func(msg constants.Message) ([]constants.Message, error) {
+		if f.Match(msg) {
+			return nil, nil
+		}
+		return []constants.Message{msg}, nil
+	})
+}
+
+// SplitJSONArray turns a message whose payload is a JSON array into one message per element, other payloads
+// pass through untouched
+func SplitJSONArray() Interceptor {
+	return Func("split json array", func(msg constants.Message) ([]constants.Message, error) {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(msg.Data, &elements); err != nil {
+			return []constants.Message{msg}, nil
+		}
+		msgs := make([]constants.Message, 0, len(elements))
+		for _, element := range elements {
+			part := msg
+			part.Data = []byte(element)
+			msgs = append(msgs, part)
+		}
+		return msgs, nil
+	})
+}
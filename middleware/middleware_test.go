@@ -0,0 +1,56 @@
+package middleware_test
+
+import (
+	"errors"
+	"messagerelayer/constants"
+	"messagerelayer/filter"
+	"messagerelayer/middleware"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func apply(chain middleware.Chain, msg constants.Message) ([]constants.Message, []string) {
+	failed := []string{}
+	msgs, _ := chain.Apply(msg, func(interceptor middleware.Interceptor, err error) {
+		failed = append(failed, interceptor.Name())
+	})
+	return msgs, failed
+}
+
+func TestChain(t *testing.T) {
+	chain := middleware.Chain{
+		middleware.SplitJSONArray(),
+		middleware.DropIf(filter.DataPrefix([]byte(`{"drop"`))),
+		middleware.Redact("user.email", "secret"),
+		middleware.SetHeaders(map[string]string{"source": "test"}),
+	}
+	headers := map[string]string{"key": "k"}
+	msgs, failed := apply(chain, constants.Message{
+		Type:    constants.ReceivedAnswer,
+		Data:    []byte(`[{"user": {"email": "a@b.c", "name": "a"}, "secret": 1}, {"drop": true}, 3]`),
+		Headers: headers,
+	})
+	assert.Equal(t, []string{"redact"}, failed, "redacting a number fails")
+	_, dropped := chain.Apply(constants.Message{Data: []byte(`[{"drop": 1}, {"drop": 2}]`)}, nil)
+	assert.Equal(t, 2, dropped, "dropped message count")
+	assert.Equal(t, 1, len(msgs), "one message survives")
+	assert.JSONEq(t, `{"user": {"email": "[REDACTED]", "name": "a"}, "secret": "[REDACTED]"}`, string(msgs[0].Data))
+	assert.Equal(t, map[string]string{"key": "k", "source": "test"}, msgs[0].Headers, "headers are enriched")
+	assert.Equal(t, map[string]string{"key": "k"}, headers, "original headers are untouched")
+}
+
+func TestReencode(t *testing.T) {
+	upper := middleware.Reencode("upper", func(data []byte) ([]byte, error) {
+		if len(data) == 0 {
+			return nil, errors.New("empty payload")
+		}
+		return append([]byte("!"), data...), nil
+	})
+	msgs, failed := apply(middleware.Chain{upper}, constants.Message{Data: []byte("a")})
+	assert.Equal(t, 0, len(failed), "no failures")
+	assert.Equal(t, "!a", string(msgs[0].Data))
+	msgs, failed = apply(middleware.Chain{upper}, constants.Message{})
+	assert.Equal(t, []string{"upper"}, failed, "empty payload fails")
+	assert.Equal(t, 0, len(msgs), "failed message is dropped")
+}
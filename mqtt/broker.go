@@ -0,0 +1,235 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/relayer"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnBufferSize is the number of broadcasts buffered per subscribed client before the relayer skips it
+var ConnBufferSize = 10
+
+// ConnectTimeout is how long a client has to send CONNECT after opening a connection
+var ConnectTimeout = 10 * time.Second
+
+// RetryInterval is how long a QoS 1 delivery waits for a PUBACK before it is retransmitted
+var RetryInterval = 5 * time.Second
+
+// MaxInflight caps the unacknowledged QoS 1 deliveries per client, further deliveries are skipped
+var MaxInflight = 100
+
+// clientKey is the field holding the client id in records about a client
+const clientKey = "client"
+
+// Broker is a lightweight MQTT 3.1.1 broker in front of a message relayer
+type Broker interface {
+	Start(context.Context)
+	ServeConn(context.Context, net.Conn)
+	DoneChannel() chan bool
+	Stats() Stats
+	SetLogger(logging.Logger)
+}
+
+// Stats summarizes the traffic a broker has handled
+type Stats struct {
+	Published     int64 // client publishes enqueued to the relayer
+	Delivered     int64 // broadcasts delivered to subscribed clients
+	Acked         int64 // QoS 1 deliveries acknowledged by clients
+	Retransmitted int64 // QoS 1 deliveries resent after RetryInterval without a PUBACK
+	Skipped       int64 // QoS 1 deliveries skipped because a client had MaxInflight unacknowledged messages
+	Inflight      int64 // QoS 1 deliveries awaiting a PUBACK
+}
+
+// MessageBroker maps MQTT topics onto message types and routes everything through a message relayer
+type MessageBroker struct {
+	addr      string
+	relayer   relayer.Relayer
+	topics    map[string]constants.MessageType // topic name -> message type
+	names     []string                         // sorted topic names for deterministic delivery
+	mu        sync.Mutex
+	sessions  map[string]*session // client id -> connected session
+	stats     Stats
+	logger    logging.Logger
+	hotLogger logging.Logger // sampled logger for records written per published message
+	done      chan bool
+}
+
+// New returns a broker publishing to and subscribing from the provided relayer
+func New(addr string, msgRelayer relayer.Relayer, topics map[string]constants.MessageType) Broker {
+	names := make([]string, 0, len(topics))
+	for name := range topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &MessageBroker{
+		addr:      addr,
+		relayer:   msgRelayer,
+		topics:    topics,
+		names:     names,
+		sessions:  make(map[string]*session),
+		logger:    logging.Default(),
+		hotLogger: logging.Sampled(logging.Default()),
+		done:      make(chan bool),
+	}
+}
+
+// Start accepts client connections on the configured address until the context is cancelled
+func (b *MessageBroker) Start(ctx context.Context) {
+	listener, err := net.Listen("tcp", b.addr)
+	if err != nil {
+		b.logger.Error("mqtt broker unable to listen", "addr", b.addr, logging.ErrorKey, err)
+		<-ctx.Done()
+		b.done <- true
+		return
+	}
+	b.logger.Info("mqtt broker listening", "addr", b.addr)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.ServeConn(ctx, conn)
+		}
+	}()
+	<-ctx.Done()
+	b.logger.Info("closing mqtt broker", "addr", b.addr)
+	listener.Close()
+	b.mu.Lock()
+	for _, s := range b.sessions {
+		s.conn.Close()
+	}
+	b.mu.Unlock()
+	b.done <- true
+}
+
+// DoneChannel returns the brokers done channel so the parent process can wait until it completes to exit
+func (b *MessageBroker) DoneChannel() chan bool {
+	return b.done
+}
+
+// SetLogger replaces the logger of the broker, records written for every published message are sampled. It must
+// be called before Start.
+func (b *MessageBroker) SetLogger(logger logging.Logger) {
+	b.logger = logger
+	b.hotLogger = logging.Sampled(logger)
+}
+
+// Stats returns the traffic counters of the broker
+func (b *MessageBroker) Stats() Stats {
+	return Stats{
+		Published:     atomic.LoadInt64(&b.stats.Published),
+		Delivered:     atomic.LoadInt64(&b.stats.Delivered),
+		Acked:         atomic.LoadInt64(&b.stats.Acked),
+		Retransmitted: atomic.LoadInt64(&b.stats.Retransmitted),
+		Skipped:       atomic.LoadInt64(&b.stats.Skipped),
+		Inflight:      atomic.LoadInt64(&b.stats.Inflight),
+	}
+}
+
+// ServeConn handles a single client connection from CONNECT until it disconnects
+func (b *MessageBroker) ServeConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(ConnectTimeout))
+	p, err := readPacket(reader)
+	if err != nil || p.kind != packetConnect {
+		b.logger.Warn("mqtt client did not send CONNECT", "remote", conn.RemoteAddr().String(), logging.ErrorKey, err)
+		return
+	}
+	c, err := decodeConnect(p.body)
+	if err != nil {
+		return
+	}
+	if c.protocolName != "MQTT" || c.protocolLevel != protocolLevel311 {
+		conn.Write(encodePacket(packetConnack, 0, []byte{0, connackBadProtocolVersion}))
+		return
+	}
+	if c.clientID == "" {
+		if !c.cleanSession {
+			conn.Write(encodePacket(packetConnack, 0, []byte{0, connackIdentifierRejected}))
+			return
+		}
+		c.clientID = fmt.Sprintf("auto-%p", conn)
+	}
+	s := &session{
+		broker:    b,
+		conn:      conn,
+		clientID:  c.clientID,
+		keepAlive: time.Duration(c.keepAlive) * time.Second,
+		retry:     RetryInterval,
+		subs:      make(map[string]byte),
+		inflight:  make(map[uint16]*inflightMsg),
+		closed:    make(chan struct{}),
+	}
+	s.bridge = relayer.NewBridge(b.relayer, constants.All, ConnBufferSize, s.forward)
+	b.register(s)
+	defer b.unregister(s)
+	s.write(encodePacket(packetConnack, 0, []byte{0, connackAccepted}))
+	go s.retransmit()
+	s.serve(ctx, reader)
+}
+
+// register tracks the session, disconnecting an existing session with the same client id
+func (b *MessageBroker) register(s *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, ok := b.sessions[s.clientID]; ok {
+		b.logger.Info("mqtt client reconnected, closing previous session", clientKey, s.clientID)
+		existing.conn.Close()
+	}
+	b.sessions[s.clientID] = s
+}
+
+func (b *MessageBroker) unregister(s *session) {
+	s.close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sessions[s.clientID] == s {
+		delete(b.sessions, s.clientID)
+	}
+}
+
+// topicMatches reports whether an MQTT topic filter with + and # wildcards matches a topic name
+func topicMatches(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// validFilter reports whether wildcards in a topic filter occupy whole levels and # is last
+func validFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return false
+		}
+	}
+	return true
+}
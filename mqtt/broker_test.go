@@ -0,0 +1,177 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/mqtt"
+	"messagerelayer/relayer"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Exit(code)
+}
+
+var topics = map[string]constants.MessageType{
+	"round/start":  constants.StartNewRound,
+	"round/answer": constants.ReceivedAnswer,
+}
+
+// testClient hand encodes the handful of MQTT packets the tests need
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func str(s string) []byte {
+	out := make([]byte, 2)
+	binary.BigEndian.PutUint16(out, uint16(len(s)))
+	return append(out, s...)
+}
+
+func id(v uint16) []byte {
+	out := make([]byte, 2)
+	binary.BigEndian.PutUint16(out, v)
+	return out
+}
+
+func connect(t *testing.T, ctx context.Context, broker mqtt.Broker, clientID string) *testClient {
+	clientConn, serverConn := net.Pipe()
+	go broker.ServeConn(ctx, serverConn)
+	tc := &testClient{conn: clientConn, reader: bufio.NewReader(clientConn)}
+	body := append(str("MQTT"), 4, 0x02, 0, 60)
+	tc.send(1, 0, append(body, str(clientID)...))
+	kind, _, connack := tc.read()
+	assert.Equal(t, byte(2), kind, "connack")
+	assert.Equal(t, []byte{0, 0}, connack, "connection accepted")
+	return tc
+}
+
+func (tc *testClient) send(kind byte, flags byte, body []byte) {
+	tc.conn.Write(append([]byte{kind<<4 | flags, byte(len(body))}, body...))
+}
+
+func (tc *testClient) read() (byte, byte, []byte) {
+	tc.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header, err := tc.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil
+	}
+	length, _ := tc.reader.ReadByte()
+	body := make([]byte, length)
+	io.ReadFull(tc.reader, body)
+	return header >> 4, header & 0x0f, body
+}
+
+func (tc *testClient) subscribe(packetID uint16, filter string, qos byte) []byte {
+	tc.send(8, 0x02, append(append(id(packetID), str(filter)...), qos))
+	kind, _, suback := tc.read()
+	if kind != 9 {
+		return nil
+	}
+	return suback
+}
+
+func TestBrokerRejectsBadProtocolLevel(t *testing.T) {
+	broker := mqtt.New(":0", relayer.NewMessageRelayer(nil), topics)
+	clientConn, serverConn := net.Pipe()
+	go broker.ServeConn(context.Background(), serverConn)
+	tc := &testClient{conn: clientConn, reader: bufio.NewReader(clientConn)}
+	tc.send(1, 0, append(append(str("MQIsdp"), 3, 0x02, 0, 60), str("c")...))
+	kind, _, connack := tc.read()
+	assert.Equal(t, byte(2), kind, "connack")
+	assert.Equal(t, []byte{0, 1}, connack, "unacceptable protocol version")
+}
+
+func TestBrokerPublishAndSubscribe(t *testing.T) {
+	relayer.BroadcastInterval = 0 * time.Second
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	broker := mqtt.New(":0", msgrelayer, topics)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgrelayer.Start(ctx)
+
+	subscriber := connect(t, ctx, broker, "subscriber")
+	assert.Equal(t, append(id(1), 1), subscriber.subscribe(1, "round/+", 2), "qos downgraded to 1")
+	assert.Equal(t, append(id(2), 0x80), subscriber.subscribe(2, "round/#/bad", 0), "invalid filter rejected")
+
+	publisher := connect(t, ctx, broker, "publisher")
+	publisher.send(3, 0x02, append(append(str("round/start"), id(7)...), "go"...))
+	kind, _, puback := publisher.read()
+	assert.Equal(t, byte(4), kind, "puback")
+	assert.Equal(t, id(7), puback, "puback packet id")
+
+	kind, flags, body := subscriber.read()
+	assert.Equal(t, byte(3), kind, "publish delivered")
+	assert.Equal(t, byte(0x02), flags, "delivered at qos 1")
+	assert.Equal(t, str("round/start"), body[:13], "topic")
+	packetID := body[13:15]
+	assert.Equal(t, "go", string(body[15:]), "payload")
+	assert.Equal(t, int64(1), broker.Stats().Inflight, "awaiting puback")
+
+	subscriber.send(4, 0, packetID)
+	time.Sleep(50 * time.Millisecond) // artificial wait time to allow the puback to be processed
+	stats := broker.Stats()
+	assert.Equal(t, int64(1), stats.Published, "published count")
+	assert.Equal(t, int64(1), stats.Delivered, "delivered count")
+	assert.Equal(t, int64(1), stats.Acked, "acked count")
+	assert.Equal(t, int64(0), stats.Inflight, "nothing inflight")
+
+	subscriber.send(12, 0, nil)
+	kind, _, _ = subscriber.read()
+	assert.Equal(t, byte(13), kind, "pingresp")
+	cancel()
+	<-msgrelayer.DoneChannel()
+}
+
+func TestBrokerRetransmitsUnacknowledged(t *testing.T) {
+	relayer.BroadcastInterval = 0 * time.Second
+	mqtt.RetryInterval = 100 * time.Millisecond
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	broker := mqtt.New(":0", msgrelayer, topics)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgrelayer.Start(ctx)
+
+	subscriber := connect(t, ctx, broker, "subscriber")
+	subscriber.subscribe(1, "round/answer", 1)
+	msgrelayer.Enqueue(constants.Message{Type: constants.ReceivedAnswer, Data: []byte("42")})
+	_, flags, first := subscriber.read()
+	assert.Equal(t, byte(0x02), flags, "first delivery")
+	_, flags, second := subscriber.read()
+	assert.Equal(t, byte(0x0a), flags, "retransmitted with dup flag")
+	assert.Equal(t, first, second, "same packet id and payload")
+	time.Sleep(50 * time.Millisecond) // artificial wait time to allow the retransmission to be counted
+	assert.GreaterOrEqual(t, broker.Stats().Retransmitted, int64(1), "retransmitted count")
+	cancel()
+	<-msgrelayer.DoneChannel()
+}
+
+func TestBrokerSamplesPerMessageLogs(t *testing.T) {
+	var logs bytes.Buffer
+	broker := mqtt.New(":0", relayer.NewMessageRelayer(nil), topics)
+	broker.SetLogger(logging.New(&logs, slog.LevelInfo, logging.Text))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := connect(t, ctx, broker, "sampled")
+	for i := 0; i < 3*logging.SampleFirst; i++ {
+		c.send(3, 0, append(str("round/bogus"), "a"...))
+	}
+	c.send(12, 0, nil)
+	kind, _, _ := c.read()
+	assert.Equal(t, byte(13), kind, "pingresp once every publish was handled")
+	dropped := strings.Count(logs.String(), "mqtt client published to unmapped topic, dropping")
+	assert.Equal(t, logging.SampleFirst, dropped, "drops are logged through the sampled logger")
+	assert.Contains(t, logs.String(), "client=sampled", "records carry the client id")
+}
@@ -0,0 +1,266 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// control packet types from the MQTT 3.1.1 specification
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+)
+
+// return codes and protocol limits
+const (
+	connackAccepted           byte = 0
+	connackBadProtocolVersion byte = 1
+	connackIdentifierRejected byte = 2
+	subackFailure             byte = 0x80
+	protocolLevel311          byte = 4
+	maxRemainingLengthBytes        = 4
+)
+
+// MaxPacketSize is the largest packet the broker will accept from a client
+var MaxPacketSize = 1 << 20
+
+var errMalformedPacket = errors.New("malformed packet")
+
+var errUnsupportedQoS = errors.New("QoS 2 is not supported")
+
+// packet is a decoded control packet
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length, err := readRemainingLength(r)
+	if err != nil {
+		return packet{}, err
+	}
+	if length > MaxPacketSize {
+		return packet{}, fmt.Errorf("packet of %d bytes exceeds max packet size", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+func readRemainingLength(r *bufio.Reader) (int, error) {
+	length := 0
+	multiplier := 1
+	for i := 0; i < maxRemainingLengthBytes; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return length, nil
+		}
+		multiplier *= 128
+	}
+	return 0, errMalformedPacket
+}
+
+func encodePacket(kind byte, flags byte, body []byte) []byte {
+	out := []byte{kind<<4 | flags}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+// decoder reads the variable header and payload fields of a packet body
+type decoder struct {
+	body []byte
+	err  error
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.body) < 2 {
+		d.err = errMalformedPacket
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.body)
+	d.body = d.body[2:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.body) < 1 {
+		d.err = errMalformedPacket
+		return 0
+	}
+	v := d.body[0]
+	d.body = d.body[1:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	size := int(d.uint16())
+	if d.err != nil || len(d.body) < size {
+		d.err = errMalformedPacket
+		return nil
+	}
+	v := d.body[:size]
+	d.body = d.body[size:]
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func encodeString(s string) []byte {
+	out := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(out, uint16(len(s)))
+	return append(out, s...)
+}
+
+func encodeUint16(v uint16) []byte {
+	out := make([]byte, 2)
+	binary.BigEndian.PutUint16(out, v)
+	return out
+}
+
+// connect holds the fields of a CONNECT packet the broker uses
+type connect struct {
+	protocolName  string
+	protocolLevel byte
+	cleanSession  bool
+	keepAlive     uint16
+	clientID      string
+}
+
+func decodeConnect(body []byte) (connect, error) {
+	d := &decoder{body: body}
+	c := connect{}
+	c.protocolName = d.string()
+	c.protocolLevel = d.byte()
+	flags := d.byte()
+	c.keepAlive = d.uint16()
+	c.cleanSession = flags&0x02 != 0
+	c.clientID = d.string()
+	if flags&0x04 != 0 { // will topic and message
+		d.string()
+		d.bytes()
+	}
+	if flags&0x80 != 0 { // username
+		d.string()
+	}
+	if flags&0x40 != 0 { // password
+		d.bytes()
+	}
+	return c, d.err
+}
+
+// publish holds the fields of a PUBLISH packet
+type publish struct {
+	topic    string
+	qos      byte
+	dup      bool
+	retain   bool
+	packetID uint16
+	payload  []byte
+}
+
+func decodePublish(flags byte, body []byte) (publish, error) {
+	d := &decoder{body: body}
+	p := publish{
+		dup:    flags&0x08 != 0,
+		qos:    (flags >> 1) & 0x03,
+		retain: flags&0x01 != 0,
+	}
+	p.topic = d.string()
+	if p.qos > 0 {
+		p.packetID = d.uint16()
+	}
+	if d.err != nil {
+		return publish{}, d.err
+	}
+	p.payload = d.body
+	return p, nil
+}
+
+func encodePublish(p publish) []byte {
+	flags := p.qos << 1
+	if p.dup {
+		flags |= 0x08
+	}
+	body := encodeString(p.topic)
+	if p.qos > 0 {
+		body = append(body, encodeUint16(p.packetID)...)
+	}
+	body = append(body, p.payload...)
+	return encodePacket(packetPublish, flags, body)
+}
+
+// subscription is a topic filter and the maximum QoS requested for it
+type subscription struct {
+	filter string
+	qos    byte
+}
+
+func decodeSubscribe(body []byte) (uint16, []subscription, error) {
+	d := &decoder{body: body}
+	packetID := d.uint16()
+	var subs []subscription
+	for d.err == nil && len(d.body) > 0 {
+		filter := d.string()
+		qos := d.byte()
+		subs = append(subs, subscription{filter: filter, qos: qos})
+	}
+	if d.err == nil && len(subs) == 0 {
+		d.err = errMalformedPacket
+	}
+	return packetID, subs, d.err
+}
+
+func decodeUnsubscribe(body []byte) (uint16, []string, error) {
+	d := &decoder{body: body}
+	packetID := d.uint16()
+	var filters []string
+	for d.err == nil && len(d.body) > 0 {
+		filters = append(filters, d.string())
+	}
+	if d.err == nil && len(filters) == 0 {
+		d.err = errMalformedPacket
+	}
+	return packetID, filters, d.err
+}
+
+func decodePacketID(body []byte) (uint16, error) {
+	d := &decoder{body: body}
+	id := d.uint16()
+	return id, d.err
+}
@@ -0,0 +1,274 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/relayer"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// session is the state of a single connected client
+type session struct {
+	broker    *MessageBroker
+	conn      net.Conn
+	clientID  string
+	keepAlive time.Duration
+	retry     time.Duration // RetryInterval when the session connected
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	subs      map[string]byte // topic filter -> granted qos
+	bridge    *relayer.Bridge // subscribed while the session has subscriptions
+	nextID    uint16
+	inflight  map[uint16]*inflightMsg // packet id -> unacknowledged QoS 1 delivery
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// inflightMsg is a QoS 1 delivery awaiting a PUBACK
+type inflightMsg struct {
+	publish publish
+	sentAt  time.Time
+}
+
+func (s *session) write(packet []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err := s.conn.Write(packet)
+	return err
+}
+
+func (s *session) serve(ctx context.Context, reader *bufio.Reader) {
+	for ctx.Err() == nil {
+		if s.keepAlive > 0 {
+			// the spec allows one and a half keep alive periods of silence before disconnecting
+			s.conn.SetReadDeadline(time.Now().Add(s.keepAlive * 3 / 2))
+		} else {
+			s.conn.SetReadDeadline(time.Time{})
+		}
+		p, err := readPacket(reader)
+		if err != nil {
+			if err != io.EOF {
+				s.broker.logger.Warn("mqtt client disconnected", clientKey, s.clientID, logging.ErrorKey, err)
+			}
+			return
+		}
+		switch p.kind {
+		case packetPublish:
+			if err := s.handlePublish(p); err != nil {
+				s.broker.logger.Warn("mqtt client sent invalid publish", clientKey, s.clientID, logging.ErrorKey, err)
+				return
+			}
+		case packetPuback:
+			s.handlePuback(p)
+		case packetSubscribe:
+			if err := s.handleSubscribe(p); err != nil {
+				s.broker.logger.Warn("mqtt client sent invalid subscribe", clientKey, s.clientID, logging.ErrorKey, err)
+				return
+			}
+		case packetUnsubscribe:
+			if err := s.handleUnsubscribe(p); err != nil {
+				s.broker.logger.Warn("mqtt client sent invalid unsubscribe", clientKey, s.clientID, logging.ErrorKey, err)
+				return
+			}
+		case packetPingreq:
+			s.write(encodePacket(packetPingresp, 0, nil))
+		case packetDisconnect:
+			return
+		default:
+			s.broker.logger.Warn("mqtt client sent unsupported packet type", clientKey, s.clientID, "packet_type", p.kind)
+			return
+		}
+	}
+}
+
+func (s *session) handlePublish(p packet) error {
+	pub, err := decodePublish(p.flags, p.body)
+	if err != nil {
+		return err
+	}
+	if pub.qos > 1 {
+		return errUnsupportedQoS
+	}
+	msgType, ok := s.broker.topics[pub.topic]
+	if !ok {
+		s.broker.hotLogger.Warn("mqtt client published to unmapped topic, dropping", clientKey, s.clientID, logging.TopicKey, pub.topic)
+	} else {
+		if s.broker.relayer.Saturated(msgType) {
+			// withholding the PUBACK leaves the message with the client to redeliver
+			s.broker.hotLogger.Warn("mqtt client published to saturated queue, dropping", clientKey, s.clientID, logging.TypeKey, msgType)
+			return nil
+		}
+		s.broker.relayer.Enqueue(constants.Message{Type: msgType, Data: pub.payload})
+		atomic.AddInt64(&s.broker.stats.Published, 1)
+	}
+	if pub.qos == 1 {
+		return s.write(encodePacket(packetPuback, 0, encodeUint16(pub.packetID)))
+	}
+	return nil
+}
+
+func (s *session) handlePuback(p packet) {
+	id, err := decodePacketID(p.body)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.inflight[id]; ok {
+		delete(s.inflight, id)
+		atomic.AddInt64(&s.broker.stats.Acked, 1)
+		atomic.AddInt64(&s.broker.stats.Inflight, -1)
+	}
+}
+
+func (s *session) handleSubscribe(p packet) error {
+	if p.flags != 0x02 {
+		return errMalformedPacket
+	}
+	packetID, subs, err := decodeSubscribe(p.body)
+	if err != nil {
+		return err
+	}
+	body := encodeUint16(packetID)
+	s.mu.Lock()
+	for _, sub := range subs {
+		if !validFilter(sub.filter) || sub.qos > 2 {
+			body = append(body, subackFailure)
+			continue
+		}
+		granted := sub.qos
+		if granted > 1 {
+			granted = 1
+		}
+		s.subs[sub.filter] = granted
+		body = append(body, granted)
+	}
+	if len(s.subs) > 0 {
+		s.bridge.Subscribe()
+	}
+	s.mu.Unlock()
+	return s.write(encodePacket(packetSuback, 0, body))
+}
+
+func (s *session) handleUnsubscribe(p packet) error {
+	if p.flags != 0x02 {
+		return errMalformedPacket
+	}
+	packetID, filters, err := decodeUnsubscribe(p.body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for _, filter := range filters {
+		delete(s.subs, filter)
+	}
+	empty := len(s.subs) == 0
+	s.mu.Unlock()
+	if empty {
+		s.bridge.Unsubscribe()
+	}
+	return s.write(encodePacket(packetUnsuback, 0, encodeUint16(packetID)))
+}
+
+// forward publishes a broadcast on every mapped topic of its type matching one of the sessions filters
+func (s *session) forward(msg constants.Message) {
+	for _, pub := range s.deliveries(msg) {
+		if err := s.write(encodePublish(pub)); err == nil {
+			atomic.AddInt64(&s.broker.stats.Delivered, 1)
+		}
+	}
+}
+
+func (s *session) deliveries(msg constants.Message) []publish {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pubs []publish
+	for _, topic := range s.broker.names {
+		if !relayer.Covers(s.broker.topics[topic], msg.Type) {
+			continue
+		}
+		qos, matched := byte(0), false
+		for filter, granted := range s.subs {
+			if topicMatches(filter, topic) {
+				matched = true
+				if granted > qos {
+					qos = granted
+				}
+			}
+		}
+		if !matched {
+			continue
+		}
+		pub := publish{topic: topic, qos: qos, payload: msg.Data}
+		if qos == 1 {
+			if len(s.inflight) >= MaxInflight {
+				atomic.AddInt64(&s.broker.stats.Skipped, 1)
+				continue
+			}
+			pub.packetID = s.nextPacketID()
+			s.inflight[pub.packetID] = &inflightMsg{publish: pub, sentAt: time.Now()}
+			atomic.AddInt64(&s.broker.stats.Inflight, 1)
+		}
+		pubs = append(pubs, pub)
+	}
+	return pubs
+}
+
+// nextPacketID returns an unused non-zero packet id, s.mu must be held
+func (s *session) nextPacketID() uint16 {
+	for {
+		s.nextID++
+		if s.nextID == 0 {
+			continue
+		}
+		if _, used := s.inflight[s.nextID]; !used {
+			return s.nextID
+		}
+	}
+}
+
+// retransmit resends QoS 1 deliveries that have not been acknowledged within the session's retry interval
+func (s *session) retransmit() {
+	ticker := time.NewTicker(s.retry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			var resend []publish
+			s.mu.Lock()
+			for _, msg := range s.inflight {
+				if time.Since(msg.sentAt) >= s.retry {
+					msg.publish.dup = true
+					msg.sentAt = time.Now()
+					resend = append(resend, msg.publish)
+				}
+			}
+			s.mu.Unlock()
+			for _, pub := range resend {
+				if s.write(encodePublish(pub)) == nil {
+					atomic.AddInt64(&s.broker.stats.Retransmitted, 1)
+				}
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// close releases the sessions relayer subscriptions and drops its unacknowledged deliveries
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.bridge.Unsubscribe()
+		s.mu.Lock()
+		atomic.AddInt64(&s.broker.stats.Inflight, -int64(len(s.inflight)))
+		s.inflight = make(map[uint16]*inflightMsg)
+		s.mu.Unlock()
+	})
+}
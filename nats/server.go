@@ -0,0 +1,531 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/relayer"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MaxPayload is the largest message payload a client may publish, advertised in INFO
+var MaxPayload = 1 << 20
+
+// MaxControlLine is the longest protocol line a client may send, payloads excluded
+var MaxControlLine = 4096
+
+// ConnBufferSize is the number of outbound protocol lines buffered per client before it is treated as a slow consumer
+var ConnBufferSize = 100
+
+// FlushTimeout bounds how long a closing connection may take to write its remaining protocol lines
+var FlushTimeout = 1 * time.Second
+
+// RelayerBufferSize is the number of broadcasts buffered from the relayer before it skips the facade
+var RelayerBufferSize = 100
+
+// Server speaks the core NATS text protocol in front of a message relayer
+type Server interface {
+	Start(context.Context)
+	ServeConn(context.Context, net.Conn)
+	DoneChannel() chan bool
+	SlowConsumerDrops() int64
+	SetLogger(logging.Logger)
+}
+
+// NATSServer maps NATS subjects onto message types, delivering broadcasts to every plain subscription and to one
+// member of each queue group. Queue subscriptions join a relayer subscriber group per subject filter and queue
+// name, so the relayer picks the member.
+type NATSServer struct {
+	addr         string
+	relayer      relayer.Relayer
+	subjects     map[string]constants.MessageType // subject -> message type
+	names        []string                         // sorted subjects for deterministic delivery
+	mu           sync.Mutex
+	clients      map[*client]bool
+	bridge       *relayer.Bridge // shared by the plain subscriptions
+	nextClientID uint64
+	slowDrops    int64
+	logger       logging.Logger
+	done         chan bool
+}
+
+// New returns a NATS facade publishing to and subscribing from the provided relayer
+func New(addr string, msgRelayer relayer.Relayer, subjects map[string]constants.MessageType) Server {
+	names := make([]string, 0, len(subjects))
+	for name := range subjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s := &NATSServer{
+		addr:     addr,
+		relayer:  msgRelayer,
+		subjects: subjects,
+		names:    names,
+		clients:  make(map[*client]bool),
+		logger:   logging.Default(),
+		done:     make(chan bool),
+	}
+	s.bridge = relayer.NewBridge(msgRelayer, constants.All, RelayerBufferSize, s.deliver)
+	return s
+}
+
+// Start accepts client connections on the configured address until the context is cancelled
+func (s *NATSServer) Start(ctx context.Context) {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.logger.Error("nats server unable to listen", "addr", s.addr, logging.ErrorKey, err)
+		<-ctx.Done()
+		s.done <- true
+		return
+	}
+	s.logger.Info("nats server listening", "addr", s.addr)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.ServeConn(ctx, conn)
+		}
+	}()
+	<-ctx.Done()
+	s.logger.Info("closing nats server", "addr", s.addr)
+	listener.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.done <- true
+}
+
+// DoneChannel returns the servers done channel so the parent process can wait until it completes to exit
+func (s *NATSServer) DoneChannel() chan bool {
+	return s.done
+}
+
+// SetLogger replaces the logger of the nats server, it must be called before Start
+func (s *NATSServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+// SlowConsumerDrops returns the number of messages dropped because a client could not keep up
+func (s *NATSServer) SlowConsumerDrops() int64 {
+	return atomic.LoadInt64(&s.slowDrops)
+}
+
+// ServeConn handles protocol operations from a single client until it disconnects
+func (s *NATSServer) ServeConn(ctx context.Context, conn net.Conn) {
+	s.mu.Lock()
+	s.nextClientID++
+	c := &client{
+		id:      s.nextClientID,
+		server:  s,
+		conn:    conn,
+		subs:    make(map[string]*subscription),
+		out:     make(chan []byte, ConnBufferSize),
+		closed:  make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	s.clients[c] = true
+	s.mu.Unlock()
+	go c.writeLoop()
+	defer s.disconnect(c)
+
+	info, _ := json.Marshal(map[string]interface{}{
+		"server_id":   "messagerelayer",
+		"version":     "2.0.0",
+		"proto":       1,
+		"max_payload": MaxPayload,
+		"client_id":   c.id,
+		"headers":     false,
+	})
+	c.send([]byte("INFO " + string(info) + "\r\n"))
+	reader := bufio.NewReader(conn)
+	for ctx.Err() == nil {
+		line, err := readControlLine(reader)
+		if _, fatal := err.(fatalError); fatal {
+			c.send([]byte("-ERR '" + err.Error() + "'\r\n"))
+			return
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Warn("nats client disconnected", "client", c.id, logging.ErrorKey, err)
+			}
+			return
+		}
+		if err := c.handle(line, reader); err != nil {
+			c.send([]byte("-ERR '" + err.Error() + "'\r\n"))
+			if _, fatal := err.(fatalError); fatal {
+				return
+			}
+		}
+	}
+}
+
+// readControlLine reads a protocol line of at most MaxControlLine bytes without its line ending
+func readControlLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > MaxControlLine {
+			return "", fatalError{"Maximum Control Line Exceeded"}
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+func (s *NATSServer) disconnect(c *client) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	subs := c.subs
+	c.subs = map[string]*subscription{}
+	s.mu.Unlock()
+	for _, sub := range subs {
+		s.leave(sub)
+	}
+	close(c.closed)
+	<-c.flushed
+	c.conn.Close()
+	s.syncRelayerSubscription()
+}
+
+// syncRelayerSubscription registers the facade with the relayer while any client has a plain subscription
+func (s *NATSServer) syncRelayerSubscription() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscribed := false
+	for c := range s.clients {
+		for _, sub := range c.subs {
+			if sub.queue == "" {
+				subscribed = true
+				break
+			}
+		}
+	}
+	if subscribed {
+		s.bridge.Subscribe()
+	} else {
+		s.bridge.Unsubscribe()
+	}
+}
+
+// deliver sends a broadcast on every subject covering its type to each matching plain subscription
+func (s *NATSServer) deliver(msg constants.Message) {
+	s.mu.Lock()
+	var expired []*subscription
+	for _, subject := range s.names {
+		if !relayer.Covers(s.subjects[subject], msg.Type) {
+			continue
+		}
+		for c := range s.clients {
+			for _, sub := range c.subs {
+				if sub.queue == "" && subjectMatches(sub.subject, subject) && sub.deliver(subject, msg.Data) {
+					expired = append(expired, sub)
+				}
+			}
+		}
+	}
+	for _, sub := range expired {
+		delete(sub.client.subs, sub.sid)
+	}
+	s.mu.Unlock()
+	if len(expired) > 0 {
+		s.syncRelayerSubscription()
+	}
+}
+
+// join subscribes a queue subscription to the relayer, as a member of the group every subscription with the same
+// subject filter and queue name belongs to, for the message types the subjects matching its filter are mapped to.
+// s.mu must be held so it does not deliver, and possibly leave, before it joined.
+func (s *NATSServer) join(sub *subscription) {
+	covered := make(map[constants.MessageType]bool)
+	for _, subject := range s.names {
+		if !subjectMatches(sub.subject, subject) {
+			continue
+		}
+		for _, msgType := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer} {
+			covered[msgType] = covered[msgType] || relayer.Covers(s.subjects[subject], msgType)
+		}
+	}
+	msgType := constants.All
+	switch {
+	case !covered[constants.StartNewRound] && !covered[constants.ReceivedAnswer]:
+		return // no subject matches the filter, there is nothing to receive
+	case !covered[constants.StartNewRound]:
+		msgType = constants.ReceivedAnswer
+	case !covered[constants.ReceivedAnswer]:
+		msgType = constants.StartNewRound
+	}
+	group := relayer.InGroup("nats "+sub.subject+" "+sub.queue, relayer.RoundRobin)
+	sub.bridge = relayer.NewBridge(s.relayer, msgType, RelayerBufferSize, func(msg constants.Message) {
+		s.deliverToMember(sub, msg)
+	}, group)
+	sub.bridge.Subscribe()
+}
+
+// leave unsubscribes a queue subscription from the relayer, it must be called once the subscription was removed
+func (s *NATSServer) leave(sub *subscription) {
+	if sub.bridge != nil {
+		sub.bridge.Unsubscribe()
+	}
+}
+
+// deliverToMember sends a broadcast the relayer picked a queue subscription for on every subject covering its type
+// that matches the subscription
+func (s *NATSServer) deliverToMember(sub *subscription, msg constants.Message) {
+	s.mu.Lock()
+	if sub.client.subs[sub.sid] != sub {
+		s.mu.Unlock()
+		return // removed while the broadcast was buffered
+	}
+	expired := false
+	for _, subject := range s.names {
+		if !expired && relayer.Covers(s.subjects[subject], msg.Type) && subjectMatches(sub.subject, subject) {
+			expired = sub.deliver(subject, msg.Data)
+		}
+	}
+	if expired {
+		delete(sub.client.subs, sub.sid)
+	}
+	s.mu.Unlock()
+	if expired {
+		s.leave(sub)
+	}
+}
+
+// subjectMatches reports whether a subscription subject with * and > wildcards matches a published subject
+func subjectMatches(filter string, subject string) bool {
+	filterTokens := strings.Split(filter, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(filterTokens) == len(subjectTokens)
+}
+
+// fatalError is a protocol error after which the connection is closed
+type fatalError struct {
+	msg string
+}
+
+func (e fatalError) Error() string {
+	return e.msg
+}
+
+// protocolError is a recoverable error reported to the client
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// client is a single connected NATS client
+type client struct {
+	id      uint64
+	server  *NATSServer
+	conn    net.Conn
+	verbose bool
+	subs    map[string]*subscription // sid -> subscription, guarded by server.mu
+	out     chan []byte
+	closed  chan struct{}
+	flushed chan struct{}
+}
+
+// subscription is a SUB registered by a client
+type subscription struct {
+	client    *client
+	sid       string
+	subject   string
+	queue     string
+	max       int // deliveries after which the subscription is removed, 0 for unlimited
+	delivered int
+	bridge    *relayer.Bridge // relayer group membership of a queue subscription, nil for plain ones
+}
+
+// deliver queues a MSG for the subscriber and reports whether the subscription reached its max, server.mu must be held
+func (sub *subscription) deliver(subject string, payload []byte) bool {
+	line := fmt.Sprintf("MSG %v %v %d\r\n", subject, sub.sid, len(payload))
+	sub.client.send(append(append([]byte(line), payload...), '\r', '\n'))
+	sub.delivered++
+	return sub.max > 0 && sub.delivered >= sub.max
+}
+
+// send queues a protocol line for the client, dropping it if the client is not keeping up
+func (c *client) send(line []byte) {
+	select {
+	case c.out <- line:
+	default:
+		atomic.AddInt64(&c.server.slowDrops, 1)
+	}
+}
+
+func (c *client) writeLoop() {
+	for {
+		select {
+		case line := <-c.out:
+			if _, err := c.conn.Write(line); err != nil {
+				<-c.closed
+				close(c.flushed)
+				return
+			}
+		case <-c.closed:
+			// flush what is already queued, such as a final -ERR, before the connection is closed
+			c.conn.SetWriteDeadline(time.Now().Add(FlushTimeout))
+			for {
+				select {
+				case line := <-c.out:
+					if _, err := c.conn.Write(line); err != nil {
+						close(c.flushed)
+						return
+					}
+				default:
+					close(c.flushed)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *client) ok() {
+	if c.verbose {
+		c.send([]byte("+OK\r\n"))
+	}
+}
+
+func (c *client) handle(line string, reader *bufio.Reader) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "CONNECT":
+		var opts struct {
+			Verbose bool `json:"verbose"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[len(fields[0]):])), &opts); err != nil {
+			return fatalError{"Invalid Connect Options"}
+		}
+		c.verbose = opts.Verbose
+		c.ok()
+	case "PING":
+		c.send([]byte("PONG\r\n"))
+	case "PONG":
+	case "PUB":
+		return c.publish(fields[1:], reader)
+	case "SUB":
+		return c.subscribe(fields[1:])
+	case "UNSUB":
+		return c.unsubscribe(fields[1:])
+	default:
+		return fatalError{"Unknown Protocol Operation"}
+	}
+	return nil
+}
+
+func (c *client) publish(args []string, reader *bufio.Reader) error {
+	if len(args) != 2 && len(args) != 3 {
+		return fatalError{"Invalid Publish Arguments"}
+	}
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || size < 0 {
+		return fatalError{"Invalid Publish Arguments"}
+	}
+	if size > MaxPayload {
+		return fatalError{"Maximum Payload Violation"}
+	}
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return fatalError{"Invalid Publish Payload"}
+	}
+	msgType, ok := c.server.subjects[args[0]]
+	if !ok {
+		// like NATS, publishing to a subject nobody listens on is not an error
+		c.ok()
+		return nil
+	}
+	if c.server.relayer.Saturated(msgType) {
+		return protocolError("Queue Saturated")
+	}
+	c.server.relayer.Enqueue(constants.Message{Type: msgType, Data: payload[:size]})
+	c.ok()
+	return nil
+}
+
+func (c *client) subscribe(args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return protocolError("Invalid Subscription Arguments")
+	}
+	sub := &subscription{client: c, subject: args[0], sid: args[len(args)-1]}
+	if len(args) == 3 {
+		sub.queue = args[1]
+	}
+	c.server.mu.Lock()
+	previous := c.subs[sub.sid]
+	c.subs[sub.sid] = sub
+	if sub.queue != "" {
+		c.server.join(sub)
+	}
+	c.server.mu.Unlock()
+	if previous != nil {
+		c.server.leave(previous)
+	}
+	c.server.syncRelayerSubscription()
+	c.ok()
+	return nil
+}
+
+func (c *client) unsubscribe(args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return protocolError("Invalid Unsubscribe Arguments")
+	}
+	c.server.mu.Lock()
+	sub, ok := c.subs[args[0]]
+	if ok && len(args) == 2 {
+		limit, err := strconv.Atoi(args[1])
+		if err != nil || limit < 0 {
+			c.server.mu.Unlock()
+			return protocolError("Invalid Unsubscribe Arguments")
+		}
+		sub.max = limit
+		if sub.delivered < limit {
+			ok = false // keep the subscription until it has received max messages
+		}
+	}
+	if ok {
+		delete(c.subs, args[0])
+	}
+	c.server.mu.Unlock()
+	if ok {
+		c.server.leave(sub)
+	}
+	c.server.syncRelayerSubscription()
+	c.ok()
+	return nil
+}
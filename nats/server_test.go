@@ -0,0 +1,158 @@
+package nats_test
+
+import (
+	"bufio"
+	"context"
+	"messagerelayer/constants"
+	"messagerelayer/nats"
+	"messagerelayer/relayer"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Exit(code)
+}
+
+var subjects = map[string]constants.MessageType{
+	"round.start":  constants.StartNewRound,
+	"round.answer": constants.ReceivedAnswer,
+}
+
+// testClient speaks the NATS text protocol over an in-memory connection
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func connect(t *testing.T, ctx context.Context, server nats.Server) *testClient {
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(ctx, serverConn)
+	tc := &testClient{conn: clientConn, reader: bufio.NewReader(clientConn)}
+	assert.True(t, strings.HasPrefix(tc.read(), "INFO "), "server sends INFO")
+	tc.send(`CONNECT {"verbose":true}`)
+	assert.Equal(t, "+OK", tc.read())
+	return tc
+}
+
+func (tc *testClient) send(line string) {
+	tc.conn.Write([]byte(line + "\r\n"))
+}
+
+func (tc *testClient) read() string {
+	tc.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := tc.reader.ReadString('\n')
+	if err != nil {
+		return "read error: " + err.Error()
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func TestPingPublishAndErrors(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := nats.New(":0", msgrelayer, subjects)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := connect(t, ctx, server)
+	c.send("PING")
+	assert.Equal(t, "PONG", c.read())
+	c.send("PUB round.start 5\r\nhello")
+	assert.Equal(t, "+OK", c.read())
+	c.send("PUB round.bogus 5\r\nhello")
+	assert.Equal(t, "+OK", c.read(), "publishing to an unmapped subject is accepted")
+	assert.Equal(t, 1, msgrelayer.Summary().QueuedMsgs, "message to an unmapped subject is dropped")
+	c.send("BOGUS")
+	assert.Equal(t, "-ERR 'Unknown Protocol Operation'", c.read())
+}
+
+func TestEnforcesProtocolLimits(t *testing.T) {
+	defer func(line int, payload int) { nats.MaxControlLine, nats.MaxPayload = line, payload }(nats.MaxControlLine, nats.MaxPayload)
+	nats.MaxControlLine = 64
+	nats.MaxPayload = 8
+	server := nats.New(":0", relayer.NewMessageRelayer(nil), subjects)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := connect(t, ctx, server)
+	go c.send("SUB " + strings.Repeat("a", 100) + " 1")
+	assert.Equal(t, "-ERR 'Maximum Control Line Exceeded'", c.read())
+	assert.True(t, strings.HasPrefix(c.read(), "read error"), "the connection is closed")
+	c = connect(t, ctx, server)
+	go c.send("PUB round.start 9\r\n123456789")
+	assert.Equal(t, "-ERR 'Maximum Payload Violation'", c.read())
+	assert.True(t, strings.HasPrefix(c.read(), "read error"), "the connection is closed")
+}
+
+func TestSubscribeWithWildcardsAndQueueGroups(t *testing.T) {
+	relayer.BroadcastInterval = 0 * time.Second
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := nats.New(":0", msgrelayer, subjects)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgrelayer.Start(ctx)
+
+	watcher := connect(t, ctx, server)
+	watcher.send("SUB round.> 1")
+	assert.Equal(t, "+OK", watcher.read())
+	workerA := connect(t, ctx, server)
+	workerA.send("SUB round.start workers 1")
+	assert.Equal(t, "+OK", workerA.read())
+	workerB := connect(t, ctx, server)
+	workerB.send("SUB round.* workers 7")
+	assert.Equal(t, "+OK", workerB.read())
+
+	publisher := connect(t, ctx, server)
+	publisher.send("PUB round.start 2\r\ngo")
+	assert.Equal(t, "+OK", publisher.read())
+	assert.Equal(t, "MSG round.start 1 2", watcher.read())
+	assert.Equal(t, "go", watcher.read())
+	// workers subscribed with different subjects form separate groups, both receive it
+	assert.Equal(t, "MSG round.start 1 2", workerA.read())
+	assert.Equal(t, "go", workerA.read())
+	assert.Equal(t, "MSG round.start 7 2", workerB.read())
+	assert.Equal(t, "go", workerB.read())
+	cancel()
+	<-msgrelayer.DoneChannel()
+}
+
+func TestQueueGroupDeliversToOneMember(t *testing.T) {
+	relayer.BroadcastInterval = 0 * time.Second
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := nats.New(":0", msgrelayer, subjects)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgrelayer.Start(ctx)
+
+	workers := []*testClient{connect(t, ctx, server), connect(t, ctx, server)}
+	for _, w := range workers {
+		w.send("SUB round.answer workers 1")
+		assert.Equal(t, "+OK", w.read())
+	}
+	groups := []string{}
+	for _, info := range msgrelayer.Subscribers() {
+		groups = append(groups, info.Group)
+	}
+	assert.Equal(t, []string{"nats round.answer workers", "nats round.answer workers"}, groups, "members join a relayer group")
+	publisher := connect(t, ctx, server)
+	for _, payload := range []string{"a", "b"} {
+		publisher.send("PUB round.answer 1\r\n" + payload)
+		assert.Equal(t, "+OK", publisher.read())
+		time.Sleep(50 * time.Millisecond) // artificial wait time to keep deliveries ordered
+	}
+	// round robin hands each worker exactly one of the two messages
+	received := []string{}
+	for _, w := range workers {
+		assert.Equal(t, "MSG round.answer 1 1", w.read())
+		received = append(received, w.read())
+	}
+	assert.ElementsMatch(t, []string{"a", "b"}, received)
+
+	workers[0].send("UNSUB 1")
+	assert.Equal(t, "+OK", workers[0].read())
+	assert.Equal(t, 1, len(msgrelayer.Subscribers()), "unsubscribed member leaves the relayer group")
+	cancel()
+	<-msgrelayer.DoneChannel()
+}
@@ -2,55 +2,204 @@ package poller
 
 import (
 	"context"
-	"log"
+	"math"
+	"messagerelayer/health"
+	"messagerelayer/logging"
+	"messagerelayer/metrics"
 	"messagerelayer/relayer"
+	"sync/atomic"
 	"time"
 )
 
+// BatchSize is how many messages an adaptive poller reads back to back before waiting again
+var BatchSize = 100
+
+// MaxBackoff caps how long an adaptive poller waits between reads while the socket is idle or erroring, it has to
+// stay below the poller's liveness window since the heartbeat is beaten on every read
+var MaxBackoff = 10 * time.Second
+
 // Poller describes something that polls for new messages and sends them to a message relayer
 type Poller interface {
 	Start(context.Context, relayer.Relayer)
 	DoneChannel() chan bool
+	Collect() []metrics.Family
+	Heartbeat() *health.Heartbeat
+	SetLogger(logging.Logger)
+	Rate() float64
+	Interval() time.Duration
 }
 
-// MessagePoller is a poller that enqueues messages to a message relayer
+// MessagePoller is a poller that enqueues messages to a message relayer, reading one message every readInterval or,
+// when adaptive, in batches as fast as messages arrive and backing off while none do
 type MessagePoller struct {
 	done         chan bool
 	readInterval time.Duration
+	adaptive     bool
+	interval     atomic.Int64  // current wait between reads in nanoseconds
+	rate         atomic.Uint64 // float64 bits of the messages read per second over the last wait and read
+	polls        atomic.Int64
+	errors       atomic.Int64
+	latency      *metrics.HistogramValue
+	heartbeat    *health.Heartbeat // beaten on every tick or batch
+	logger       logging.Logger
+	hotLogger    logging.Logger // sampled logger for records written per read
 }
 
 // New returns an instance of a MessagePoller
 func New(readInterval time.Duration) Poller {
-	return MessagePoller{
+	mp := &MessagePoller{
 		readInterval: readInterval,
 		done:         make(chan bool),
+		latency:      metrics.NewHistogram(nil),
+		heartbeat:    health.NewHeartbeat(),
+		logger:       logging.Default(),
+		hotLogger:    logging.Sampled(logging.Default()),
 	}
+	mp.interval.Store(int64(readInterval))
+	return mp
+}
+
+// NewAdaptive returns a MessagePoller that reads up to BatchSize messages back to back while the socket has them,
+// waits readInterval once it runs out and doubles the wait up to MaxBackoff while reads keep failing or timing out
+func NewAdaptive(readInterval time.Duration) Poller {
+	mp := New(readInterval).(*MessagePoller)
+	mp.adaptive = true
+	return mp
 }
 
 // Start invokes a message poller to start polling
-func (mp MessagePoller) Start(ctx context.Context, msgRelayer relayer.Relayer) {
+func (mp *MessagePoller) Start(ctx context.Context, msgRelayer relayer.Relayer) {
+	if mp.adaptive {
+		mp.startAdaptive(ctx, msgRelayer)
+		return
+	}
 	ticker := time.NewTicker(mp.readInterval)
+	mp.heartbeat.Beat()
+	last := time.Now()
 	for {
 		select {
 		case <-ticker.C:
-			log.Println("reading new message...")
-			msg, err := msgRelayer.Read()
-			if err != nil {
-				log.Printf("unable to process message: %v", err)
-				break
+			mp.heartbeat.Beat()
+			read := 0
+			if mp.read(msgRelayer) {
+				read++
 			}
-			log.Printf("got new message of type %v: %v", msg.Type, string(msg.Data))
-			msgRelayer.Enqueue(msg)
+			last = mp.observeRate(read, last)
 		case <-ctx.Done():
-			log.Println("closing poller")
+			mp.close()
 			ticker.Stop()
-			mp.done <- true
 			return
 		}
 	}
 }
 
+// startAdaptive reads in batches, rescheduling itself right away after a full batch, after readInterval once the
+// socket ran out of messages and with exponential backoff while it has none
+func (mp *MessagePoller) startAdaptive(ctx context.Context, msgRelayer relayer.Relayer) {
+	wait := mp.readInterval
+	timer := time.NewTimer(wait)
+	mp.heartbeat.Beat()
+	last := time.Now()
+	for {
+		select {
+		case <-timer.C:
+			mp.heartbeat.Beat()
+			read := 0
+			for read < BatchSize && ctx.Err() == nil && mp.read(msgRelayer) {
+				read++
+			}
+			if ctx.Err() != nil {
+				continue // a batch cut short by closing says nothing about the socket
+			}
+			last = mp.observeRate(read, last)
+			switch {
+			case read == BatchSize:
+				wait = 0 // the socket likely has more queued up
+			case read > 0:
+				wait = mp.readInterval
+			case wait < mp.readInterval:
+				wait = mp.readInterval
+			default:
+				wait *= 2
+				if wait > MaxBackoff {
+					wait = MaxBackoff
+				}
+			}
+			mp.interval.Store(int64(wait))
+			timer.Reset(wait)
+		case <-ctx.Done():
+			mp.close()
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// read reads a single message and enqueues it, reporting whether one was read
+func (mp *MessagePoller) read(msgRelayer relayer.Relayer) bool {
+	mp.hotLogger.Debug("reading new message")
+	start := time.Now()
+	msg, err := msgRelayer.Read()
+	mp.latency.ObserveDuration(time.Since(start))
+	mp.polls.Add(1)
+	if err != nil {
+		mp.errors.Add(1)
+		mp.hotLogger.Warn("unable to read message", logging.ErrorKey, err)
+		return false
+	}
+	mp.hotLogger.Debug("read new message", logging.TypeKey, msg.Type, "size", len(msg.Data))
+	msgRelayer.Enqueue(msg)
+	return true
+}
+
+// observeRate records the rate of the messages read since last and returns the new reference time
+func (mp *MessagePoller) observeRate(read int, last time.Time) time.Time {
+	now := time.Now()
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		mp.rate.Store(math.Float64bits(float64(read) / elapsed))
+	}
+	return now
+}
+
+func (mp *MessagePoller) close() {
+	mp.logger.Info("closing poller", "polls", mp.polls.Load(), "errors", mp.errors.Load(), "rate", mp.Rate())
+	mp.done <- true
+}
+
+// Rate returns the messages read per second over the poller's last wait and read, its current effective rate
+func (mp *MessagePoller) Rate() float64 {
+	return math.Float64frombits(mp.rate.Load())
+}
+
+// Interval returns how long the poller currently waits between reads, always readInterval unless adaptive
+func (mp *MessagePoller) Interval() time.Duration {
+	return time.Duration(mp.interval.Load())
+}
+
 // DoneChannel returns the subscribers done channel so the parent process can wait until it completes to exit
-func (mp MessagePoller) DoneChannel() chan bool {
+func (mp *MessagePoller) DoneChannel() chan bool {
 	return mp.done
 }
+
+// Collect returns the poll count, error count, read latency, effective rate and current interval as metric families
+func (mp *MessagePoller) Collect() []metrics.Family {
+	return []metrics.Family{
+		{Name: "poller_polls_total", Help: "Reads attempted from the network socket.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: float64(mp.polls.Load())}}},
+		{Name: "poller_errors_total", Help: "Reads from the network socket that failed.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: float64(mp.errors.Load())}}},
+		{Name: "poller_read_duration_seconds", Help: "Time taken to read a message from the network socket.", Type: metrics.Histogram, Samples: mp.latency.Snapshot().Samples()},
+		{Name: "poller_rate_messages_per_second", Help: "Messages read per second over the last wait and read.", Type: metrics.Gauge, Samples: []metrics.Sample{{Value: mp.Rate()}}},
+		{Name: "poller_interval_seconds", Help: "Current wait between reads from the network socket.", Type: metrics.Gauge, Samples: []metrics.Sample{{Value: mp.Interval().Seconds()}}},
+	}
+}
+
+// Heartbeat returns the probe the poller beats on every tick or batch, so a stalled poller can be detected
+func (mp *MessagePoller) Heartbeat() *health.Heartbeat {
+	return mp.heartbeat
+}
+
+// SetLogger replaces the logger of the poller, records written for every read are sampled. It must be called
+// before Start.
+func (mp *MessagePoller) SetLogger(logger logging.Logger) {
+	mp.logger = logger
+	mp.hotLogger = logging.Sampled(logger)
+}
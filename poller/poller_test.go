@@ -2,10 +2,12 @@ package poller_test
 
 import (
 	"context"
+	"errors"
 	"messagerelayer/constants"
 	"messagerelayer/poller"
 	"messagerelayer/relayer"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -40,3 +42,86 @@ func TestStartPoller(t *testing.T) {
 	assert.GreaterOrEqual(t, summary.QueuedMsgs, 4, "queued message count")
 	assert.Equal(t, 0, summary.BroadcastedMsgs, "broadcasted message count should be 0 since we have no subscribers")
 }
+
+type FailingNetworkSocket struct{}
+
+func (fns *FailingNetworkSocket) Read() (constants.Message, error) {
+	return constants.Message{}, errors.New("connection refused")
+}
+
+func TestPollerMetrics(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(&FailingNetworkSocket{})
+	msgpoller := poller.New(100 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgpoller.Start(ctx, msgrelayer)
+	time.Sleep(550 * time.Millisecond) // artificial wait time to produce polls
+	cancel()
+	<-msgpoller.DoneChannel()
+	families := msgpoller.Collect()
+	assert.Equal(t, "poller_polls_total", families[0].Name)
+	assert.GreaterOrEqual(t, families[0].Samples[0].Value, 4.0, "poll count")
+	assert.Equal(t, families[0].Samples[0].Value, families[1].Samples[0].Value, "every poll failed")
+	assert.Equal(t, "poller_read_duration_seconds", families[2].Name)
+}
+
+func TestAdaptivePollerReadsBatches(t *testing.T) {
+	poller.BatchSize = 10
+	defer func() { poller.BatchSize = 100 }()
+	msgrelayer := relayer.NewMessageRelayer(&MockNetworkSocket{})
+	msgpoller := poller.NewAdaptive(100 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgpoller.Start(ctx, msgrelayer)
+	time.Sleep(350 * time.Millisecond) // artificial wait time to produce messages
+	cancel()
+	<-msgpoller.DoneChannel()
+	assert.Greater(t, msgrelayer.Summary().QueuedMsgs, 100, "reads in a tight loop while messages are available")
+	assert.Equal(t, time.Duration(0), msgpoller.Interval(), "no wait after a full batch")
+	assert.Greater(t, msgpoller.Rate(), 100.0, "effective rate")
+}
+
+func TestAdaptivePollerBacksOff(t *testing.T) {
+	poller.MaxBackoff = 40 * time.Millisecond
+	defer func() { poller.MaxBackoff = 10 * time.Second }()
+	msgrelayer := relayer.NewMessageRelayer(&FailingNetworkSocket{})
+	msgpoller := poller.NewAdaptive(10 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgpoller.Start(ctx, msgrelayer)
+	time.Sleep(300 * time.Millisecond) // artificial wait time to produce polls
+	cancel()
+	<-msgpoller.DoneChannel()
+	assert.Equal(t, 40*time.Millisecond, msgpoller.Interval(), "backoff is capped")
+	assert.LessOrEqual(t, msgpoller.Collect()[0].Samples[0].Value, 10.0, "fewer polls than a 10ms ticker")
+	assert.Equal(t, 0.0, msgpoller.Rate(), "effective rate")
+}
+
+// BurstNetworkSocket returns the messages it was given, then fails until given more
+type BurstNetworkSocket struct {
+	available atomic.Int64
+}
+
+func (bns *BurstNetworkSocket) Read() (constants.Message, error) {
+	if bns.available.Add(-1) < 0 {
+		bns.available.Store(0)
+		return constants.Message{}, errors.New("no message available")
+	}
+	return constants.Message{Type: constants.ReceivedAnswer, Data: []byte("a")}, nil
+}
+
+func TestAdaptivePollerRecovers(t *testing.T) {
+	poller.MaxBackoff = 40 * time.Millisecond
+	defer func() { poller.MaxBackoff = 10 * time.Second }()
+	socket := &BurstNetworkSocket{}
+	msgrelayer := relayer.NewMessageRelayer(socket)
+	msgpoller := poller.NewAdaptive(10 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgpoller.Start(ctx, msgrelayer)
+	time.Sleep(200 * time.Millisecond) // artificial wait time to back off
+	assert.Equal(t, 40*time.Millisecond, msgpoller.Interval(), "backed off while idle")
+	socket.available.Store(5)
+	time.Sleep(60 * time.Millisecond) // artificial wait time for the next batch
+	cancel()
+	<-msgpoller.DoneChannel()
+	assert.Equal(t, 5, msgrelayer.Summary().QueuedMsgs, "burst is read")
+	assert.LessOrEqual(t, msgpoller.Interval(), 40*time.Millisecond)
+	assert.NotEqual(t, time.Duration(0), msgpoller.Interval(), "waits again once the socket ran out")
+}
@@ -0,0 +1,141 @@
+package relayer
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"sort"
+)
+
+// SubscriberInfo describes a single registration of a subscriber channel and how full its buffer is
+type SubscriberInfo struct {
+	Name     string                `json:"name"`
+	Type     constants.MessageType `json:"type,omitempty"`  // set for SubscribeToMessages registrations
+	Topic    string                `json:"topic,omitempty"` // set for SubscribeToTopic registrations
+	Group    string                `json:"group,omitempty"`
+	Filter   string                `json:"filter,omitempty"`
+	Buffered int                   `json:"buffered"`
+	Capacity int                   `json:"capacity"`
+	Fill     float64               `json:"fill"` // buffered over capacity, between 0 and 1
+}
+
+func newSubscriberInfo(sub subscription, group string) SubscriberInfo {
+	info := SubscriberInfo{
+		Name:     sub.name,
+		Group:    group,
+		Buffered: len(sub.ch),
+		Capacity: cap(sub.ch),
+		Fill:     load(sub.ch),
+	}
+	if sub.filter != nil {
+		info.Filter = sub.filter.String()
+	}
+	return info
+}
+
+// Subscribers returns every subscriber registration, a channel subscribed to several types or patterns is listed
+// once per registration. The list is sorted by name, type and topic.
+func (mr *MessageRelayer) Subscribers() []SubscriberInfo {
+	mr.subscribersMu.RLock()
+	defer mr.subscribersMu.RUnlock()
+	infos := []SubscriberInfo{}
+	addGroups := func(groups map[string]*subscriberGroup, fn func(SubscriberInfo) SubscriberInfo) {
+		for name, group := range groups {
+			group.mu.Lock()
+			for _, member := range group.members {
+				infos = append(infos, fn(newSubscriberInfo(member, name)))
+			}
+			group.mu.Unlock()
+		}
+	}
+	for _, t := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer} {
+		withType := func(info SubscriberInfo) SubscriberInfo {
+			info.Type = t
+			return info
+		}
+		for _, sub := range mr.subscribers[t] {
+			infos = append(infos, withType(newSubscriberInfo(sub, "")))
+		}
+		addGroups(mr.groups[t], withType)
+	}
+	mr.topics.walkPatterns(nil, func(pattern string, n *topicNode) {
+		withTopic := func(info SubscriberInfo) SubscriberInfo {
+			info.Topic = pattern
+			return info
+		}
+		for _, sub := range n.subs {
+			infos = append(infos, withTopic(newSubscriberInfo(sub, "")))
+		}
+		addGroups(n.groups, withTopic)
+	})
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		if infos[i].Type != infos[j].Type {
+			return infos[i].Type < infos[j].Type
+		}
+		return infos[i].Topic < infos[j].Topic
+	})
+	return infos
+}
+
+// Peek returns up to limit messages waiting in the queue of msgType without removing them, the next message to
+// be broadcast first. A limit of zero or less returns the whole queue.
+func (mr *MessageRelayer) Peek(msgType constants.MessageType, limit int) []constants.Message {
+	return mr.queue(msgType).Peek(limit)
+}
+
+// Queued returns how many messages wait in the queue of msgType without copying them, for All the sizes of
+// both queues are summed
+func (mr *MessageRelayer) Queued(msgType constants.MessageType) int {
+	if msgType == constants.All {
+		return mr.Queued(constants.StartNewRound) + mr.Queued(constants.ReceivedAnswer)
+	}
+	return mr.queue(msgType).Size()
+}
+
+// Pause stops broadcasting messages of msgType until Resume is called. Messages keep being queued while paused,
+// the queue still drops its oldest messages once it grows past QueueSize.
+func (mr *MessageRelayer) Pause(msgType constants.MessageType) {
+	mr.pausedMu.Lock()
+	for _, t := range expandType(msgType) {
+		mr.paused[t] = true
+	}
+	mr.pausedMu.Unlock()
+	mr.logger.Info("paused broadcasting", logging.TypeKey, msgType)
+}
+
+// Resume restarts broadcasting messages of msgType after Pause
+func (mr *MessageRelayer) Resume(msgType constants.MessageType) {
+	mr.pausedMu.Lock()
+	for _, t := range expandType(msgType) {
+		delete(mr.paused, t)
+	}
+	mr.pausedMu.Unlock()
+	mr.logger.Info("resumed broadcasting", logging.TypeKey, msgType)
+}
+
+// Paused reports whether broadcasting messages of msgType is paused, for All whether either type is
+func (mr *MessageRelayer) Paused(msgType constants.MessageType) bool {
+	mr.pausedMu.RLock()
+	defer mr.pausedMu.RUnlock()
+	for _, t := range expandType(msgType) {
+		if mr.paused[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// Purge removes every message waiting in the queue of msgType and returns how many were removed, they are
+// counted as discarded
+func (mr *MessageRelayer) Purge(msgType constants.MessageType) int {
+	purged := 0
+	for _, t := range expandType(msgType) {
+		count := mr.queue(t).Purge()
+		mr.stats.discarded(t, count)
+		purged += count
+	}
+	mr.logger.Info("purged queue", logging.TypeKey, msgType, "purged", purged)
+	return purged
+}
@@ -0,0 +1,26 @@
+package relayer_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/relayer"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseBroadcasting(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	ch := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.All, ch)
+	msgrelayer.Pause(constants.ReceivedAnswer)
+	relay(msgrelayer, append(answers(3, nil), constants.Message{Type: constants.StartNewRound}))
+	assert.Equal(t, 1, len(ch), "only the start round message is broadcast")
+	assert.Equal(t, 3, len(msgrelayer.Peek(constants.ReceivedAnswer, 0)), "answers stay queued while paused")
+	assert.Equal(t, 3, msgrelayer.Queued(constants.ReceivedAnswer), "queued answers")
+	assert.Equal(t, 3, msgrelayer.Queued(constants.All), "both queues summed")
+
+	msgrelayer.Resume(constants.ReceivedAnswer)
+	relay(msgrelayer, nil)
+	assert.Equal(t, 4, len(ch), "answers broadcast once resumed")
+	assert.Equal(t, 0, msgrelayer.Purge(constants.All), "nothing left to purge")
+}
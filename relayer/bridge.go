@@ -0,0 +1,104 @@
+package relayer
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/filter"
+	"sync"
+)
+
+// Bridge connects a protocol facade, like the RESP, MQTT or NATS servers, to the broadcasts of a message type. It
+// registers a channel per queue with the relayer while the facade has subscribers and hands every broadcast to
+// deliver. A message of type All sits in both queues, a bridge covering both only takes it from the StartNewRound
+// queue so it is delivered once.
+type Bridge struct {
+	relayer    Relayer
+	msgType    constants.MessageType
+	bufferSize int
+	deliver    func(constants.Message)
+	opts       []SubscribeOption
+	mu         sync.Mutex
+	queues     map[constants.MessageType]chan constants.Message // registered with the relayer while subscribed
+	stop       chan struct{}
+}
+
+// NewBridge returns an unsubscribed bridge for the broadcasts of msgType, All covering both queues. Each queue gets a
+// channel of bufferSize and its own goroutine calling deliver, opts are applied to every registration.
+func NewBridge(msgRelayer Relayer, msgType constants.MessageType, bufferSize int, deliver func(constants.Message), opts ...SubscribeOption) *Bridge {
+	return &Bridge{
+		relayer:    msgRelayer,
+		msgType:    msgType,
+		bufferSize: bufferSize,
+		deliver:    deliver,
+		opts:       opts,
+	}
+}
+
+// Subscribe registers the bridge with the relayer unless it already is
+func (b *Bridge) Subscribe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.queues != nil {
+		return
+	}
+	b.queues = make(map[constants.MessageType]chan constants.Message)
+	b.stop = make(chan struct{})
+	for _, msgType := range expandType(b.msgType) {
+		ch := make(chan constants.Message, b.bufferSize)
+		b.queues[msgType] = ch
+		opts := b.opts
+		if b.msgType == constants.All && msgType == constants.ReceivedAnswer {
+			opts = append(opts[:len(opts):len(opts)], skipTypeAll)
+		}
+		b.relayer.SubscribeToMessages(msgType, ch, opts...)
+		go b.forward(ch, b.stop)
+	}
+}
+
+// Unsubscribe removes the bridge from the relayer unless it already is, broadcasts it still buffers are dropped
+func (b *Bridge) Unsubscribe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.queues == nil {
+		return
+	}
+	for msgType, ch := range b.queues {
+		b.relayer.UnsubscribeFromMessages(msgType, ch)
+	}
+	close(b.stop)
+	b.queues = nil
+}
+
+func (b *Bridge) forward(ch chan constants.Message, stop chan struct{}) {
+	for {
+		select {
+		case msg := <-ch:
+			b.deliver(msg)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// skipTypeAll adds a filter passing over messages of type All to the subscription's filter
+func skipTypeAll(opts *subscribeOptions) {
+	if opts.filter == nil {
+		opts.filter = notTypeAll{}
+		return
+	}
+	opts.filter = filter.And(opts.filter, notTypeAll{})
+}
+
+type notTypeAll struct{}
+
+func (notTypeAll) Match(msg constants.Message) bool {
+	return msg.Type != constants.All
+}
+
+func (notTypeAll) String() string {
+	return "type != All"
+}
+
+// Covers reports whether a channel, subject or topic a facade mapped to mappedType receives messages of msgType
+func Covers(mappedType constants.MessageType, msgType constants.MessageType) bool {
+	return mappedType == msgType || mappedType == constants.All || msgType == constants.All
+}
@@ -0,0 +1,40 @@
+package relayer_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/relayer"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBridgeDeliversAllOnce(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	var mu sync.Mutex
+	delivered := []string{}
+	bridge := relayer.NewBridge(msgrelayer, constants.All, 10, func(msg constants.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, string(msg.Data))
+	})
+	bridge.Subscribe()
+	bridge.Subscribe()
+	relay(msgrelayer, []constants.Message{
+		{Type: constants.StartNewRound, Data: []byte("round")},
+		{Type: constants.ReceivedAnswer, Data: []byte("answer")},
+		{Type: constants.All, Data: []byte("all")},
+	})
+	bridge.Unsubscribe()
+	bridge.Unsubscribe()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"round", "answer", "all"}, delivered, "every broadcast is delivered once")
+}
+
+func TestCovers(t *testing.T) {
+	assert.True(t, relayer.Covers(constants.All, constants.ReceivedAnswer))
+	assert.True(t, relayer.Covers(constants.ReceivedAnswer, constants.All))
+	assert.True(t, relayer.Covers(constants.StartNewRound, constants.StartNewRound))
+	assert.False(t, relayer.Covers(constants.StartNewRound, constants.ReceivedAnswer))
+}
@@ -0,0 +1,75 @@
+package relayer
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"time"
+)
+
+// DrainTimeout is how long Start keeps broadcasting queued messages once its context is cancelled
+var DrainTimeout = 5 * time.Second
+
+// drainRetryInterval is how often a subscriber group whose members are all busy is retried while draining
+const drainRetryInterval = 10 * time.Millisecond
+
+// drainReason is the reason the messages left queued after draining are written to a Spill with
+const drainReason = "undelivered at shutdown"
+
+// Spill persists the messages still queued when a relayer finishes draining, schema.DeadLetter implementations
+// such as schema.FileDeadLetter satisfy it
+type Spill interface {
+	Write(msg constants.Message, reason string) error
+}
+
+// SpillTo makes the relayer move the messages left queued after draining to spill instead of only reporting them,
+// it must be called before Start
+func (mr *MessageRelayer) SpillTo(spill Spill) {
+	mr.spill = spill
+}
+
+// drain broadcasts the queued messages back to back, without waiting BroadcastInterval, until both queues are
+// empty or DrainTimeout passes, waiting for busy subscribers to make room rather than skipping them. Paused queues
+// are left as they are. Whatever is left is reported, and when there is
+// a spill it is removed from the queue, written to the spill and counted as discarded.
+func (mr *MessageRelayer) drain() {
+	deadline := time.Now().Add(DrainTimeout)
+	mr.drainDeadline = deadline
+	defer func() { mr.drainDeadline = time.Time{} }()
+	for time.Now().Before(deadline) {
+		broadcasted := false
+		for _, msgType := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer} {
+			if mr.Paused(msgType) {
+				continue
+			}
+			if msg := mr.queue(msgType).Pop(); msg != nil {
+				mr.broacast(msgType, *msg)
+				broadcasted = true
+			}
+		}
+		if !broadcasted {
+			break
+		}
+	}
+	for _, msgType := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer} {
+		if mr.spill == nil {
+			if left := mr.queue(msgType).Size(); left > 0 {
+				mr.logger.Warn("messages left undelivered after draining", logging.TypeKey, msgType, "count", left)
+			}
+			continue
+		}
+		left := mr.queue(msgType).Drain()
+		if len(left) == 0 {
+			continue
+		}
+		mr.stats.discarded(msgType, len(left))
+		spilled := 0
+		for _, msg := range left {
+			if err := mr.spill.Write(msg, drainReason); err != nil {
+				mr.logger.Error("unable to spill undelivered message", logging.TypeKey, msgType, logging.MessageIDKey, msg.ID, logging.ErrorKey, err)
+				continue
+			}
+			spilled++
+		}
+		mr.logger.Warn("messages left undelivered after draining", logging.TypeKey, msgType, "count", len(left), "spilled", spilled)
+	}
+}
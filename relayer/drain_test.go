@@ -0,0 +1,83 @@
+package relayer_test
+
+import (
+	"context"
+	"messagerelayer/constants"
+	"messagerelayer/relayer"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySpill struct {
+	msgs    []constants.Message
+	reasons []string
+}
+
+func (ms *memorySpill) Write(msg constants.Message, reason string) error {
+	ms.msgs = append(ms.msgs, msg)
+	ms.reasons = append(ms.reasons, reason)
+	return nil
+}
+
+// stop starts the relayer with an already cancelled context so it goes straight to draining
+func stop(msgrelayer relayer.Relayer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	go msgrelayer.Start(ctx)
+	<-msgrelayer.DoneChannel()
+}
+
+func TestDrainOnShutdown(t *testing.T) {
+	relayer.BroadcastInterval = 1 * time.Hour
+	defer func() { relayer.BroadcastInterval = 1 * time.Second }()
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	ch := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.All, ch)
+	for _, msg := range append(answers(3, nil), constants.Message{Type: constants.StartNewRound}) {
+		msgrelayer.Enqueue(msg)
+	}
+	stop(msgrelayer)
+	assert.Equal(t, 4, len(ch), "queued messages are flushed without waiting the broadcast interval")
+	assert.Equal(t, 4, msgrelayer.Summary().BroadcastedMsgs)
+}
+
+func TestSpillUndelivered(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	spill := &memorySpill{}
+	msgrelayer.SpillTo(spill)
+	msgrelayer.Pause(constants.ReceivedAnswer)
+	for _, msg := range answers(3, nil) {
+		msgrelayer.Enqueue(msg)
+	}
+	stop(msgrelayer)
+	assert.Equal(t, 3, len(spill.msgs), "paused messages are spilled")
+	assert.Equal(t, "undelivered at shutdown", spill.reasons[0])
+	assert.Equal(t, 0, len(msgrelayer.Peek(constants.ReceivedAnswer, 0)), "spilled messages leave the queue")
+	assert.Equal(t, 3, msgrelayer.Stats().Types[constants.ReceivedAnswer].Discarded)
+}
+
+func TestDrainWaitsForSlowSubscriber(t *testing.T) {
+	relayer.BroadcastInterval = 1 * time.Hour
+	defer func() { relayer.BroadcastInterval = 1 * time.Second }()
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	ch := make(chan constants.Message, 1)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, ch)
+	for _, msg := range answers(5, nil) {
+		msgrelayer.Enqueue(msg)
+	}
+	received := make(chan int)
+	go func() {
+		count := 0
+		for range ch {
+			count++
+			time.Sleep(20 * time.Millisecond) // slow subscriber
+		}
+		received <- count
+	}()
+	stop(msgrelayer)
+	close(ch)
+	assert.Equal(t, 5, <-received, "every queued message reaches the slow subscriber")
+	assert.Equal(t, 0, msgrelayer.Summary().SkippedMsgs, "nothing is skipped while draining")
+}
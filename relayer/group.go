@@ -0,0 +1,200 @@
+package relayer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"messagerelayer/constants"
+	"messagerelayer/filter"
+	"messagerelayer/middleware"
+	"messagerelayer/utils"
+	"sort"
+	"sync"
+)
+
+// GroupStrategy decides which member of a subscriber group receives each message
+type GroupStrategy int
+
+const (
+	// RoundRobin cycles through the members, passing over busy ones
+	RoundRobin GroupStrategy = iota
+	// LeastLoaded picks the member with the emptiest channel
+	LeastLoaded
+	// ConsistentHash routes messages sharing a constants.KeyHeader value to the same member, falling back to
+	// RoundRobin for messages without a key
+	ConsistentHash
+)
+
+func (gs GroupStrategy) String() string {
+	if gs == LeastLoaded {
+		return "least loaded"
+	}
+	if gs == ConsistentHash {
+		return "consistent hash"
+	}
+	return "round robin"
+}
+
+// HashRingReplicas is the number of points each group member occupies on a consistent hash ring
+var HashRingReplicas = 50
+
+// SubscribeOption customizes a subscription registered with SubscribeToMessages
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	name         string
+	group        string
+	strategy     GroupStrategy
+	filter       filter.Filter
+	interceptors middleware.Chain
+}
+
+// InGroup makes the subscriber a member of a named competing-consumer group, each message is delivered to exactly
+// one member of the group instead of to every member. The strategy of the first member registered is used.
+func InGroup(name string, strategy GroupStrategy) SubscribeOption {
+	return func(opts *subscribeOptions) {
+		opts.group = name
+		opts.strategy = strategy
+	}
+}
+
+// Named labels the subscriber in stats and metrics, unnamed subscribers are labelled with their channel address
+func Named(name string) SubscribeOption {
+	return func(opts *subscribeOptions) {
+		opts.name = name
+	}
+}
+
+// WithFilter only delivers messages matched by f to the subscriber, inside a group the message goes to a member whose
+// filter matches it
+func WithFilter(f filter.Filter) SubscribeOption {
+	return func(opts *subscribeOptions) {
+		opts.filter = f
+	}
+}
+
+// subscriberGroup is a set of channels competing for the messages of a single type
+type subscriberGroup struct {
+	name     string
+	strategy GroupStrategy
+	mu       sync.Mutex
+	members  []subscription
+	cursor   int
+	ring     []ringPoint // sorted by hash
+}
+
+type ringPoint struct {
+	hash   uint32
+	member subscription
+}
+
+func newSubscriberGroup(name string, strategy GroupStrategy) *subscriberGroup {
+	return &subscriberGroup{
+		name:     name,
+		strategy: strategy,
+	}
+}
+
+func (g *subscriberGroup) add(sub subscription) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.members = append(g.members, sub)
+	g.buildRing()
+}
+
+// remove drops ch from the group and reports whether the group is now empty
+func (g *subscriberGroup) remove(ch chan constants.Message) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.members = removeSubscription(g.members, ch)
+	g.buildRing()
+	return len(g.members) == 0
+}
+
+// buildRing places HashRingReplicas points per member on the hash ring, g.mu must be held
+func (g *subscriberGroup) buildRing() {
+	if g.strategy != ConsistentHash {
+		return
+	}
+	g.ring = g.ring[:0]
+	for _, member := range g.members {
+		for i := 0; i < HashRingReplicas; i++ {
+			g.ring = append(g.ring, ringPoint{
+				hash:   hashKey(fmt.Sprintf("%p-%d", member.ch, i)),
+				member: member,
+			})
+		}
+	}
+	sort.Slice(g.ring, func(i, j int) bool { return g.ring[i].hash < g.ring[j].hash })
+}
+
+// pick returns the member that should receive msg, its channel is nil when every eligible member is busy. matched
+// is false when no member's filter accepts msg.
+func (g *subscriberGroup) pick(msg constants.Message) (member subscription, matched bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, m := range g.members {
+		if m.accepts(msg) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return subscription{}, false
+	}
+	switch g.strategy {
+	case LeastLoaded:
+		for _, m := range g.members {
+			if !m.accepts(msg) || utils.ChannelIsFull(m.ch) {
+				continue
+			}
+			if member.ch == nil || load(m.ch) < load(member.ch) {
+				member = m
+			}
+		}
+		return member, true
+	case ConsistentHash:
+		if key := msg.Headers[constants.KeyHeader]; key != "" {
+			// keep affinity even when the owner is busy so messages for a key are never split across members
+			owner := g.owner(key)
+			if !owner.accepts(msg) {
+				return subscription{}, false
+			}
+			if utils.ChannelIsFull(owner.ch) {
+				return subscription{}, true
+			}
+			return owner, true
+		}
+	}
+	for i := 0; i < len(g.members); i++ {
+		m := g.members[(g.cursor+i)%len(g.members)]
+		if m.accepts(msg) && !utils.ChannelIsFull(m.ch) {
+			g.cursor = (g.cursor + i + 1) % len(g.members)
+			return m, true
+		}
+	}
+	return subscription{}, true
+}
+
+// owner returns the member owning key on the hash ring, g.mu must be held
+func (g *subscriberGroup) owner(key string) subscription {
+	h := hashKey(key)
+	i := sort.Search(len(g.ring), func(i int) bool { return g.ring[i].hash >= h })
+	if i == len(g.ring) {
+		i = 0
+	}
+	return g.ring[i].member
+}
+
+// load is the fill level of a channel between 0 and 1
+func load(ch chan constants.Message) float64 {
+	if cap(ch) == 0 {
+		return 1
+	}
+	return float64(len(ch)) / float64(cap(ch))
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
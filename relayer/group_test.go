@@ -0,0 +1,135 @@
+package relayer_test
+
+import (
+	"context"
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/filter"
+	"messagerelayer/relayer"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// relay enqueues the messages and runs the relayer until they have all been broadcast
+func relay(msgrelayer relayer.Relayer, msgs []constants.Message) {
+	relayer.BroadcastInterval = 0 * time.Second
+	for _, msg := range msgs {
+		msgrelayer.Enqueue(msg)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgrelayer.Start(ctx)
+	time.Sleep(500 * time.Millisecond) // artificial wait time to allow messages to get processed
+	cancel()
+	<-msgrelayer.DoneChannel()
+}
+
+func answers(count int, key func(int) string) []constants.Message {
+	msgs := []constants.Message{}
+	for i := 0; i < count; i++ {
+		msg := constants.Message{Type: constants.ReceivedAnswer, Data: []byte(fmt.Sprintf("%v", i))}
+		if key != nil {
+			msg.Headers = map[string]string{constants.KeyHeader: key(i)}
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestRoundRobinGroup(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	workerA := make(chan constants.Message, 10)
+	workerB := make(chan constants.Message, 10)
+	observer := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, workerA, relayer.InGroup("workers", relayer.RoundRobin))
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, workerB, relayer.InGroup("workers", relayer.RoundRobin))
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, observer)
+	relay(msgrelayer, answers(6, nil))
+	assert.Equal(t, 3, len(workerA), "worker a gets half")
+	assert.Equal(t, 3, len(workerB), "worker b gets half")
+	assert.Equal(t, 6, len(observer), "plain subscribers still get every message")
+	assert.Equal(t, 12, msgrelayer.Summary().BroadcastedMsgs, "broadcasted message count")
+}
+
+func TestLeastLoadedGroup(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	busy := make(chan constants.Message, 4)
+	idle := make(chan constants.Message, 4)
+	busy <- constants.Message{}
+	busy <- constants.Message{}
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, busy, relayer.InGroup("workers", relayer.LeastLoaded))
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, idle, relayer.InGroup("workers", relayer.LeastLoaded))
+	relay(msgrelayer, answers(2, nil))
+	assert.Equal(t, 2, len(busy), "busy worker gets nothing")
+	assert.Equal(t, 2, len(idle), "idle worker gets both")
+}
+
+func TestConsistentHashGroup(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	workers := []chan constants.Message{make(chan constants.Message, 20), make(chan constants.Message, 20), make(chan constants.Message, 20)}
+	for _, w := range workers {
+		msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, w, relayer.InGroup("workers", relayer.ConsistentHash))
+	}
+	relay(msgrelayer, answers(12, func(i int) string { return fmt.Sprintf("feed-%v", i%3) }))
+	owners := map[string]int{} // key -> index of the worker that received it
+	total := 0
+	for i, w := range workers {
+		for len(w) > 0 {
+			msg := <-w
+			key := msg.Headers[constants.KeyHeader]
+			owner, seen := owners[key]
+			assert.True(t, !seen || owner == i, "a key is owned by a single worker")
+			owners[key] = i
+			total++
+		}
+	}
+	assert.Equal(t, 12, total, "every message delivered once")
+}
+
+func TestUnsubscribeFromGroup(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	workerA := make(chan constants.Message, 10)
+	workerB := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.All, workerA, relayer.InGroup("workers", relayer.RoundRobin))
+	msgrelayer.SubscribeToMessages(constants.All, workerB, relayer.InGroup("workers", relayer.RoundRobin))
+	msgrelayer.UnsubscribeFromMessages(constants.All, workerB)
+	relay(msgrelayer, answers(4, nil))
+	assert.Equal(t, 4, len(workerA), "remaining member gets everything")
+	assert.Equal(t, 0, len(workerB), "removed member gets nothing")
+}
+
+func TestFilteredSubscribers(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	lowest, err := filter.Parse(`$.n < 3`)
+	assert.Nil(t, err, "parse err is nil")
+	matching := make(chan constants.Message, 10)
+	everything := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, matching, relayer.WithFilter(lowest))
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, everything)
+	msgs := []constants.Message{}
+	for i := 0; i < 6; i++ {
+		msgs = append(msgs, constants.Message{Type: constants.ReceivedAnswer, Data: []byte(fmt.Sprintf(`{"n": %v}`, i))})
+	}
+	relay(msgrelayer, msgs)
+	assert.Equal(t, 3, len(matching), "filtered subscriber only gets matches")
+	assert.Equal(t, 6, len(everything), "unfiltered subscriber gets every message")
+	assert.Equal(t, 3, msgrelayer.Summary().FilteredMsgs, "filtered message count")
+}
+
+func TestFilteredGroup(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	workerA := make(chan constants.Message, 10)
+	workerB := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, workerA, relayer.InGroup("workers", relayer.RoundRobin), relayer.WithFilter(filter.DataPrefix([]byte("a"))))
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, workerB, relayer.InGroup("workers", relayer.RoundRobin), relayer.WithFilter(filter.DataPrefix([]byte("b"))))
+	relay(msgrelayer, []constants.Message{
+		{Type: constants.ReceivedAnswer, Data: []byte("a1")},
+		{Type: constants.ReceivedAnswer, Data: []byte("a2")},
+		{Type: constants.ReceivedAnswer, Data: []byte("b1")},
+		{Type: constants.ReceivedAnswer, Data: []byte("c1")},
+	})
+	assert.Equal(t, 2, len(workerA), "worker a gets the a messages")
+	assert.Equal(t, 1, len(workerB), "worker b gets the b messages")
+	assert.Equal(t, 1, msgrelayer.Summary().FilteredMsgs, "message no member matches is filtered")
+}
@@ -0,0 +1,79 @@
+package relayer
+
+import (
+	"messagerelayer/codec"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/middleware"
+)
+
+// Stage is a point of the relayer pipeline interceptors are registered at
+type Stage int
+
+const (
+	// EnqueueStage runs before a message is queued, every message it returns is queued
+	EnqueueStage Stage = iota
+	// DeliveryStage runs once per broadcast before the message is handed to its subscribers, after compressed data
+	// was decompressed. A message of type All is queued for both types and broadcast from each queue, so the chain
+	// runs twice for it, once per type, and its errors and drops are counted twice.
+	DeliveryStage
+	// subscriberStage runs the interceptors a subscription registered with WithInterceptors
+	subscriberStage
+)
+
+func (s Stage) String() string {
+	if s == DeliveryStage {
+		return "delivery"
+	}
+	if s == subscriberStage {
+		return "subscriber"
+	}
+	return "enqueue"
+}
+
+// WithInterceptors runs every message delivered to the subscriber through interceptors first, after any
+// DeliveryStage interceptors registered on the relayer
+func WithInterceptors(interceptors ...middleware.Interceptor) SubscribeOption {
+	return func(opts *subscribeOptions) {
+		opts.interceptors = append(opts.interceptors, interceptors...)
+	}
+}
+
+// WithEncoding transcodes the data of every message delivered to the subscriber to contentType, using the
+// encoding declared in the message's codec.ContentTypeHeader
+func WithEncoding(contentType string) SubscribeOption {
+	return WithInterceptors(codec.Transcoder(contentType))
+}
+
+// Use appends interceptors to the chain run at stage
+func (mr *MessageRelayer) Use(stage Stage, interceptors ...middleware.Interceptor) {
+	mr.middlewareMu.Lock()
+	defer mr.middlewareMu.Unlock()
+	// copy on write so chains being applied outside the lock are unaffected
+	chain := append(middleware.Chain{}, mr.chains[stage]...)
+	mr.chains[stage] = append(chain, interceptors...)
+}
+
+// intercept runs msg through chain, counting the interceptor errors, panics included, and the messages dropped
+// for stage
+func (mr *MessageRelayer) intercept(stage Stage, chain middleware.Chain, msg constants.Message) []constants.Message {
+	if len(chain) == 0 {
+		return []constants.Message{msg}
+	}
+	failed := []string{}
+	msgs, dropped := chain.Apply(msg, func(interceptor middleware.Interceptor, err error) {
+		mr.logger.Warn("interceptor failed", "stage", stage.String(), "interceptor", interceptor.Name(), logging.MessageIDKey, msg.ID, logging.ErrorKey, err)
+		failed = append(failed, interceptor.Name())
+	})
+	if len(failed) > 0 || dropped > 0 {
+		mr.stats.interceptorResult(stage, failed, dropped)
+	}
+	return msgs
+}
+
+// chain returns the interceptors registered for stage
+func (mr *MessageRelayer) chain(stage Stage) middleware.Chain {
+	mr.middlewareMu.RLock()
+	defer mr.middlewareMu.RUnlock()
+	return mr.chains[stage]
+}
@@ -0,0 +1,91 @@
+package relayer_test
+
+import (
+	"bytes"
+	"errors"
+	"messagerelayer/codec"
+	"messagerelayer/compress"
+	"messagerelayer/constants"
+	"messagerelayer/filter"
+	"messagerelayer/middleware"
+	"messagerelayer/relayer"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptors(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	msgrelayer.Use(relayer.EnqueueStage, middleware.SplitJSONArray(), middleware.DropIf(filter.DataPrefix([]byte("0"))))
+	msgrelayer.Use(relayer.DeliveryStage, middleware.Func("reject 2", func(msg constants.Message) ([]constants.Message, error) {
+		if string(msg.Data) == "2" {
+			return nil, errors.New("rejected")
+		}
+		return []constants.Message{msg}, nil
+	}))
+	plain := make(chan constants.Message, 10)
+	enriched := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, plain)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, enriched, relayer.WithInterceptors(middleware.SetHeaders(map[string]string{"seen": "yes"})))
+	relay(msgrelayer, []constants.Message{{Type: constants.ReceivedAnswer, Data: []byte("[0, 1, 2, 3]")}})
+	assert.Equal(t, 2, len(plain), "split, dropped and rejected messages are not delivered")
+	assert.Equal(t, 2, len(enriched), "subscriber interceptors run per subscriber")
+	for len(plain) > 0 {
+		assert.Nil(t, (<-plain).Headers, "plain subscriber headers are untouched")
+		assert.Equal(t, "yes", (<-enriched).Headers["seen"], "enriched subscriber gets headers")
+	}
+	summary := msgrelayer.Summary()
+	assert.Equal(t, 3, summary.QueuedMsgs, "split messages are queued")
+	assert.Equal(t, 1, summary.DroppedMsgs, "dropped message count")
+	assert.Equal(t, map[string]int{"delivery/reject 2": 1}, summary.InterceptorErrors, "errors counted per stage")
+}
+
+func TestWithEncoding(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	packed := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, packed, relayer.WithEncoding("application/msgpack"))
+	relay(msgrelayer, []constants.Message{
+		{Type: constants.ReceivedAnswer, Data: []byte(`{"a": 1}`), Headers: map[string]string{codec.ContentTypeHeader: "application/json"}},
+		{Type: constants.ReceivedAnswer, Data: []byte(`not json`)},
+	})
+	assert.Equal(t, 1, len(packed), "undecodable message is not delivered")
+	msg := <-packed
+	assert.Equal(t, []byte{0x81, 0xa1, 'a', 0x01}, msg.Data)
+	assert.Equal(t, "application/msgpack", msg.Headers[codec.ContentTypeHeader])
+	assert.Equal(t, map[string]int{"subscriber/transcode to application/msgpack": 1}, msgrelayer.Summary().InterceptorErrors)
+}
+
+func TestDecompressesBeforeDelivery(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	ch := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, ch)
+	data := bytes.Repeat([]byte("answer "), 100)
+	compressed, err := compress.New(compress.Snappy, 10).Compress(constants.Message{Type: constants.ReceivedAnswer, Data: data})
+	assert.Nil(t, err, "compress err is nil")
+	relay(msgrelayer, []constants.Message{
+		compressed,
+		{Type: constants.ReceivedAnswer, Data: []byte("corrupt"), Headers: map[string]string{compress.EncodingHeader: "gzip"}},
+	})
+	assert.Equal(t, 1, len(ch), "corrupt message is not delivered")
+	msg := <-ch
+	assert.Equal(t, data, msg.Data, "subscriber gets plain data")
+	assert.Empty(t, msg.Headers[compress.EncodingHeader])
+	summary := msgrelayer.Summary()
+	assert.Equal(t, int64(1), summary.Decompression.Decompressed)
+	assert.Equal(t, map[string]int{"delivery/decompress": 1}, summary.InterceptorErrors)
+}
+
+func TestInterceptorPanicIsAnError(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	msgrelayer.Use(relayer.DeliveryStage, middleware.Func("panic on 1", func(msg constants.Message) ([]constants.Message, error) {
+		if string(msg.Data) == "1" {
+			panic("boom")
+		}
+		return []constants.Message{msg}, nil
+	}))
+	ch := make(chan constants.Message, 10)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, ch)
+	relay(msgrelayer, answers(3, nil))
+	assert.Equal(t, 2, len(ch), "the message the interceptor panicked on is dropped")
+	assert.Equal(t, map[string]int{"delivery/panic on 1": 1}, msgrelayer.Summary().InterceptorErrors, "panics are counted as errors")
+}
@@ -0,0 +1,191 @@
+package relayer
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds in seconds of the relayer's latency histograms, from 10µs to 10s as messages
+// usually spend microseconds in the relayer
+var LatencyBuckets = []float64{
+	.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+// LatencyStats holds histograms of the time messages spend in the relayer and its subscribers
+type LatencyStats struct {
+	QueueWait  map[constants.MessageType]metrics.Snapshot // from Enqueue until popped off the queue
+	Broadcast  map[constants.MessageType]metrics.Snapshot // to fan a message out to every subscriber
+	Delivery   map[constants.MessageType]metrics.Snapshot // from Enqueue until handed to a subscriber
+	Processing map[string]metrics.Snapshot                // from dequeue until the subscriber acked, by subscriber
+}
+
+// latencies records the relayer's latency histograms, it is safe for concurrent use
+type latencies struct {
+	mu         sync.Mutex
+	queueWait  map[constants.MessageType]*metrics.HistogramValue
+	broadcast  map[constants.MessageType]*metrics.HistogramValue
+	delivery   map[constants.MessageType]*metrics.HistogramValue
+	processing map[string]*metrics.HistogramValue
+}
+
+func newLatencies() *latencies {
+	return &latencies{
+		queueWait:  make(map[constants.MessageType]*metrics.HistogramValue),
+		broadcast:  make(map[constants.MessageType]*metrics.HistogramValue),
+		delivery:   make(map[constants.MessageType]*metrics.HistogramValue),
+		processing: make(map[string]*metrics.HistogramValue),
+	}
+}
+
+// typeHistogram returns the histogram for msgType in histograms, creating it when missing
+func (l *latencies) typeHistogram(histograms map[constants.MessageType]*metrics.HistogramValue, msgType constants.MessageType) *metrics.HistogramValue {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h, ok := histograms[msgType]
+	if !ok {
+		h = metrics.NewHistogram(LatencyBuckets)
+		histograms[msgType] = h
+	}
+	return h
+}
+
+// observeSince records the time elapsed from start for msgType, ignoring messages that were never stamped
+func (l *latencies) observeSince(histograms map[constants.MessageType]*metrics.HistogramValue, msgType constants.MessageType, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	l.typeHistogram(histograms, msgType).ObserveDuration(time.Since(start))
+}
+
+// processed records the time subscriber took to process a message it started on at start
+func (l *latencies) processed(subscriber string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	l.mu.Lock()
+	h, ok := l.processing[subscriber]
+	if !ok {
+		h = metrics.NewHistogram(LatencyBuckets)
+		l.processing[subscriber] = h
+	}
+	l.mu.Unlock()
+	h.ObserveDuration(time.Since(start))
+}
+
+// processingStart returns when the subscriber holding msg took it off its channel, or when it was delivered for
+// subscribers that do not stamp DequeuedAt, in which case the time spent in the channel buffer is included
+func processingStart(msg constants.Message) time.Time {
+	if !msg.DequeuedAt.IsZero() {
+		return msg.DequeuedAt
+	}
+	return msg.DeliveredAt
+}
+
+func (l *latencies) stats() LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	typeSnapshots := func(histograms map[constants.MessageType]*metrics.HistogramValue) map[constants.MessageType]metrics.Snapshot {
+		out := make(map[constants.MessageType]metrics.Snapshot, len(histograms))
+		for t, h := range histograms {
+			out[t] = h.Snapshot()
+		}
+		return out
+	}
+	processing := make(map[string]metrics.Snapshot, len(l.processing))
+	for name, h := range l.processing {
+		processing[name] = h.Snapshot()
+	}
+	return LatencyStats{
+		QueueWait:  typeSnapshots(l.queueWait),
+		Broadcast:  typeSnapshots(l.broadcast),
+		Delivery:   typeSnapshots(l.delivery),
+		Processing: processing,
+	}
+}
+
+// Ack records that subscriber finished processing msg, a message it received from the relayer
+func (mr *MessageRelayer) Ack(subscriber string, msg constants.Message) {
+	mr.latencies.processed(subscriber, processingStart(msg))
+	mr.traceProcessed(subscriber, msg)
+}
+
+// Latency returns the relayer's latency histograms
+func (mr *MessageRelayer) Latency() LatencyStats {
+	return mr.latencies.stats()
+}
+
+// families returns the latency histograms as metric families
+func (ls LatencyStats) families() []metrics.Family {
+	perType := func(name string, help string, snapshots map[constants.MessageType]metrics.Snapshot) metrics.Family {
+		f := metrics.Family{Name: name, Help: help, Type: metrics.Histogram}
+		for _, t := range sortedTypes(snapshots) {
+			f.Samples = append(f.Samples, snapshots[t].Samples(typeLabel(t)...)...)
+		}
+		return f
+	}
+	processing := metrics.Family{Name: "relayer_subscriber_processing_seconds", Help: "Time from the subscriber taking the message off its channel until it acked it.", Type: metrics.Histogram}
+	for _, name := range sortedNames(ls.Processing) {
+		processing.Samples = append(processing.Samples, ls.Processing[name].Samples(metrics.Label{Name: "subscriber", Value: name})...)
+	}
+	return []metrics.Family{
+		perType("relayer_queue_wait_seconds", "Time a message waited in its queue before being broadcast.", ls.QueueWait),
+		perType("relayer_broadcast_duration_seconds", "Time taken to fan a message out to its subscribers.", ls.Broadcast),
+		perType("relayer_delivery_latency_seconds", "Time from enqueue until a subscriber was handed the message.", ls.Delivery),
+		processing,
+	}
+}
+
+// logSummary logs the counters and latency percentiles of the relayer
+func (mr *MessageRelayer) logSummary() {
+	summary := mr.Summary()
+	mr.logger.Info("closing message relayer", "queued", summary.QueuedMsgs, "broadcasted", summary.BroadcastedMsgs,
+		"skipped", summary.SkippedMsgs, "filtered", summary.FilteredMsgs, "dropped", summary.DroppedMsgs)
+	if summary.Decompression.Decompressed > 0 {
+		mr.logger.Info("decompression", "messages", summary.Decompression.Decompressed, "time", summary.Decompression.DecompressTime)
+	}
+	logLatency := func(label string, s metrics.Snapshot) {
+		if s.Count == 0 {
+			return
+		}
+		mr.logger.Info("latency", "histogram", label, "count", s.Count, "mean", seconds(s.Mean()),
+			"p50", seconds(s.Quantile(0.5)), "p99", seconds(s.Quantile(0.99)))
+	}
+	latency := mr.Latency()
+	for _, t := range sortedTypes(latency.QueueWait) {
+		logLatency(t.String()+" queue wait", latency.QueueWait[t])
+	}
+	for _, t := range sortedTypes(latency.Broadcast) {
+		logLatency(t.String()+" broadcast", latency.Broadcast[t])
+	}
+	for _, t := range sortedTypes(latency.Delivery) {
+		logLatency(t.String()+" delivery", latency.Delivery[t])
+	}
+	for _, name := range sortedNames(latency.Processing) {
+		logLatency(name+" processing", latency.Processing[name])
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond)
+}
+
+func sortedTypes(snapshots map[constants.MessageType]metrics.Snapshot) []constants.MessageType {
+	types := make([]constants.MessageType, 0, len(snapshots))
+	for t := range snapshots {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+func sortedNames(snapshots map[string]metrics.Snapshot) []string {
+	names := make([]string, 0, len(snapshots))
+	for name := range snapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
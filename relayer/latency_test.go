@@ -0,0 +1,62 @@
+package relayer_test
+
+import (
+	"bytes"
+	"context"
+	"messagerelayer/constants"
+	"messagerelayer/metrics"
+	"messagerelayer/relayer"
+	"messagerelayer/subscriber"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyHistograms(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	s := subscriber.New(constants.ReceivedAnswer, func() time.Duration { return time.Millisecond }, 10, "acker")
+	s.(subscriber.Acking).AckTo(msgrelayer)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, s.Channel(constants.ReceivedAnswer), relayer.Named("acker"))
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	relay(msgrelayer, answers(3, nil))
+	cancel()
+	<-s.DoneChannel()
+	latency := msgrelayer.Latency()
+	assert.Equal(t, uint64(3), latency.QueueWait[constants.ReceivedAnswer].Count, "queue wait observations")
+	assert.Equal(t, uint64(3), latency.Broadcast[constants.ReceivedAnswer].Count, "broadcast observations")
+	assert.Equal(t, uint64(3), latency.Delivery[constants.ReceivedAnswer].Count, "delivery observations")
+	assert.Equal(t, uint64(3), latency.Processing["acker"].Count, "processing observations")
+	assert.Greater(t, latency.QueueWait[constants.ReceivedAnswer].Sum, 0.0, "messages waited in the queue")
+	registry := metrics.NewRegistry()
+	registry.Register(msgrelayer)
+	var out bytes.Buffer
+	registry.WriteText(&out)
+	assert.Contains(t, out.String(), `relayer_queue_wait_seconds_count{type="ReceivedAnswer"} 3`+"\n")
+	assert.Contains(t, out.String(), `relayer_subscriber_processing_seconds_count{subscriber="acker"} 3`+"\n")
+}
+
+func TestProcessingExcludesBufferWait(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	now := time.Now()
+	msgrelayer.Ack("stamped", constants.Message{Type: constants.ReceivedAnswer, DeliveredAt: now.Add(-time.Hour), DequeuedAt: now})
+	msgrelayer.Ack("unstamped", constants.Message{Type: constants.ReceivedAnswer, DeliveredAt: now.Add(-time.Hour)})
+	latency := msgrelayer.Latency()
+	assert.Less(t, latency.Processing["stamped"].Sum, 60.0, "processing starts when the subscriber dequeued the message")
+	assert.GreaterOrEqual(t, latency.Processing["unstamped"].Sum, 3600.0, "processing falls back to the delivery time")
+}
+
+func TestLatencyQuantiles(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		msgrelayer.Ack("acker", constants.Message{Type: constants.ReceivedAnswer, DequeuedAt: now.Add(-300 * time.Microsecond)})
+		msgrelayer.Ack("acker", constants.Message{Type: constants.ReceivedAnswer, DequeuedAt: now.Add(-30 * time.Millisecond)})
+	}
+	processing := msgrelayer.Latency().Processing["acker"]
+	// observations fall in the 250µs-500µs and 25ms-50ms buckets and are interpolated within them
+	assert.InDelta(t, 375e-6, processing.Quantile(0.25), 1e-9, "p25")
+	assert.InDelta(t, 37.5e-3, processing.Quantile(0.75), 1e-9, "p75")
+	assert.InDelta(t, 49.5e-3, processing.Quantile(0.99), 1e-9, "p99")
+}
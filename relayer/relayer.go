@@ -2,9 +2,18 @@ package relayer
 
 import (
 	"context"
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"messagerelayer/compress"
 	"messagerelayer/constants"
-	"messagerelayer/utils"
+	"messagerelayer/filter"
+	"messagerelayer/health"
+	"messagerelayer/logging"
+	"messagerelayer/metrics"
+	"messagerelayer/middleware"
+	"messagerelayer/topic"
+	"messagerelayer/tracing"
 	"sync"
 	"time"
 )
@@ -19,8 +28,14 @@ var BroadcastInterval = 1 * time.Second
 type WorkSummary struct {
 	QueuedMsgs      int // successfully added messages to queue to be broadcasted
 	BroadcastedMsgs int // successfully broadcasted to a subscriber
-	DiscardedMsgs   int // queus full so we discarded older messages
+	DiscardedMsgs   int // queue full, purged or unroutable so we discarded the message
 	SkippedMsgs     int // subscriber busy so we dropped the message
+	FilteredMsgs    int // subscriber filter rejected the message
+	DroppedMsgs     int // an interceptor dropped the message
+	// InterceptorErrors counts the messages dropped because an interceptor failed, by "<stage>/<interceptor name>"
+	InterceptorErrors map[string]int
+	// Decompression reports the compressed messages decompressed before delivery and the time it took
+	Decompression compress.Stats
 }
 
 // Relayer relays messages to subscribers
@@ -28,8 +43,29 @@ type Relayer interface {
 	Start(context.Context)
 	Read() (constants.Message, error)
 	Enqueue(constants.Message)
-	SubscribeToMessages(msgType constants.MessageType, ch chan constants.Message)
+	SubscribeToMessages(msgType constants.MessageType, ch chan constants.Message, opts ...SubscribeOption)
+	UnsubscribeFromMessages(msgType constants.MessageType, ch chan constants.Message)
+	SubscribeToTopic(pattern string, ch chan constants.Message, opts ...SubscribeOption) error
+	UnsubscribeFromTopic(pattern string, ch chan constants.Message)
+	Use(stage Stage, interceptors ...middleware.Interceptor)
+	Saturated(constants.MessageType) bool
+	Space(constants.MessageType) int
 	DoneChannel() chan bool
+	Collect() []metrics.Family
+	Ack(subscriber string, msg constants.Message)
+	Latency() LatencyStats
+	Stats() StatsSnapshot
+	Subscribers() []SubscriberInfo
+	Peek(msgType constants.MessageType, limit int) []constants.Message
+	Queued(constants.MessageType) int
+	Pause(constants.MessageType)
+	Resume(constants.MessageType)
+	Paused(constants.MessageType) bool
+	Purge(constants.MessageType) int
+	Heartbeat() *health.Heartbeat
+	SetLogger(logging.Logger)
+	SetTracer(*tracing.Tracer)
+	SpillTo(Spill)
 	// helpers for test validation
 	Summary() WorkSummary
 }
@@ -126,124 +162,479 @@ func (lml *LinkedMsgList) Size() int {
 	return size
 }
 
+// Peek returns up to limit messages from the head of the list, the next to be popped, without removing them.
+// A limit of zero or less returns every message.
+func (lml *LinkedMsgList) Peek(limit int) []constants.Message {
+	lml.mu.Lock()
+	defer lml.mu.Unlock()
+	msgs := []constants.Message{}
+	for node := lml.head; node != nil && (limit <= 0 || len(msgs) < limit); node = node.next {
+		msgs = append(msgs, *node.msg)
+	}
+	return msgs
+}
+
+// Purge removes every message from the list and returns how many were removed
+func (lml *LinkedMsgList) Purge() int {
+	lml.mu.Lock()
+	purged := lml.size
+	lml.head = nil
+	lml.tail = nil
+	lml.size = 0
+	lml.mu.Unlock()
+	return purged
+}
+
+// Drain removes every message from the list and returns them, next to be popped first
+func (lml *LinkedMsgList) Drain() []constants.Message {
+	lml.mu.Lock()
+	msgs := []constants.Message{}
+	for node := lml.head; node != nil; node = node.next {
+		msgs = append(msgs, *node.msg)
+	}
+	lml.head = nil
+	lml.tail = nil
+	lml.size = 0
+	lml.mu.Unlock()
+	return msgs
+}
+
+// Space returns how many messages can be pushed before the list reaches its desired size
+func (lml *LinkedMsgList) Space() int {
+	lml.mu.Lock()
+	space := lml.desiredSize - lml.size
+	lml.mu.Unlock()
+	if space < 0 {
+		return 0
+	}
+	return space
+}
+
+// Full reports whether the list has reached its desired size
+func (lml *LinkedMsgList) Full() bool {
+	lml.mu.Lock()
+	full := lml.size >= lml.desiredSize
+	lml.mu.Unlock()
+	return full
+}
+
 // NewMessageRelayer returns a new message relayer
 func NewMessageRelayer(socket NetworkSocket) Relayer {
 	return &MessageRelayer{
-		socket:               socket,
-		startRoundQueue:      NewLinkedMsgList(QueueSize),
-		recievedAnswerQueue:  NewLinkedMsgList(QueueSize),
-		subscribers:          make(map[constants.MessageType][]chan constants.Message),
-		queuesMsgsCount:      0,
-		broadcastedMsgsCount: 0,
-		discardedMsgsCount:   0,
-		skippedMsgCount:      0,
-		done:                 make(chan bool),
+		socket:              socket,
+		startRoundQueue:     NewLinkedMsgList(QueueSize),
+		recievedAnswerQueue: NewLinkedMsgList(QueueSize),
+		subscribers:         make(map[constants.MessageType][]subscription),
+		groups:              make(map[constants.MessageType]map[string]*subscriberGroup),
+		topics:              newTopicNode(),
+		chains:              make(map[Stage]middleware.Chain),
+		stats:               newStats(),
+		latencies:           newLatencies(),
+		decompressor:        compress.New(compress.Gzip, 0), // the algorithm of each message comes from its header
+		paused:              make(map[constants.MessageType]bool),
+		heartbeat:           health.NewHeartbeat(),
+		logger:              logging.Default(),
+		hotLogger:           logging.Sampled(logging.Default()),
+		done:                make(chan bool),
 	}
 }
 
 // MessageRelayer relays messages from a network socket to its subscribers
 type MessageRelayer struct {
-	socket               NetworkSocket
-	startRoundQueue      *LinkedMsgList
-	recievedAnswerQueue  *LinkedMsgList
-	subscribers          map[constants.MessageType][]chan constants.Message // message type -> array of message channels
-	queuesMsgsCount      int
-	broadcastedMsgsCount int
-	discardedMsgsCount   int
-	skippedMsgCount      int
-	done                 chan bool
+	socket              NetworkSocket
+	startRoundQueue     *LinkedMsgList
+	recievedAnswerQueue *LinkedMsgList
+	subscribers         map[constants.MessageType][]subscription              // message type -> array of subscriptions
+	groups              map[constants.MessageType]map[string]*subscriberGroup // message type -> group name -> group
+	topics              *topicNode                                            // topic pattern trie
+	subscribersMu       sync.RWMutex
+	chains              map[Stage]middleware.Chain // stage -> interceptors
+	middlewareMu        sync.RWMutex               // guards chains
+	stats               *stats
+	latencies           *latencies
+	decompressor        *compress.Compressor           // decompresses messages before the delivery stage
+	paused              map[constants.MessageType]bool // message type -> broadcasting paused
+	pausedMu            sync.RWMutex
+	heartbeat           *health.Heartbeat // beaten on every pass of the broadcast loop
+	logger              logging.Logger
+	hotLogger           logging.Logger  // sampled logger for records written per message
+	tracer              *tracing.Tracer // nil when tracing is disabled
+	spill               Spill           // receives the messages left queued after draining, may be nil
+	drainDeadline       time.Time       // set while Start drains the queues, only used by the Start goroutine
+	done                chan bool
 }
 
 func (mr *MessageRelayer) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("closing message relayer:: queued: %v messages, broadcasted: %v messages", mr.queuesMsgsCount, mr.broadcastedMsgsCount)
+			mr.drain()
+			mr.logSummary()
 			mr.done <- true
 			return
 		default:
+			mr.heartbeat.Beat()
 			/*
 			 * start round queue takes precedent over the recieved answer queue
 			 * if no messages are queued, we will funnel to bottom most default where we sleep for the Broadcast interval
 			 */
-			startNewRoundMsg := mr.startRoundQueue.Pop()
-			if startNewRoundMsg != nil {
+			if !mr.Paused(constants.StartNewRound) {
+				startNewRoundMsg := mr.startRoundQueue.Pop()
+				if startNewRoundMsg != nil {
 
-				mr.broacast(*startNewRoundMsg)
+					mr.broacast(constants.StartNewRound, *startNewRoundMsg)
+				}
 			}
-			recievedAnsMsg := mr.recievedAnswerQueue.Pop()
-			if recievedAnsMsg != nil {
-				mr.broacast(*recievedAnsMsg)
+			if !mr.Paused(constants.ReceivedAnswer) {
+				recievedAnsMsg := mr.recievedAnswerQueue.Pop()
+				if recievedAnsMsg != nil {
+					mr.broacast(constants.ReceivedAnswer, *recievedAnsMsg)
+				}
 			}
-			mr.skippedMsgCount += mr.recievedAnswerQueue.Resize()
-			mr.skippedMsgCount += mr.startRoundQueue.Resize()
+			mr.stats.discarded(constants.ReceivedAnswer, mr.recievedAnswerQueue.Resize())
+			mr.stats.discarded(constants.StartNewRound, mr.startRoundQueue.Resize())
 			time.Sleep(BroadcastInterval)
 		}
 	}
 }
 
-func (mr *MessageRelayer) broacast(msg constants.Message) {
-	var msgType constants.MessageType
-	if msg.Type == constants.StartNewRound || msg.Type == constants.All {
-		msgType = constants.StartNewRound
+// broacast delivers a message popped off the queue for msgType to every subscriber of that type or of a topic
+// pattern matching the message topic, and to one member of each matching subscriber group, passing over
+// subscribers whose filter rejects it
+func (mr *MessageRelayer) broacast(msgType constants.MessageType, msg constants.Message) {
+	mr.subscribersMu.RLock()
+	subscriptions := mr.subscribers[msgType]
+	groups := make([]*subscriberGroup, 0, len(mr.groups[msgType]))
+	for _, group := range mr.groups[msgType] {
+		groups = append(groups, group)
 	}
-	if msg.Type == constants.ReceivedAnswer || msg.Type == constants.All {
-		msgType = constants.ReceivedAnswer
-	}
-	subscriberChannels := mr.subscribers[msgType]
-	log.Printf("🔊  broadcasting %v message", msgType.String())
-	for _, subscriberChannel := range subscriberChannels {
-		if utils.ChannelIsFull(subscriberChannel) {
-			mr.skippedMsgCount++
-			log.Printf("subscriber busy: detected full StartNewRound subscriber channel: skipping broadcast")
+	// a message of type All with its own topic sits in both queues, topic subscribers only get it once
+	if msg.Topic == "" || msg.Type != constants.All || msgType == constants.ReceivedAnswer {
+		subscriptions, groups = mr.topics.match(topic.Split(broadcastTopic(msgType, msg)), subscriptions[:len(subscriptions):len(subscriptions)], groups)
+	}
+	mr.subscribersMu.RUnlock()
+	msg, span := mr.traceBroadcast(msgType, msg)
+	defer endSpan(span)
+	mr.hotLogger.Debug("broadcasting message", logging.TypeKey, msgType, logging.MessageIDKey, msg.ID)
+	mr.latencies.observeSince(mr.latencies.queueWait, msgType, msg.EnqueuedAt)
+	defer mr.latencies.observeSince(mr.latencies.broadcast, msgType, time.Now())
+	chain := mr.chain(DeliveryStage)
+	if msg.Headers[compress.EncodingHeader] != "" {
+		// in-process subscribers get plain data, sinks compress it again on their way out
+		chain = append(middleware.Chain{mr.decompressor.Decompressing()}, chain...)
+	}
+	for _, msg := range mr.intercept(DeliveryStage, chain, msg) {
+		for _, sub := range subscriptions {
+			if !sub.accepts(msg) {
+				mr.stats.filtered(msgType, sub.name)
+				continue
+			}
+			mr.deliver(msgType, sub, msg)
+		}
+		for _, group := range groups {
+			member, matched := mr.pick(group, msg)
+			if !matched {
+				mr.stats.filtered(msgType, group.name)
+				continue
+			}
+			if member.ch == nil {
+				mr.stats.skipped(msgType, group.name)
+				mr.hotLogger.Warn("subscriber group busy, skipping message", logging.GroupKey, group.name, logging.TypeKey, msgType, logging.MessageIDKey, msg.ID)
+				continue
+			}
+			mr.deliver(msgType, member, msg)
+		}
+	}
+}
+
+// deliver sends msg to a subscriber after running it through the subscriber's interceptors
+func (mr *MessageRelayer) deliver(msgType constants.MessageType, sub subscription, msg constants.Message) {
+	for _, msg := range mr.intercept(subscriberStage, sub.interceptors, msg) {
+		msg.DeliveredAt = time.Now()
+		if !mr.send(sub.ch, msg) {
+			mr.stats.skipped(msgType, sub.name)
+			mr.hotLogger.Warn("subscriber busy, skipping message", logging.SubscriberKey, sub.name, logging.TypeKey, msgType, logging.MessageIDKey, msg.ID)
 			continue
 		}
-		mr.broadcastedMsgsCount++
-		subscriberChannel <- msg
+		mr.stats.broadcasted(msgType, sub.name)
+		mr.latencies.observeSince(mr.latencies.delivery, msgType, msg.EnqueuedAt)
+	}
+}
+
+// pick picks the group member receiving msg. While draining it retries until the drain deadline when every eligible
+// member is busy.
+func (mr *MessageRelayer) pick(group *subscriberGroup, msg constants.Message) (subscription, bool) {
+	member, matched := group.pick(msg)
+	for matched && member.ch == nil && !mr.drainDeadline.IsZero() && time.Now().Before(mr.drainDeadline) {
+		time.Sleep(drainRetryInterval)
+		member, matched = group.pick(msg)
+	}
+	return member, matched
+}
+
+// send hands msg to ch when it has room. While draining it waits for room until the drain deadline instead, so a
+// slow subscriber still gets the messages flushed on shutdown.
+func (mr *MessageRelayer) send(ch chan constants.Message, msg constants.Message) bool {
+	select {
+	case ch <- msg:
+		return true
+	default:
+	}
+	if mr.drainDeadline.IsZero() {
+		return false
+	}
+	timer := time.NewTimer(time.Until(mr.drainDeadline))
+	defer timer.Stop()
+	select {
+	case ch <- msg:
+		return true
+	case <-timer.C:
+		return false
 	}
 }
 
+// unroutable discards a message that can't be queued, counting it and logging why
+func (mr *MessageRelayer) unroutable(msg constants.Message, reason string) {
+	mr.stats.unroutable.Add(1)
+	mr.hotLogger.Warn("discarding unroutable message", logging.MessageIDKey, msg.ID, logging.TopicKey, msg.Topic, "reason", reason)
+}
+
 // Read calls the underlying network socket's read method
-func (mr MessageRelayer) Read() (constants.Message, error) {
+func (mr *MessageRelayer) Read() (constants.Message, error) {
 	return mr.socket.Read()
 }
 
-// Enqueue takes an incoming message and adds it to the message relayer's broadcasting queues
+// Enqueue takes an incoming message and adds it to the message relayer's broadcasting queues. A message
+// published to a topic under constants.StartNewRoundTopic or constants.ReceivedAnswerTopic is queued as that type.
+// Messages with an invalid topic (see topic.Validate) or that belong to neither queue are discarded and counted as
+// unroutable.
+// The message is run through the EnqueueStage interceptors first and every message they return is queued.
+// Messages without an ID are given a random one.
 func (mr *MessageRelayer) Enqueue(msg constants.Message) {
+	msg.EnqueuedAt = time.Now()
+	if msg.ID == "" {
+		msg.ID = newMessageID()
+	}
+	msg, span := mr.traceEnqueue(msg)
+	defer endSpan(span)
+	for _, msg := range mr.intercept(EnqueueStage, mr.chain(EnqueueStage), msg) {
+		mr.enqueue(msg)
+	}
+}
+
+func (mr *MessageRelayer) enqueue(msg constants.Message) {
+	if msg.Topic != "" {
+		if err := topic.Validate(msg.Topic); err != nil {
+			mr.unroutable(msg, err.Error())
+			return
+		}
+		if t := constants.TypeOfTopic(msg.Topic); t != 0 {
+			msg.Type = t
+		}
+	}
+	if msg.Type != constants.ReceivedAnswer && msg.Type != constants.StartNewRound && msg.Type != constants.All {
+		mr.unroutable(msg, "no queue for its type or topic")
+		return
+	}
 	if msg.Type == constants.ReceivedAnswer || msg.Type == constants.All {
 		mr.recievedAnswerQueue.Push(msg)
-		mr.queuesMsgsCount++
-		log.Println("⤴️  added new message to recieved answer queue")
+		mr.stats.queued(constants.ReceivedAnswer)
+		mr.hotLogger.Debug("queued message", logging.TypeKey, constants.ReceivedAnswer, logging.MessageIDKey, msg.ID)
 	}
 	if msg.Type == constants.StartNewRound || msg.Type == constants.All {
 		mr.startRoundQueue.Push(msg)
-		mr.queuesMsgsCount++
-		log.Println("⤴️  added new message to start round queue")
+		mr.stats.queued(constants.StartNewRound)
+		mr.hotLogger.Debug("queued message", logging.TypeKey, constants.StartNewRound, logging.MessageIDKey, msg.ID)
 	}
 }
 
 // SubscribeToMessages registers a new subscriber to a message relayers broadcasting queues
-func (mr *MessageRelayer) SubscribeToMessages(msgType constants.MessageType, ch chan constants.Message) {
-	if msgType == constants.All {
-		mr.subscribers[constants.ReceivedAnswer] = append(mr.subscribers[constants.ReceivedAnswer], ch)
-		mr.subscribers[constants.StartNewRound] = append(mr.subscribers[constants.StartNewRound], ch)
+func (mr *MessageRelayer) SubscribeToMessages(msgType constants.MessageType, ch chan constants.Message, opts ...SubscribeOption) {
+	options := subscribeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	mr.subscribersMu.Lock()
+	defer mr.subscribersMu.Unlock()
+	for _, t := range expandType(msgType) {
+		sub := newSubscription(ch, options)
+		if options.group == "" {
+			mr.subscribers[t] = append(mr.subscribers[t], sub)
+			continue
+		}
+		if mr.groups[t] == nil {
+			mr.groups[t] = make(map[string]*subscriberGroup)
+		}
+		mr.joinGroup(mr.groups[t], options, sub)
+	}
+}
+
+// joinGroup adds sub to the group named in options, creating the group when it does not exist yet
+func (mr *MessageRelayer) joinGroup(groups map[string]*subscriberGroup, options subscribeOptions, sub subscription) {
+	group, ok := groups[options.group]
+	if !ok {
+		group = newSubscriberGroup(options.group, options.strategy)
+		groups[options.group] = group
+	} else if group.strategy != options.strategy {
+		mr.logger.Warn("subscriber group already uses another strategy, ignoring the requested one",
+			logging.GroupKey, options.group, "strategy", group.strategy.String(), "requested", options.strategy.String())
+	}
+	group.add(sub)
+}
+
+// SubscribeToTopic registers a new subscriber to the messages whose topic matches pattern, a dotted topic name
+// where a * token matches any single token and a trailing > token matches one or more tokens. Messages without
+// a topic are matched on the root topic of their type, see constants.MessageType.Topic.
+func (mr *MessageRelayer) SubscribeToTopic(pattern string, ch chan constants.Message, opts ...SubscribeOption) error {
+	if err := topic.ValidatePattern(pattern); err != nil {
+		return err
+	}
+	options := subscribeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	mr.subscribersMu.Lock()
+	defer mr.subscribersMu.Unlock()
+	node := mr.topics.node(topic.Split(pattern), true)
+	sub := newSubscription(ch, options)
+	if options.group == "" {
+		node.subs = append(node.subs, sub)
+		return nil
+	}
+	mr.joinGroup(node.groups, options, sub)
+	return nil
+}
+
+// UnsubscribeFromTopic removes a channel previously registered with SubscribeToTopic for pattern
+func (mr *MessageRelayer) UnsubscribeFromTopic(pattern string, ch chan constants.Message) {
+	mr.subscribersMu.Lock()
+	defer mr.subscribersMu.Unlock()
+	tokens := topic.Split(pattern)
+	node := mr.topics.node(tokens, false)
+	if node == nil {
 		return
 	}
-	mr.subscribers[msgType] = append(mr.subscribers[msgType], ch)
+	node.subs = removeSubscription(node.subs, ch)
+	for name, group := range node.groups {
+		if group.remove(ch) {
+			delete(node.groups, name)
+		}
+	}
+	mr.topics.prune(tokens)
+}
+
+// expandType returns the queue message types a subscription to msgType covers
+func expandType(msgType constants.MessageType) []constants.MessageType {
+	if msgType == constants.All {
+		return []constants.MessageType{constants.ReceivedAnswer, constants.StartNewRound}
+	}
+	return []constants.MessageType{msgType}
+}
+
+// UnsubscribeFromMessages removes a channel previously registered with SubscribeToMessages, including from any
+// subscriber group it joined
+func (mr *MessageRelayer) UnsubscribeFromMessages(msgType constants.MessageType, ch chan constants.Message) {
+	mr.subscribersMu.Lock()
+	defer mr.subscribersMu.Unlock()
+	for _, t := range expandType(msgType) {
+		mr.subscribers[t] = removeSubscription(mr.subscribers[t], ch)
+		for name, group := range mr.groups[t] {
+			if group.remove(ch) {
+				delete(mr.groups[t], name)
+			}
+		}
+	}
+}
+
+// subscription is a subscriber channel and the optional filter messages must match to be delivered to it
+type subscription struct {
+	name         string
+	ch           chan constants.Message
+	filter       filter.Filter
+	interceptors middleware.Chain
+}
+
+func newSubscription(ch chan constants.Message, options subscribeOptions) subscription {
+	name := options.name
+	if name == "" {
+		name = fmt.Sprintf("%p", ch)
+	}
+	return subscription{name: name, ch: ch, filter: options.filter, interceptors: options.interceptors}
+}
+
+func (s subscription) accepts(msg constants.Message) bool {
+	return s.filter == nil || s.filter.Match(msg)
+}
+
+// removeSubscription returns a copy of subs without ch so broadcasts iterating the previous slice are unaffected
+func removeSubscription(subs []subscription, ch chan constants.Message) []subscription {
+	remaining := make([]subscription, 0, len(subs))
+	for _, s := range subs {
+		if s.ch != ch {
+			remaining = append(remaining, s)
+		}
+	}
+	return remaining
+}
+
+// queue returns the broadcast queue of msgType
+func (mr *MessageRelayer) queue(msgType constants.MessageType) *LinkedMsgList {
+	if msgType == constants.StartNewRound {
+		return mr.startRoundQueue
+	}
+	return mr.recievedAnswerQueue
+}
+
+// Saturated reports whether the queue for the provided message type has reached its desired size, meaning
+// newly enqueued messages will push older ones out
+func (mr *MessageRelayer) Saturated(msgType constants.MessageType) bool {
+	if msgType == constants.All {
+		return mr.Saturated(constants.StartNewRound) || mr.Saturated(constants.ReceivedAnswer)
+	}
+	return mr.queue(msgType).Full()
+}
+
+// Space returns how many more messages the queue for the provided message type holds before newly enqueued
+// messages push older ones out, the smaller of both queues for All
+func (mr *MessageRelayer) Space(msgType constants.MessageType) int {
+	if msgType == constants.All {
+		startRound, answer := mr.Space(constants.StartNewRound), mr.Space(constants.ReceivedAnswer)
+		if startRound < answer {
+			return startRound
+		}
+		return answer
+	}
+	return mr.queue(msgType).Space()
 }
 
 // DoneChannel returns the message relayers done channel for the parent process to wait for it to complete
 // before closing
-func (mr MessageRelayer) DoneChannel() chan bool {
+func (mr *MessageRelayer) DoneChannel() chan bool {
 	return mr.done
 }
 
+// Heartbeat returns the probe the broadcast loop beats on every pass, so a stalled loop can be detected
+func (mr *MessageRelayer) Heartbeat() *health.Heartbeat {
+	return mr.heartbeat
+}
+
+// SetLogger replaces the logger of the relayer, records written for every message are sampled. It must be called
+// before Start.
+func (mr *MessageRelayer) SetLogger(logger logging.Logger) {
+	mr.logger = logger
+	mr.hotLogger = logging.Sampled(logger)
+}
+
+// newMessageID returns a random 16 character hex ID
+func newMessageID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
 // Summary returns the WorkSummary of the message relayer
-func (mr MessageRelayer) Summary() WorkSummary {
-	return WorkSummary{
-		QueuedMsgs:      mr.queuesMsgsCount,
-		BroadcastedMsgs: mr.broadcastedMsgsCount,
-		DiscardedMsgs:   mr.discardedMsgsCount,
-		SkippedMsgs:     mr.skippedMsgCount,
-	}
+func (mr *MessageRelayer) Summary() WorkSummary {
+	summary := mr.stats.summary()
+	summary.Decompression = mr.decompressor.Stats()
+	return summary
 }
@@ -0,0 +1,348 @@
+package relayer
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/metrics"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// stats tracks the work of a relayer per message type and per subscriber, it is safe for concurrent use. Counters
+// are atomic so recording never waits on readers, mu only guards creating the counters of a new type, subscriber
+// or interceptor.
+type stats struct {
+	mu                sync.RWMutex
+	byType            map[constants.MessageType]*typeStats
+	bySubscriber      map[subscriberKey]*subscriberStats
+	dropped           atomic.Int64
+	unroutable        atomic.Int64
+	interceptorErrors map[string]*atomic.Int64
+}
+
+type typeStats struct {
+	queued      atomic.Int64
+	broadcasted atomic.Int64
+	discarded   atomic.Int64
+	skipped     atomic.Int64
+	filtered    atomic.Int64
+}
+
+type subscriberKey struct {
+	name    string
+	msgType constants.MessageType
+}
+
+type subscriberStats struct {
+	delivered atomic.Int64
+	skipped   atomic.Int64
+	filtered  atomic.Int64
+}
+
+// TypeStats counts the work a relayer did for a message type
+type TypeStats struct {
+	Queued      int `json:"queued"`      // added to the queue
+	Broadcasted int `json:"broadcasted"` // delivered to a subscriber
+	Discarded   int `json:"discarded"`   // removed from the queue before being broadcast, because it was full or purged
+	Skipped     int `json:"skipped"`     // not delivered to a subscriber that was busy
+	Filtered    int `json:"filtered"`    // not delivered to a subscriber whose filter rejected it
+}
+
+// SubscriberStats counts the messages of a type a subscriber was sent
+type SubscriberStats struct {
+	Delivered int `json:"delivered"`
+	Skipped   int `json:"skipped"`
+	Filtered  int `json:"filtered"`
+}
+
+// StatsSnapshot is a point in time copy of a relayer's counters
+type StatsSnapshot struct {
+	Types map[constants.MessageType]TypeStats `json:"types"`
+	// Subscribers holds the counters of every subscriber by name and message type, subscriber groups are counted
+	// under their group name when no member could take a message
+	Subscribers       map[string]map[constants.MessageType]SubscriberStats `json:"subscribers"`
+	Dropped           int                                                  `json:"dropped"`    // dropped by an interceptor
+	Unroutable        int                                                  `json:"unroutable"` // discarded on enqueue, invalid topic or no queue
+	InterceptorErrors map[string]int                                       `json:"interceptor_errors"`
+}
+
+func newStats() *stats {
+	return &stats{
+		byType:            make(map[constants.MessageType]*typeStats),
+		bySubscriber:      make(map[subscriberKey]*subscriberStats),
+		interceptorErrors: make(map[string]*atomic.Int64),
+	}
+}
+
+// typeStats returns the counters of msgType, creating them when missing
+func (s *stats) typeStats(msgType constants.MessageType) *typeStats {
+	s.mu.RLock()
+	ts, ok := s.byType[msgType]
+	s.mu.RUnlock()
+	if ok {
+		return ts
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ts, ok = s.byType[msgType]; !ok {
+		ts = &typeStats{}
+		s.byType[msgType] = ts
+	}
+	return ts
+}
+
+// subscriberStats returns the counters of a subscriber for msgType, creating them when missing
+func (s *stats) subscriberStats(name string, msgType constants.MessageType) *subscriberStats {
+	key := subscriberKey{name: name, msgType: msgType}
+	s.mu.RLock()
+	ss, ok := s.bySubscriber[key]
+	s.mu.RUnlock()
+	if ok {
+		return ss
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ss, ok = s.bySubscriber[key]; !ok {
+		ss = &subscriberStats{}
+		s.bySubscriber[key] = ss
+	}
+	return ss
+}
+
+func (s *stats) queued(msgType constants.MessageType) {
+	s.typeStats(msgType).queued.Add(1)
+}
+
+func (s *stats) broadcasted(msgType constants.MessageType, subscriber string) {
+	s.typeStats(msgType).broadcasted.Add(1)
+	s.subscriberStats(subscriber, msgType).delivered.Add(1)
+}
+
+// discarded counts queued messages removed before they were broadcast
+func (s *stats) discarded(msgType constants.MessageType, count int) {
+	if count == 0 {
+		return
+	}
+	s.typeStats(msgType).discarded.Add(int64(count))
+}
+
+// skipped counts a message a busy subscriber missed
+func (s *stats) skipped(msgType constants.MessageType, subscriber string) {
+	s.typeStats(msgType).skipped.Add(1)
+	s.subscriberStats(subscriber, msgType).skipped.Add(1)
+}
+
+func (s *stats) filtered(msgType constants.MessageType, subscriber string) {
+	s.typeStats(msgType).filtered.Add(1)
+	s.subscriberStats(subscriber, msgType).filtered.Add(1)
+}
+
+func (s *stats) interceptorResult(stage Stage, failed []string, dropped int) {
+	for _, name := range failed {
+		key := stage.String() + "/" + name
+		s.mu.Lock()
+		counter, ok := s.interceptorErrors[key]
+		if !ok {
+			counter = &atomic.Int64{}
+			s.interceptorErrors[key] = counter
+		}
+		s.mu.Unlock()
+		counter.Add(1)
+	}
+	s.dropped.Add(int64(dropped))
+}
+
+// snapshot copies the counters
+func (s *stats) snapshot() StatsSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := StatsSnapshot{
+		Types:             make(map[constants.MessageType]TypeStats, len(s.byType)),
+		Subscribers:       make(map[string]map[constants.MessageType]SubscriberStats),
+		Dropped:           int(s.dropped.Load()),
+		Unroutable:        int(s.unroutable.Load()),
+		InterceptorErrors: make(map[string]int, len(s.interceptorErrors)),
+	}
+	for t, ts := range s.byType {
+		snapshot.Types[t] = TypeStats{
+			Queued:      int(ts.queued.Load()),
+			Broadcasted: int(ts.broadcasted.Load()),
+			Discarded:   int(ts.discarded.Load()),
+			Skipped:     int(ts.skipped.Load()),
+			Filtered:    int(ts.filtered.Load()),
+		}
+	}
+	for key, ss := range s.bySubscriber {
+		if snapshot.Subscribers[key.name] == nil {
+			snapshot.Subscribers[key.name] = make(map[constants.MessageType]SubscriberStats)
+		}
+		snapshot.Subscribers[key.name][key.msgType] = SubscriberStats{
+			Delivered: int(ss.delivered.Load()),
+			Skipped:   int(ss.skipped.Load()),
+			Filtered:  int(ss.filtered.Load()),
+		}
+	}
+	for name, counter := range s.interceptorErrors {
+		snapshot.InterceptorErrors[name] = int(counter.Load())
+	}
+	return snapshot
+}
+
+// summary totals a snapshot of the counters over every message type
+func (s *stats) summary() WorkSummary {
+	snapshot := s.snapshot()
+	summary := WorkSummary{
+		DiscardedMsgs:     snapshot.Unroutable,
+		DroppedMsgs:       snapshot.Dropped,
+		InterceptorErrors: snapshot.InterceptorErrors,
+	}
+	for _, ts := range snapshot.Types {
+		summary.QueuedMsgs += ts.Queued
+		summary.BroadcastedMsgs += ts.Broadcasted
+		summary.DiscardedMsgs += ts.Discarded
+		summary.SkippedMsgs += ts.Skipped
+		summary.FilteredMsgs += ts.Filtered
+	}
+	return summary
+}
+
+// families returns a snapshot of the counters as metric families
+func (s *stats) families() []metrics.Family {
+	snapshot := s.snapshot()
+	types := make([]constants.MessageType, 0, len(snapshot.Types))
+	for t := range snapshot.Types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	perType := func(name string, help string, value func(TypeStats) int) metrics.Family {
+		f := metrics.Family{Name: name, Help: help, Type: metrics.Counter}
+		for _, t := range types {
+			f.Samples = append(f.Samples, metrics.Sample{Labels: typeLabel(t), Value: float64(value(snapshot.Types[t]))})
+		}
+		return f
+	}
+	keys := make([]subscriberKey, 0, len(snapshot.Subscribers))
+	for name, byType := range snapshot.Subscribers {
+		for t := range byType {
+			keys = append(keys, subscriberKey{name: name, msgType: t})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].msgType < keys[j].msgType
+	})
+	perSubscriber := func(name string, help string, value func(SubscriberStats) int) metrics.Family {
+		f := metrics.Family{Name: name, Help: help, Type: metrics.Counter}
+		for _, key := range keys {
+			labels := append([]metrics.Label{{Name: "subscriber", Value: key.name}}, typeLabel(key.msgType)...)
+			f.Samples = append(f.Samples, metrics.Sample{Labels: labels, Value: float64(value(snapshot.Subscribers[key.name][key.msgType]))})
+		}
+		return f
+	}
+	errorNames := make([]string, 0, len(snapshot.InterceptorErrors))
+	for name := range snapshot.InterceptorErrors {
+		errorNames = append(errorNames, name)
+	}
+	sort.Strings(errorNames)
+	interceptorErrors := metrics.Family{Name: "relayer_interceptor_errors_total", Help: "Messages dropped because an interceptor failed.", Type: metrics.Counter}
+	for _, name := range errorNames {
+		interceptorErrors.Samples = append(interceptorErrors.Samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "interceptor", Value: name}},
+			Value:  float64(snapshot.InterceptorErrors[name]),
+		})
+	}
+	return []metrics.Family{
+		perType("relayer_queued_messages_total", "Messages added to a broadcast queue.", func(ts TypeStats) int { return ts.Queued }),
+		perType("relayer_broadcast_messages_total", "Messages delivered to a subscriber.", func(ts TypeStats) int { return ts.Broadcasted }),
+		perType("relayer_discarded_messages_total", "Messages removed from a queue before being broadcast, because it was full or purged.", func(ts TypeStats) int { return ts.Discarded }),
+		perType("relayer_skipped_messages_total", "Messages a busy subscriber missed.", func(ts TypeStats) int { return ts.Skipped }),
+		perType("relayer_filtered_messages_total", "Messages a subscriber filter rejected.", func(ts TypeStats) int { return ts.Filtered }),
+		perSubscriber("relayer_subscriber_delivered_messages_total", "Messages delivered to the subscriber.", func(ss SubscriberStats) int { return ss.Delivered }),
+		perSubscriber("relayer_subscriber_skipped_messages_total", "Messages the subscriber missed while busy.", func(ss SubscriberStats) int { return ss.Skipped }),
+		perSubscriber("relayer_subscriber_filtered_messages_total", "Messages the subscriber filter rejected.", func(ss SubscriberStats) int { return ss.Filtered }),
+		{Name: "relayer_unroutable_messages_total", Help: "Messages discarded on enqueue because their topic was invalid or matched no queue.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: float64(snapshot.Unroutable)}}},
+		{Name: "relayer_interceptor_dropped_messages_total", Help: "Messages an interceptor dropped.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: float64(snapshot.Dropped)}}},
+		interceptorErrors,
+	}
+}
+
+func typeLabel(msgType constants.MessageType) []metrics.Label {
+	return []metrics.Label{{Name: "type", Value: typeName(msgType)}}
+}
+
+// typeName returns the wire name of msgType
+func typeName(msgType constants.MessageType) string {
+	name, err := msgType.MarshalText()
+	if err != nil {
+		return msgType.String()
+	}
+	return string(name)
+}
+
+// Stats returns a snapshot of the relayer's counters by message type and by subscriber
+func (mr *MessageRelayer) Stats() StatsSnapshot {
+	return mr.stats.snapshot()
+}
+
+// Collect returns the relayer's counters, the depth of its queues, the buffer fill of its subscribers and the work
+// spent decompressing as metric families so the relayer can be registered with a metrics.Registry
+func (mr *MessageRelayer) Collect() []metrics.Family {
+	depth := metrics.Family{Name: "relayer_queue_depth", Help: "Messages waiting in a broadcast queue.", Type: metrics.Gauge}
+	for _, t := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer} {
+		depth.Samples = append(depth.Samples, metrics.Sample{Labels: typeLabel(t), Value: float64(mr.queue(t).Size())})
+	}
+	fill := metrics.Family{Name: "relayer_subscriber_buffer_fill_ratio", Help: "Fill level of a subscriber channel between 0 and 1.", Type: metrics.Gauge}
+	for _, sub := range mr.subscriptions() {
+		fill.Samples = append(fill.Samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "subscriber", Value: sub.name}},
+			Value:  load(sub.ch),
+		})
+	}
+	decompression := mr.decompressor.Stats()
+	decompressed := metrics.Family{Name: "relayer_decompressed_messages_total", Help: "Compressed messages decompressed before delivery.", Type: metrics.Counter,
+		Samples: []metrics.Sample{{Value: float64(decompression.Decompressed)}}}
+	decompressTime := metrics.Family{Name: "relayer_decompress_seconds_total", Help: "Time spent decompressing messages before delivery.", Type: metrics.Counter,
+		Samples: []metrics.Sample{{Value: decompression.DecompressTime.Seconds()}}}
+	return append(append(mr.stats.families(), depth, fill, decompressed, decompressTime), mr.Latency().families()...)
+}
+
+// subscriptions returns every registered subscription once, sorted by name
+func (mr *MessageRelayer) subscriptions() []subscription {
+	mr.subscribersMu.RLock()
+	defer mr.subscribersMu.RUnlock()
+	seen := map[chan constants.Message]bool{}
+	subs := []subscription{}
+	add := func(sub subscription) {
+		if !seen[sub.ch] {
+			seen[sub.ch] = true
+			subs = append(subs, sub)
+		}
+	}
+	addGroup := func(group *subscriberGroup) {
+		group.mu.Lock()
+		for _, member := range group.members {
+			add(member)
+		}
+		group.mu.Unlock()
+	}
+	for _, t := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer} {
+		for _, sub := range mr.subscribers[t] {
+			add(sub)
+		}
+		for _, group := range mr.groups[t] {
+			addGroup(group)
+		}
+	}
+	mr.topics.walk(func(n *topicNode) {
+		for _, sub := range n.subs {
+			add(sub)
+		}
+		for _, group := range n.groups {
+			addGroup(group)
+		}
+	})
+	sort.Slice(subs, func(i, j int) bool { return subs[i].name < subs[j].name })
+	return subs
+}
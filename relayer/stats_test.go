@@ -0,0 +1,77 @@
+package relayer_test
+
+import (
+	"bytes"
+	"messagerelayer/constants"
+	"messagerelayer/metrics"
+	"messagerelayer/relayer"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayerMetrics(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	fast := make(chan constants.Message, 10)
+	slow := make(chan constants.Message, 1)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, fast, relayer.Named("fast"))
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, slow, relayer.Named("slow"))
+	relay(msgrelayer, answers(3, nil))
+	msgrelayer.Enqueue(constants.Message{Type: constants.StartNewRound})
+	registry := metrics.NewRegistry()
+	registry.Register(msgrelayer)
+	var out bytes.Buffer
+	assert.Nil(t, registry.WriteText(&out), "write err is nil")
+	text := out.String()
+	for _, line := range []string{
+		`relayer_queued_messages_total{type="StartNewRound"} 1`,
+		`relayer_queued_messages_total{type="ReceivedAnswer"} 3`,
+		`relayer_broadcast_messages_total{type="ReceivedAnswer"} 4`,
+		`relayer_skipped_messages_total{type="ReceivedAnswer"} 2`,
+		`relayer_subscriber_delivered_messages_total{subscriber="fast",type="ReceivedAnswer"} 3`,
+		`relayer_subscriber_delivered_messages_total{subscriber="slow",type="ReceivedAnswer"} 1`,
+		`relayer_subscriber_skipped_messages_total{subscriber="slow",type="ReceivedAnswer"} 2`,
+		`relayer_queue_depth{type="StartNewRound"} 1`,
+		`relayer_queue_depth{type="ReceivedAnswer"} 0`,
+		`relayer_subscriber_buffer_fill_ratio{subscriber="fast"} 0.3`,
+		`relayer_subscriber_buffer_fill_ratio{subscriber="slow"} 1`,
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+}
+
+func TestStatsSnapshot(t *testing.T) {
+	relayer.QueueSize = 3
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	relayer.QueueSize = 50
+	busy := make(chan constants.Message, 1)
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, busy, relayer.Named("busy"))
+	relay(msgrelayer, answers(5, nil))
+	snapshot := msgrelayer.Stats()
+	// the first pass pops one answer then trims the queue below its size, the two left find the subscriber busy
+	assert.Equal(t, relayer.TypeStats{Queued: 5, Broadcasted: 1, Discarded: 2, Skipped: 2}, snapshot.Types[constants.ReceivedAnswer], "queue overflow is discarded, busy subscriber is skipped")
+	assert.Equal(t, relayer.SubscriberStats{Delivered: 1, Skipped: 2}, snapshot.Subscribers["busy"][constants.ReceivedAnswer], "subscriber counters")
+	summary := msgrelayer.Summary()
+	assert.Equal(t, 2, summary.DiscardedMsgs, "discarded total")
+	assert.Equal(t, 2, summary.SkippedMsgs, "skipped total")
+}
+
+func TestConcurrentStats(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				msgrelayer.Enqueue(constants.Message{Type: constants.All})
+				msgrelayer.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+	snapshot := msgrelayer.Stats()
+	assert.Equal(t, 800, snapshot.Types[constants.StartNewRound].Queued, "start round queued count")
+	assert.Equal(t, 800, snapshot.Types[constants.ReceivedAnswer].Queued, "recieved answer queued count")
+}
@@ -0,0 +1,102 @@
+package relayer
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/topic"
+	"strings"
+)
+
+// topicNode is a node of the trie topic subscriptions are stored in, keyed by pattern token so a broadcast only
+// walks the branches that can match its topic instead of testing every pattern
+type topicNode struct {
+	children map[string]*topicNode
+	subs     []subscription
+	groups   map[string]*subscriberGroup
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{
+		children: make(map[string]*topicNode),
+		groups:   make(map[string]*subscriberGroup),
+	}
+}
+
+// node returns the node for the pattern tokens, creating missing nodes when create is set
+func (n *topicNode) node(tokens []string, create bool) *topicNode {
+	for _, token := range tokens {
+		child, ok := n.children[token]
+		if !ok {
+			if !create {
+				return nil
+			}
+			child = newTopicNode()
+			n.children[token] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// match collects the subscriptions and groups of every pattern matching the topic tokens
+func (n *topicNode) match(tokens []string, subs []subscription, groups []*subscriberGroup) ([]subscription, []*subscriberGroup) {
+	if len(tokens) == 0 {
+		subs = append(subs, n.subs...)
+		for _, group := range n.groups {
+			groups = append(groups, group)
+		}
+		return subs, groups
+	}
+	if child, ok := n.children[tokens[0]]; ok {
+		subs, groups = child.match(tokens[1:], subs, groups)
+	}
+	if child, ok := n.children[topic.SingleWildcard]; ok {
+		subs, groups = child.match(tokens[1:], subs, groups)
+	}
+	if child, ok := n.children[topic.MultiWildcard]; ok {
+		subs = append(subs, child.subs...)
+		for _, group := range child.groups {
+			groups = append(groups, group)
+		}
+	}
+	return subs, groups
+}
+
+// prune removes the empty nodes along the pattern tokens
+func (n *topicNode) prune(tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	child, ok := n.children[tokens[0]]
+	if !ok {
+		return
+	}
+	child.prune(tokens[1:])
+	if len(child.children) == 0 && len(child.subs) == 0 && len(child.groups) == 0 {
+		delete(n.children, tokens[0])
+	}
+}
+
+// broadcastTopic returns the topic a message popped off the queue for msgType is matched against, messages
+// without a topic use the root topic of their queue
+func broadcastTopic(msgType constants.MessageType, msg constants.Message) string {
+	if msg.Topic != "" {
+		return msg.Topic
+	}
+	return msgType.Topic()
+}
+
+// walk calls fn for the node and every node below it
+func (n *topicNode) walk(fn func(*topicNode)) {
+	fn(n)
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
+
+// walkPatterns calls fn with the pattern of the node and of every node below it, tokens is the path to the node
+func (n *topicNode) walkPatterns(tokens []string, fn func(pattern string, n *topicNode)) {
+	fn(strings.Join(tokens, topic.Separator), n)
+	for token, child := range n.children {
+		child.walkPatterns(append(tokens[:len(tokens):len(tokens)], token), fn)
+	}
+}
@@ -0,0 +1,71 @@
+package relayer_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/relayer"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicSubscriptions(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	ethAnswers := make(chan constants.Message, 10)
+	allRounds := make(chan constants.Message, 10)
+	starts := make(chan constants.Message, 10)
+	legacy := make(chan constants.Message, 10)
+	assert.Nil(t, msgrelayer.SubscribeToTopic("round.answer.eth-usd.*", ethAnswers), "subscribe err is nil")
+	assert.Nil(t, msgrelayer.SubscribeToTopic("round.>", allRounds), "subscribe err is nil")
+	assert.Nil(t, msgrelayer.SubscribeToTopic("round.start", starts), "subscribe err is nil")
+	msgrelayer.SubscribeToMessages(constants.ReceivedAnswer, legacy)
+	relay(msgrelayer, []constants.Message{
+		{Topic: "round.answer.eth-usd.node7", Data: []byte("1")},
+		{Topic: "round.answer.btc-usd.node7", Data: []byte("2")},
+		{Type: constants.StartNewRound, Data: []byte("3")},
+		{Topic: "round.start.eth-usd", Data: []byte("4")},
+	})
+	assert.Equal(t, 1, len(ethAnswers), "single wildcard matches one node")
+	assert.Equal(t, 4, len(allRounds), "trailing wildcard matches every round topic")
+	assert.Equal(t, 1, len(starts), "exact pattern matches the untyped start round message only")
+	assert.Equal(t, 2, len(legacy), "answer topics are delivered to ReceivedAnswer subscribers")
+}
+
+func TestUnroutableMessages(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	for _, msg := range []constants.Message{
+		{Topic: "round.answer.*", Type: constants.ReceivedAnswer},
+		{Topic: "round..answer", Type: constants.ReceivedAnswer},
+		{Topic: "feeds.eth-usd"},
+		{},
+		{Topic: "feeds.eth-usd", Type: constants.ReceivedAnswer},
+	} {
+		msgrelayer.Enqueue(msg)
+	}
+	assert.Equal(t, 4, msgrelayer.Stats().Unroutable, "wildcard, empty token and untyped messages are unroutable")
+	assert.Equal(t, 4, msgrelayer.Summary().DiscardedMsgs, "unroutable messages are discarded")
+	assert.Equal(t, 1, msgrelayer.Summary().QueuedMsgs, "typed message with its own topic is queued")
+}
+
+func TestTopicGroupAndUnsubscribe(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	workerA := make(chan constants.Message, 10)
+	workerB := make(chan constants.Message, 10)
+	assert.Nil(t, msgrelayer.SubscribeToTopic("round.answer.>", workerA, relayer.InGroup("workers", relayer.RoundRobin)), "subscribe err is nil")
+	assert.Nil(t, msgrelayer.SubscribeToTopic("round.answer.>", workerB, relayer.InGroup("workers", relayer.RoundRobin)), "subscribe err is nil")
+	relay(msgrelayer, []constants.Message{
+		{Topic: "round.answer.eth-usd", Data: []byte("1")},
+		{Topic: "round.answer.eth-usd", Data: []byte("2")},
+	})
+	assert.Equal(t, 1, len(workerA), "worker a gets half")
+	assert.Equal(t, 1, len(workerB), "worker b gets half")
+	msgrelayer.UnsubscribeFromTopic("round.answer.>", workerA)
+	msgrelayer.UnsubscribeFromTopic("round.answer.>", workerB)
+	relay(msgrelayer, []constants.Message{{Topic: "round.answer.eth-usd", Data: []byte("3")}})
+	assert.Equal(t, 1, len(workerA), "unsubscribed worker a gets nothing more")
+	assert.Equal(t, 1, len(workerB), "unsubscribed worker b gets nothing more")
+}
+
+func TestInvalidTopicPattern(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	assert.NotNil(t, msgrelayer.SubscribeToTopic("round.>.eth-usd", make(chan constants.Message)), "> must be last")
+}
@@ -0,0 +1,74 @@
+package relayer
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/tracing"
+	"time"
+)
+
+// span attribute keys
+const (
+	messageIDAttribute   = "message.id"
+	messageTypeAttribute = "message.type"
+	subscriberAttribute  = "subscriber"
+)
+
+// SetTracer makes the relayer record spans for every hop of a message: relayer.enqueue, relayer.queue (the wait
+// until it was popped), relayer.broadcast and subscriber.process (from delivery until Ack). The trace continues
+// the context in a message's tracing.TraceparentHeader when it has one, and delivered messages carry the context of
+// their broadcast span so subscribers can continue it. A nil tracer disables tracing. It must be called before Start.
+func (mr *MessageRelayer) SetTracer(tracer *tracing.Tracer) {
+	mr.tracer = tracer
+}
+
+// startSpan starts a span for msg continuing the trace in its headers, it returns nil when tracing is disabled
+func (mr *MessageRelayer) startSpan(name string, msgType constants.MessageType, msg constants.Message, start time.Time) *tracing.ActiveSpan {
+	if mr.tracer == nil {
+		return nil
+	}
+	parent, _ := tracing.Extract(msg)
+	span := mr.tracer.Start(name, parent, start)
+	span.SetAttribute(messageIDAttribute, msg.ID)
+	span.SetAttribute(messageTypeAttribute, typeName(msgType))
+	return span
+}
+
+// traceEnqueue starts the enqueue span of msg and returns msg carrying its context
+func (mr *MessageRelayer) traceEnqueue(msg constants.Message) (constants.Message, *tracing.ActiveSpan) {
+	span := mr.startSpan("relayer.enqueue", msg.Type, msg, msg.EnqueuedAt)
+	if span == nil {
+		return msg, nil
+	}
+	return tracing.Inject(msg, span.Context()), span
+}
+
+// traceBroadcast records the queue wait of msg and starts its broadcast span, returning msg carrying its context
+func (mr *MessageRelayer) traceBroadcast(msgType constants.MessageType, msg constants.Message) (constants.Message, *tracing.ActiveSpan) {
+	if mr.tracer == nil {
+		return msg, nil
+	}
+	mr.startSpan("relayer.queue", msgType, msg, msg.EnqueuedAt).End()
+	span := mr.startSpan("relayer.broadcast", msgType, msg, time.Now())
+	return tracing.Inject(msg, span.Context()), span
+}
+
+// traceProcessed records the time subscriber spent processing msg
+func (mr *MessageRelayer) traceProcessed(subscriber string, msg constants.Message) {
+	start := processingStart(msg)
+	if start.IsZero() {
+		return
+	}
+	span := mr.startSpan("subscriber.process", msg.Type, msg, start)
+	if span == nil {
+		return
+	}
+	span.SetAttribute(subscriberAttribute, subscriber)
+	span.End()
+}
+
+// endSpan ends span when tracing is enabled
+func endSpan(span *tracing.ActiveSpan) {
+	if span != nil {
+		span.End()
+	}
+}
@@ -0,0 +1,66 @@
+package relayer_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/relayer"
+	"messagerelayer/tracing"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryExporter keeps exported spans in memory
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []tracing.Span
+}
+
+func (me *memoryExporter) Export(span tracing.Span) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.spans = append(me.spans, span)
+	return nil
+}
+
+func (me *memoryExporter) Close() error {
+	return nil
+}
+
+func (me *memoryExporter) byName() map[string]tracing.Span {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	spans := map[string]tracing.Span{}
+	for _, span := range me.spans {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTracePropagation(t *testing.T) {
+	exporter := &memoryExporter{}
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	msgrelayer.SetTracer(tracing.NewTracer(exporter))
+	ch := make(chan constants.Message, 1)
+	msgrelayer.SubscribeToMessages(constants.StartNewRound, ch)
+	source := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	relay(msgrelayer, []constants.Message{{Type: constants.StartNewRound, Headers: map[string]string{tracing.TraceparentHeader: source}}})
+	delivered := <-ch
+	msgrelayer.Ack("sub", delivered)
+
+	spans := exporter.byName()
+	assert.Equal(t, 4, len(spans), "a span per hop")
+	for _, name := range []string{"relayer.enqueue", "relayer.queue", "relayer.broadcast", "subscriber.process"} {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[name].TraceID, "%v continues the source trace", name)
+		assert.Equal(t, delivered.ID, spans[name].Attributes["message.id"], "%v message id", name)
+	}
+	enqueue := spans["relayer.enqueue"]
+	assert.Equal(t, "00f067aa0ba902b7", enqueue.ParentID, "enqueue is a child of the source span")
+	assert.Equal(t, enqueue.SpanID, spans["relayer.queue"].ParentID, "queue wait is a child of enqueue")
+	assert.Equal(t, enqueue.SpanID, spans["relayer.broadcast"].ParentID, "broadcast is a child of enqueue")
+	assert.Equal(t, spans["relayer.broadcast"].SpanID, spans["subscriber.process"].ParentID, "processing is a child of broadcast")
+	assert.Equal(t, "sub", spans["subscriber.process"].Attributes["subscriber"], "subscriber attribute")
+	sc, ok := tracing.Extract(delivered)
+	assert.True(t, ok, "delivered message carries a trace context")
+	assert.Equal(t, spans["relayer.broadcast"].SpanID, sc.String()[36:52], "delivered context is the broadcast span")
+}
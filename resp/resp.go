@@ -0,0 +1,110 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxBulkSize is the largest bulk string a client may send
+var MaxBulkSize = 1 << 20
+
+// MaxMultibulkLength is the largest number of arguments a client may send in a command
+var MaxMultibulkLength = 1024 * 1024
+
+// MaxInlineSize is the longest line a client may send, for inline commands and array or bulk headers
+var MaxInlineSize = 64 * 1024
+
+// readCommand reads a single client command, either a RESP array of bulk strings or an inline command
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 0 || count > MaxMultibulkLength {
+		return nil, fmt.Errorf("invalid multibulk length")
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) == 0 || header[0] != '$' {
+			return nil, fmt.Errorf("expected '$', got '%v'", header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > MaxBulkSize {
+			return nil, fmt.Errorf("invalid bulk length")
+		}
+		bulk := make([]byte, size+2)
+		if _, err := io.ReadFull(r, bulk); err != nil {
+			return nil, err
+		}
+		args = append(args, string(bulk[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line of at most MaxInlineSize bytes
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > MaxInlineSize {
+			return "", errors.New("too big inline request")
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return "", errors.New("unexpected end of command")
+			}
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// reply builders for the subset of RESP2 the server emits
+
+func simpleString(s string) []byte {
+	return []byte("+" + s + "\r\n")
+}
+
+func errorReply(msg string) []byte {
+	return []byte("-ERR " + msg + "\r\n")
+}
+
+func integer(n int) []byte {
+	return []byte(":" + strconv.Itoa(n) + "\r\n")
+}
+
+func bulkString(s string) []byte {
+	return []byte("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func nullBulkString() []byte {
+	return []byte("$-1\r\n")
+}
+
+// array encodes already encoded elements as a RESP array
+func array(elems ...[]byte) []byte {
+	out := []byte("*" + strconv.Itoa(len(elems)) + "\r\n")
+	for _, e := range elems {
+		out = append(out, e...)
+	}
+	return out
+}
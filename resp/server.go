@@ -0,0 +1,343 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/relayer"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ConnBufferSize is the number of broadcasts buffered per subscribed client before the relayer skips it
+var ConnBufferSize = 10
+
+// Server speaks the Redis pub/sub protocol in front of a message relayer
+type Server interface {
+	Start(context.Context)
+	ServeConn(context.Context, net.Conn)
+	DoneChannel() chan bool
+	SetLogger(logging.Logger)
+}
+
+// PubSubServer maps Redis channel names onto message types so Redis clients can PUBLISH into the relayer and
+// SUBSCRIBE to its broadcasts
+type PubSubServer struct {
+	addr     string
+	relayer  relayer.Relayer
+	channels map[string]constants.MessageType // channel name -> message type
+	names    []string                         // sorted channel names for deterministic pattern delivery
+	mu       sync.Mutex
+	clients  map[*client]bool
+	logger   logging.Logger
+	done     chan bool
+}
+
+// New returns a RESP server publishing to and subscribing from the provided relayer
+func New(addr string, msgRelayer relayer.Relayer, channels map[string]constants.MessageType) Server {
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &PubSubServer{
+		addr:     addr,
+		relayer:  msgRelayer,
+		channels: channels,
+		names:    names,
+		clients:  make(map[*client]bool),
+		logger:   logging.Default(),
+		done:     make(chan bool),
+	}
+}
+
+// Start accepts client connections on the configured address until the context is cancelled
+func (s *PubSubServer) Start(ctx context.Context) {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.logger.Error("resp server unable to listen", "addr", s.addr, logging.ErrorKey, err)
+		<-ctx.Done()
+		s.done <- true
+		return
+	}
+	s.logger.Info("resp server listening", "addr", s.addr)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.ServeConn(ctx, conn)
+		}
+	}()
+	<-ctx.Done()
+	s.logger.Info("closing resp server", "addr", s.addr)
+	listener.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.done <- true
+}
+
+// DoneChannel returns the servers done channel so the parent process can wait until it completes to exit
+func (s *PubSubServer) DoneChannel() chan bool {
+	return s.done
+}
+
+// SetLogger replaces the logger of the resp server, it must be called before Start
+func (s *PubSubServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+// ServeConn handles commands from a single client until it disconnects
+func (s *PubSubServer) ServeConn(ctx context.Context, conn net.Conn) {
+	c := &client{
+		server:   s,
+		conn:     conn,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+	c.bridge = relayer.NewBridge(s.relayer, constants.All, ConnBufferSize, c.forward)
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		c.bridge.Unsubscribe()
+		conn.Close()
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+	reader := bufio.NewReader(conn)
+	for ctx.Err() == nil {
+		args, err := readCommand(reader)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			c.write(errorReply("Protocol error: " + err.Error()))
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if quit := c.handle(args); quit {
+			return
+		}
+	}
+}
+
+// receivers counts the clients currently subscribed to a channel or pattern covering msgType
+func (s *PubSubServer) receivers(msgType constants.MessageType) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for c := range s.clients {
+		if c.receives(msgType) {
+			count++
+		}
+	}
+	return count
+}
+
+// client is a single connected Redis client
+type client struct {
+	server   *PubSubServer
+	conn     net.Conn
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	channels map[string]bool
+	patterns map[string]bool
+	bridge   *relayer.Bridge // subscribed while the client has subscriptions
+}
+
+func (c *client) write(reply []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write(reply)
+}
+
+func (c *client) subscriptionCount() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *client) handle(args []string) bool {
+	cmd := strings.ToUpper(args[0])
+	c.mu.Lock()
+	subscribed := c.subscriptionCount() > 0
+	c.mu.Unlock()
+	if subscribed {
+		switch cmd {
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT":
+		default:
+			c.write(errorReply(fmt.Sprintf("Can't execute '%v': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd))))
+			return false
+		}
+	}
+	switch cmd {
+	case "PING":
+		if subscribed {
+			payload := ""
+			if len(args) > 1 {
+				payload = args[1]
+			}
+			c.write(array(bulkString("pong"), bulkString(payload)))
+		} else if len(args) > 1 {
+			c.write(bulkString(args[1]))
+		} else {
+			c.write(simpleString("PONG"))
+		}
+	case "QUIT":
+		c.write(simpleString("OK"))
+		return true
+	case "COMMAND":
+		c.write(array())
+	case "PUBLISH":
+		c.publish(args[1:])
+	case "SUBSCRIBE":
+		c.subscribe(args[1:], false)
+	case "PSUBSCRIBE":
+		c.subscribe(args[1:], true)
+	case "UNSUBSCRIBE":
+		c.unsubscribe(args[1:], false)
+	case "PUNSUBSCRIBE":
+		c.unsubscribe(args[1:], true)
+	default:
+		c.write(errorReply(fmt.Sprintf("unknown command '%v'", args[0])))
+	}
+	return false
+}
+
+func (c *client) publish(args []string) {
+	if len(args) != 2 {
+		c.write(errorReply("wrong number of arguments for 'publish' command"))
+		return
+	}
+	msgType, ok := c.server.channels[args[0]]
+	if !ok {
+		c.write(errorReply(fmt.Sprintf("unknown channel '%v'", args[0])))
+		return
+	}
+	if c.server.relayer.Saturated(msgType) {
+		c.write(errorReply(fmt.Sprintf("%v queue is saturated", msgType)))
+		return
+	}
+	c.server.relayer.Enqueue(constants.Message{Type: msgType, Data: []byte(args[1])})
+	c.write(integer(c.server.receivers(msgType)))
+}
+
+func (c *client) subscribe(names []string, pattern bool) {
+	kind := "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+	if len(names) == 0 {
+		c.write(errorReply(fmt.Sprintf("wrong number of arguments for '%v' command", kind)))
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		if !pattern {
+			if _, ok := c.server.channels[name]; !ok {
+				c.write(errorReply(fmt.Sprintf("unknown channel '%v'", name)))
+				continue
+			}
+			c.channels[name] = true
+		} else {
+			c.patterns[name] = true
+		}
+		c.bridge.Subscribe()
+		c.write(array(bulkString(kind), bulkString(name), integer(c.subscriptionCount())))
+	}
+}
+
+func (c *client) unsubscribe(names []string, pattern bool) {
+	kind := "unsubscribe"
+	subs := c.channels
+	if pattern {
+		kind = "punsubscribe"
+		subs = c.patterns
+	}
+	c.mu.Lock()
+	if len(names) == 0 {
+		for name := range subs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		c.write(array(bulkString(kind), nullBulkString(), integer(c.subscriptionCount())))
+	}
+	for _, name := range names {
+		delete(subs, name)
+		c.write(array(bulkString(kind), bulkString(name), integer(c.subscriptionCount())))
+	}
+	empty := c.subscriptionCount() == 0
+	c.mu.Unlock()
+	if empty {
+		c.bridge.Unsubscribe()
+	}
+}
+
+// forward writes a broadcast to every channel and pattern of the client covering its type
+func (c *client) forward(msg constants.Message) {
+	for _, reply := range c.deliveries(msg) {
+		c.write(reply)
+	}
+}
+
+func (c *client) deliveries(msg constants.Message) [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var replies [][]byte
+	for _, name := range sortedKeys(c.channels) {
+		if relayer.Covers(c.server.channels[name], msg.Type) {
+			replies = append(replies, array(bulkString("message"), bulkString(name), bulkString(string(msg.Data))))
+		}
+	}
+	for _, pattern := range sortedKeys(c.patterns) {
+		for _, name := range c.server.names {
+			if matched, _ := path.Match(pattern, name); matched && relayer.Covers(c.server.channels[name], msg.Type) {
+				replies = append(replies, array(bulkString("pmessage"), bulkString(pattern), bulkString(name), bulkString(string(msg.Data))))
+			}
+		}
+	}
+	return replies
+}
+
+// receives reports whether the client is subscribed to a channel or pattern covering msgType
+func (c *client) receives(msgType constants.MessageType) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.channels {
+		if relayer.Covers(c.server.channels[name], msgType) {
+			return true
+		}
+	}
+	for pattern := range c.patterns {
+		for name, channelType := range c.server.channels {
+			if matched, _ := path.Match(pattern, name); matched && relayer.Covers(channelType, msgType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
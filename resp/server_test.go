@@ -0,0 +1,142 @@
+package resp_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/relayer"
+	"messagerelayer/resp"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Exit(code)
+}
+
+var channels = map[string]constants.MessageType{
+	"round.start":  constants.StartNewRound,
+	"round.answer": constants.ReceivedAnswer,
+}
+
+// testClient speaks RESP to a server over an in-memory connection
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func connect(ctx context.Context, server resp.Server) *testClient {
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(ctx, serverConn)
+	return &testClient{conn: clientConn, reader: bufio.NewReader(clientConn)}
+}
+
+func (tc *testClient) send(args ...string) {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%v\r\n", len(arg), arg)
+	}
+	tc.conn.Write([]byte(cmd))
+}
+
+// read decodes a single reply, flattening arrays into their elements
+func (tc *testClient) read() []string {
+	tc.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := tc.reader.ReadString('\n')
+	if err != nil {
+		return []string{"read error: " + err.Error()}
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch line[0] {
+	case '*':
+		count, _ := strconv.Atoi(line[1:])
+		var elems []string
+		for i := 0; i < count; i++ {
+			elems = append(elems, tc.read()...)
+		}
+		return elems
+	case '$':
+		size, _ := strconv.Atoi(line[1:])
+		if size < 0 {
+			return []string{"nil"}
+		}
+		bulk := make([]byte, size+2)
+		tc.reader.Read(bulk)
+		return []string{string(bulk[:size])}
+	}
+	return []string{line}
+}
+
+func TestPingAndPublish(t *testing.T) {
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := resp.New(":0", msgrelayer, channels)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := connect(ctx, server)
+	c.send("PING")
+	assert.Equal(t, []string{"+PONG"}, c.read())
+	c.send("PUBLISH", "round.start", "hello")
+	assert.Equal(t, []string{":0"}, c.read(), "no subscribers yet")
+	c.send("PUBLISH", "bogus", "hello")
+	assert.Equal(t, []string{"-ERR unknown channel 'bogus'"}, c.read())
+	c.send("GET", "key")
+	assert.Equal(t, []string{"-ERR unknown command 'GET'"}, c.read())
+	assert.Equal(t, 1, msgrelayer.Summary().QueuedMsgs, "queued message count")
+}
+
+func TestSubscribeReceivesBroadcasts(t *testing.T) {
+	relayer.BroadcastInterval = 0 * time.Second
+	msgrelayer := relayer.NewMessageRelayer(nil)
+	server := resp.New(":0", msgrelayer, channels)
+	ctx, cancel := context.WithCancel(context.Background())
+	go msgrelayer.Start(ctx)
+
+	subscriber := connect(ctx, server)
+	subscriber.send("SUBSCRIBE", "round.start")
+	assert.Equal(t, []string{"subscribe", "round.start", ":1"}, subscriber.read())
+	subscriber.send("PSUBSCRIBE", "round.*")
+	assert.Equal(t, []string{"psubscribe", "round.*", ":2"}, subscriber.read())
+	subscriber.send("PUBLISH", "round.start", "x")
+	assert.Equal(t, "-ERR Can't execute 'publish'", subscriber.read()[0][:28], "publish not allowed while subscribed")
+
+	publisher := connect(ctx, server)
+	publisher.send("PUBLISH", "round.start", "go")
+	assert.Equal(t, []string{":1"}, publisher.read())
+	assert.Equal(t, []string{"message", "round.start", "go"}, subscriber.read())
+	assert.Equal(t, []string{"pmessage", "round.*", "round.start", "go"}, subscriber.read())
+
+	publisher.send("PUBLISH", "round.answer", "42")
+	assert.Equal(t, []string{":1"}, publisher.read())
+	assert.Equal(t, []string{"pmessage", "round.*", "round.answer", "42"}, subscriber.read())
+
+	subscriber.send("UNSUBSCRIBE")
+	assert.Equal(t, []string{"unsubscribe", "round.start", ":1"}, subscriber.read())
+	subscriber.send("PUNSUBSCRIBE")
+	assert.Equal(t, []string{"punsubscribe", "round.*", ":0"}, subscriber.read())
+	publisher.send("PUBLISH", "round.start", "gone")
+	assert.Equal(t, []string{":0"}, publisher.read(), "no subscribers remain")
+	cancel()
+	<-msgrelayer.DoneChannel()
+}
+
+func TestRejectsOversizedCommands(t *testing.T) {
+	defer func(size int) { resp.MaxInlineSize = size }(resp.MaxInlineSize)
+	resp.MaxInlineSize = 24
+	server := resp.New(":0", relayer.NewMessageRelayer(nil), channels)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := connect(ctx, server)
+	go c.conn.Write([]byte("*99999999999999\r\n"))
+	assert.Equal(t, []string{"-ERR Protocol error: invalid multibulk length"}, c.read(), "huge multibulk count")
+	c = connect(ctx, server)
+	go c.conn.Write([]byte("PING " + strings.Repeat("x", 32) + "\r\n"))
+	assert.Equal(t, []string{"-ERR Protocol error: too big inline request"}, c.read(), "line over the limit")
+}
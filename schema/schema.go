@@ -0,0 +1,254 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema validates a message payload
+type Schema interface {
+	Validate(data []byte) error
+}
+
+// ValidationError describes why a payload does not satisfy a schema, Path is a JSON pointer to the offending value
+type ValidationError struct {
+	Path   string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Reason
+	}
+	return e.Path + ": " + e.Reason
+}
+
+// JSONSchema compiles a JSON Schema document. The supported keywords are type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minimum, maximum, minLength, maxLength and pattern, others are
+// ignored.
+func JSONSchema(document []byte) (Schema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("invalid json schema: %w", err)
+	}
+	return compile(doc, "")
+}
+
+// node is a compiled schema object
+type node struct {
+	types                []string
+	enum                 []interface{}
+	properties           map[string]*node
+	required             []string
+	additionalProperties *bool
+	items                *node
+	minItems, maxItems   *float64
+	minimum, maximum     *float64
+	minLength, maxLength *float64
+	pattern              *regexp.Regexp
+}
+
+func compile(doc interface{}, path string) (*node, error) {
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid json schema at %q: expected an object", path)
+	}
+	n := &node{}
+	switch t := obj["type"].(type) {
+	case string:
+		n.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid json schema at %q: type must be a string or array of strings", path)
+			}
+			n.types = append(n.types, name)
+		}
+	}
+	if enum, ok := obj["enum"].([]interface{}); ok {
+		n.enum = enum
+	}
+	if c, ok := obj["const"]; ok {
+		n.enum = []interface{}{c}
+	}
+	if props, ok := obj["properties"].(map[string]interface{}); ok {
+		n.properties = make(map[string]*node, len(props))
+		for name, prop := range props {
+			compiled, err := compile(prop, path+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			n.properties[name] = compiled
+		}
+	}
+	if required, ok := obj["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				n.required = append(n.required, name)
+			}
+		}
+	}
+	if additional, ok := obj["additionalProperties"].(bool); ok {
+		n.additionalProperties = &additional
+	}
+	if items, ok := obj["items"]; ok {
+		compiled, err := compile(items, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+		n.items = compiled
+	}
+	n.minItems = number(obj, "minItems")
+	n.maxItems = number(obj, "maxItems")
+	n.minimum = number(obj, "minimum")
+	n.maximum = number(obj, "maximum")
+	n.minLength = number(obj, "minLength")
+	n.maxLength = number(obj, "maxLength")
+	if pattern, ok := obj["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json schema at %q: %w", path, err)
+		}
+		n.pattern = re
+	}
+	return n, nil
+}
+
+func number(obj map[string]interface{}, keyword string) *float64 {
+	if v, ok := obj[keyword].(float64); ok {
+		return &v
+	}
+	return nil
+}
+
+// Validate checks that data is a JSON document satisfying the schema
+func (n *node) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return &ValidationError{Reason: "payload is not valid json: " + err.Error()}
+	}
+	return n.validate(doc, "")
+}
+
+func (n *node) validate(v interface{}, path string) error {
+	if len(n.types) > 0 && !n.hasType(v) {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected %v, got %v", strings.Join(n.types, " or "), typeOf(v))}
+	}
+	if len(n.enum) > 0 && !n.inEnum(v) {
+		return &ValidationError{Path: path, Reason: "value is not one of the allowed values"}
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return n.validateObject(value, path)
+	case []interface{}:
+		if n.minItems != nil && float64(len(value)) < *n.minItems {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at least %v items", *n.minItems)}
+		}
+		if n.maxItems != nil && float64(len(value)) > *n.maxItems {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at most %v items", *n.maxItems)}
+		}
+		if n.items != nil {
+			for i, item := range value {
+				if err := n.items.validate(item, fmt.Sprintf("%v/%d", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case json.Number:
+		f, _ := value.Float64()
+		if n.minimum != nil && f < *n.minimum {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("%v is less than the minimum %v", value, *n.minimum)}
+		}
+		if n.maximum != nil && f > *n.maximum {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("%v is greater than the maximum %v", value, *n.maximum)}
+		}
+	case string:
+		length := float64(len([]rune(value)))
+		if n.minLength != nil && length < *n.minLength {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at least %v characters", *n.minLength)}
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at most %v characters", *n.maxLength)}
+		}
+		if n.pattern != nil && !n.pattern.MatchString(value) {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("%q does not match %v", value, n.pattern)}
+		}
+	}
+	return nil
+}
+
+func (n *node) validateObject(obj map[string]interface{}, path string) error {
+	for _, name := range n.required {
+		if _, ok := obj[name]; !ok {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("missing required property %q", name)}
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names) // report the same error for the same payload every time
+	for _, name := range names {
+		prop, ok := n.properties[name]
+		if !ok {
+			if n.additionalProperties != nil && !*n.additionalProperties {
+				return &ValidationError{Path: path, Reason: fmt.Sprintf("unexpected property %q", name)}
+			}
+			continue
+		}
+		if err := prop.validate(obj[name], path+"/"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *node) hasType(v interface{}) bool {
+	actual := typeOf(v)
+	for _, t := range n.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) inEnum(v interface{}) bool {
+	encoded, _ := json.Marshal(v)
+	for _, allowed := range n.enum {
+		expected, _ := json.Marshal(allowed)
+		if bytes.Equal(encoded, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type name of a decoded value
+func typeOf(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,131 @@
+package schema_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/metrics"
+	"messagerelayer/schema"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const answerSchema = `{
+	"type": "object",
+	"required": ["feed", "answer"],
+	"additionalProperties": false,
+	"properties": {
+		"feed": {"type": "string", "pattern": "^[a-z]+-[a-z]+$"},
+		"answer": {"type": "number", "minimum": 0},
+		"round": {"type": "integer"},
+		"status": {"enum": ["ok", "stale"]},
+		"nodes": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 1}}
+	}
+}`
+
+func TestJSONSchema(t *testing.T) {
+	s, err := schema.JSONSchema([]byte(answerSchema))
+	assert.Nil(t, err, "compile err is nil")
+	tests := []struct {
+		payload string
+		reason  string
+	}{
+		{`{"feed": "eth-usd", "answer": 1850.5, "round": 7, "status": "ok", "nodes": ["a"]}`, ""},
+		{`not json`, "payload is not valid json: invalid character 'o' in literal null (expecting 'u')"},
+		{`[]`, "expected object, got array"},
+		{`{"feed": "eth-usd"}`, `missing required property "answer"`},
+		{`{"feed": "ETH", "answer": 1}`, `/feed: "ETH" does not match ^[a-z]+-[a-z]+$`},
+		{`{"feed": "eth-usd", "answer": -1}`, "/answer: -1 is less than the minimum 0"},
+		{`{"feed": "eth-usd", "answer": 1, "round": 1.5}`, "/round: expected integer, got number"},
+		{`{"feed": "eth-usd", "answer": 1, "status": "bad"}`, "/status: value is not one of the allowed values"},
+		{`{"feed": "eth-usd", "answer": 1, "nodes": ["a", ""]}`, "/nodes/1: expected at least 1 characters"},
+		{`{"feed": "eth-usd", "answer": 1, "nodes": ["a", "b", "c"]}`, "/nodes: expected at most 2 items"},
+		{`{"feed": "eth-usd", "answer": 1, "extra": true}`, `unexpected property "extra"`},
+	}
+	for _, tt := range tests {
+		err := s.Validate([]byte(tt.payload))
+		if tt.reason == "" {
+			assert.Nil(t, err, tt.payload)
+			continue
+		}
+		if assert.NotNil(t, err, tt.payload) {
+			assert.Equal(t, tt.reason, err.Error())
+		}
+	}
+	_, err = schema.JSONSchema([]byte(`{"properties": {"a": {"pattern": "("}}}`))
+	assert.NotNil(t, err, "invalid pattern fails to compile")
+}
+
+type answer struct {
+	Feed   string  `json:"feed" schema:"required"`
+	Answer float64 `json:"answer"`
+}
+
+func TestStructSchema(t *testing.T) {
+	s := schema.Struct(answer{})
+	assert.Nil(t, s.Validate([]byte(`{"feed": "eth-usd", "answer": 1}`)), "valid payload")
+	assert.NotNil(t, s.Validate([]byte(`{"feed": "eth-usd", "other": 1}`)), "unknown field")
+	assert.NotNil(t, s.Validate([]byte(`{"answer": 1}`)), "missing required field")
+}
+
+func TestValidatorQuarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	deadLetter, err := schema.NewFileDeadLetter(path)
+	assert.Nil(t, err, "open err is nil")
+	defer deadLetter.Close()
+	validator := schema.NewValidator(schema.Quarantine, deadLetter)
+	validator.Register(constants.ReceivedAnswer, schema.Struct(answer{}))
+	interceptor := validator.Interceptor()
+	msgs, err := interceptor.Intercept(constants.Message{Type: constants.ReceivedAnswer, Data: []byte(`{"feed": "eth-usd"}`)})
+	assert.Nil(t, err, "valid message passes")
+	assert.Equal(t, 1, len(msgs))
+	msgs, err = interceptor.Intercept(constants.Message{Type: constants.ReceivedAnswer, Data: []byte(`{}`)})
+	assert.Nil(t, err, "quarantined message is dropped without error")
+	assert.Equal(t, 0, len(msgs))
+	msgs, err = interceptor.Intercept(constants.Message{Type: constants.StartNewRound, Data: []byte(`{}`)})
+	assert.Nil(t, err, "types without a schema pass")
+	assert.Equal(t, 1, len(msgs))
+	stats := validator.Stats()
+	assert.Equal(t, 2, stats.Valid)
+	assert.Equal(t, 1, stats.Quarantined)
+	assert.Equal(t, map[constants.MessageType]int{constants.ReceivedAnswer: 1}, stats.Failures)
+
+	file, err := os.Open(path)
+	assert.Nil(t, err, "open err is nil")
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	assert.True(t, scanner.Scan(), "dead letter has a record")
+	var record struct {
+		Reason  string
+		Message constants.Message
+	}
+	assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record), "record decodes")
+	assert.Equal(t, `invalid recieved answer message: missing required property "feed"`, record.Reason)
+	assert.Equal(t, "{}", string(record.Message.Data))
+}
+
+func TestValidatorReject(t *testing.T) {
+	var logs bytes.Buffer
+	validator := schema.NewValidator(schema.Reject, nil)
+	validator.SetLogger(logging.New(&logs, slog.LevelInfo, logging.Text))
+	validator.Register(constants.All, schema.Struct(answer{}))
+	_, err := validator.Interceptor().Intercept(constants.Message{Topic: "round.start.eth-usd", Data: []byte(`{}`)})
+	assert.NotNil(t, err, "rejected message fails the interceptor")
+	stats := validator.Stats()
+	assert.Equal(t, 1, stats.Rejected)
+	assert.Equal(t, map[constants.MessageType]int{constants.StartNewRound: 1}, stats.Failures, "failures are counted under the topic's type")
+	assert.Contains(t, logs.String(), "rejected message", "rejections are logged through the injected logger")
+
+	registry := metrics.NewRegistry()
+	registry.Register(validator)
+	var out bytes.Buffer
+	assert.Nil(t, registry.WriteText(&out), "write err is nil")
+	assert.Contains(t, out.String(), "schema_rejected_messages_total 1\n")
+	assert.Contains(t, out.String(), `schema_validation_failures_total{type="StartNewRound"} 1`)
+}
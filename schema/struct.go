@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Struct returns a schema requiring payloads to decode into the type of v without unknown fields. Fields tagged
+// `schema:"required"` must be present and non zero.
+func Struct(v interface{}) Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return structSchema{t: t}
+}
+
+type structSchema struct {
+	t reflect.Type
+}
+
+func (s structSchema) Validate(data []byte) error {
+	target := reflect.New(s.t)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target.Interface()); err != nil {
+		return &ValidationError{Reason: "payload does not match " + s.t.String() + ": " + err.Error()}
+	}
+	return checkRequired(target.Elem(), "")
+}
+
+// checkRequired walks the struct fields of v, reporting the first field tagged required that holds its zero value
+func checkRequired(v reflect.Value, path string) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		value := v.Field(i)
+		if field.Tag.Get("schema") == "required" && value.IsZero() {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("missing required property %q", name)}
+		}
+		if value.Kind() == reflect.Ptr && !value.IsNil() {
+			value = value.Elem()
+		}
+		if err := checkRequired(value, path+"/"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
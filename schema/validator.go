@@ -0,0 +1,225 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/logging"
+	"messagerelayer/metrics"
+	"messagerelayer/middleware"
+	"os"
+	"sync"
+	"time"
+)
+
+// Mode decides what happens to messages failing validation
+type Mode int
+
+const (
+	// Reject drops invalid messages
+	Reject Mode = iota
+	// Quarantine drops invalid messages after writing them to the dead letter along with the reason
+	Quarantine
+)
+
+func (m Mode) String() string {
+	if m == Quarantine {
+		return "quarantine"
+	}
+	return "reject"
+}
+
+// DeadLetter stores messages that failed validation so they can be inspected or replayed
+type DeadLetter interface {
+	Write(msg constants.Message, reason string) error
+}
+
+// Stats counts validation outcomes, Failures is keyed by the message type resolved from the topic
+type Stats struct {
+	Valid       int
+	Rejected    int
+	Quarantined int
+	Failures    map[constants.MessageType]int
+}
+
+// Validator checks message payloads against the schema registered for their type
+type Validator struct {
+	mode       Mode
+	deadLetter DeadLetter
+	hotLogger  logging.Logger // sampled logger for records written per invalid message
+	mu         sync.RWMutex
+	schemas    map[constants.MessageType]Schema
+	stats      Stats
+}
+
+// NewValidator returns a validator handling invalid messages according to mode, deadLetter is required to
+// Quarantine and ignored when rejecting
+func NewValidator(mode Mode, deadLetter DeadLetter) *Validator {
+	return &Validator{
+		mode:       mode,
+		deadLetter: deadLetter,
+		hotLogger:  logging.Sampled(logging.Default()),
+		schemas:    make(map[constants.MessageType]Schema),
+		stats:      Stats{Failures: make(map[constants.MessageType]int)},
+	}
+}
+
+// Register sets the schema for a message type, registering for All sets it for every type
+func (v *Validator) Register(msgType constants.MessageType, s Schema) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if msgType == constants.All {
+		v.schemas[constants.StartNewRound] = s
+		v.schemas[constants.ReceivedAnswer] = s
+		return
+	}
+	v.schemas[msgType] = s
+}
+
+// Validate checks msg against the schemas of its type without counting or quarantining it, messages of a type
+// with no schema are valid
+func (v *Validator) Validate(msg constants.Message) error {
+	msgType := messageType(msg)
+	types := []constants.MessageType{msgType}
+	if msgType == constants.All {
+		types = []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer}
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, t := range types {
+		s, ok := v.schemas[t]
+		if !ok {
+			continue
+		}
+		if err := s.Validate(msg.Data); err != nil {
+			return fmt.Errorf("invalid %v message: %w", t, err)
+		}
+	}
+	return nil
+}
+
+// Check validates msg and handles a failure according to the validator's mode, logging and counting it and
+// writing it to the dead letter when quarantining. It returns the validation error and whether the message was
+// quarantined, a message that cannot be written to the dead letter is rejected instead.
+func (v *Validator) Check(msg constants.Message) (quarantined bool, err error) {
+	err = v.Validate(msg)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err == nil {
+		v.stats.Valid++
+		return false, nil
+	}
+	msgType := messageType(msg)
+	v.stats.Failures[msgType]++
+	if v.mode == Quarantine && v.deadLetter != nil {
+		dlErr := v.deadLetter.Write(msg, err.Error())
+		if dlErr == nil {
+			v.stats.Quarantined++
+			v.hotLogger.Warn("quarantined message", logging.TypeKey, msgType, logging.TopicKey, msg.Topic, logging.ErrorKey, err)
+			return true, err
+		}
+		v.hotLogger.Error("unable to quarantine message, rejecting it", logging.TypeKey, msgType, logging.ErrorKey, dlErr)
+	}
+	v.stats.Rejected++
+	v.hotLogger.Warn("rejected message", logging.TypeKey, msgType, logging.TopicKey, msg.Topic, logging.ErrorKey, err)
+	return false, err
+}
+
+// messageType returns the type of msg, the one its topic maps to when it has a topic under a type's root
+func messageType(msg constants.Message) constants.MessageType {
+	if t := constants.TypeOfTopic(msg.Topic); t != 0 {
+		return t
+	}
+	return msg.Type
+}
+
+// Interceptor returns an interceptor checking messages, typically registered at the relayer's enqueue stage.
+// Rejected messages fail the interceptor so they are counted as interceptor errors, quarantined ones are dropped.
+func (v *Validator) Interceptor() middleware.Interceptor {
+	return middleware.Func("validate schema", func(msg constants.Message) ([]constants.Message, error) {
+		quarantined, err := v.Check(msg)
+		if quarantined {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []constants.Message{msg}, nil
+	})
+}
+
+// Stats returns the validation outcomes so far
+func (v *Validator) Stats() Stats {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	failures := make(map[constants.MessageType]int, len(v.stats.Failures))
+	for t, count := range v.stats.Failures {
+		failures[t] = count
+	}
+	stats := v.stats
+	stats.Failures = failures
+	return stats
+}
+
+// Collect implements metrics.Collector with the validation outcomes so far
+func (v *Validator) Collect() []metrics.Family {
+	stats := v.Stats()
+	failures := metrics.Family{Name: "schema_validation_failures_total", Help: "Messages failing validation.", Type: metrics.Counter}
+	for _, t := range []constants.MessageType{constants.StartNewRound, constants.ReceivedAnswer, constants.All} {
+		if count, ok := stats.Failures[t]; ok {
+			name, _ := t.MarshalText()
+			failures.Samples = append(failures.Samples, metrics.Sample{Labels: []metrics.Label{{Name: "type", Value: string(name)}}, Value: float64(count)})
+		}
+	}
+	return []metrics.Family{
+		{Name: "schema_valid_messages_total", Help: "Messages passing validation.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: float64(stats.Valid)}}},
+		{Name: "schema_rejected_messages_total", Help: "Invalid messages rejected.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: float64(stats.Rejected)}}},
+		{Name: "schema_quarantined_messages_total", Help: "Invalid messages written to the dead letter.", Type: metrics.Counter, Samples: []metrics.Sample{{Value: float64(stats.Quarantined)}}},
+		failures,
+	}
+}
+
+// SetLogger replaces the logger of the validator, records written for invalid messages are sampled. It must be
+// called before the validator checks messages.
+func (v *Validator) SetLogger(logger logging.Logger) {
+	v.hotLogger = logging.Sampled(logger)
+}
+
+// FileDeadLetter appends quarantined messages to a file as JSON lines
+type FileDeadLetter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// deadLetterRecord is a line of a FileDeadLetter
+type deadLetterRecord struct {
+	Time    time.Time         `json:"time"`
+	Reason  string            `json:"reason"`
+	Message constants.Message `json:"message"`
+}
+
+// NewFileDeadLetter opens or creates the dead letter file at path for appending
+func NewFileDeadLetter(path string) (*FileDeadLetter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDeadLetter{file: file}, nil
+}
+
+// Write appends msg and the reason it was quarantined
+func (dl *FileDeadLetter) Write(msg constants.Message, reason string) error {
+	encoded, err := json.Marshal(deadLetterRecord{Time: time.Now().UTC(), Reason: reason, Message: msg})
+	if err != nil {
+		return err
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	_, err = dl.file.Write(append(encoded, '\n'))
+	return err
+}
+
+// Close closes the dead letter file
+func (dl *FileDeadLetter) Close() error {
+	return dl.file.Close()
+}
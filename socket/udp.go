@@ -0,0 +1,130 @@
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// MaxDatagramSize is the largest datagram the UDP socket will decode, larger ones are dropped
+var MaxDatagramSize = 8 * 1024
+
+// ReadTimeout bounds how long a socket waits for an incoming message on each Read
+var ReadTimeout = 1 * time.Second
+
+// ErrNoMessage is returned when no message arrived within ReadTimeout
+var ErrNoMessage = errors.New("no message available")
+
+// ErrOversized is returned when a datagram exceeds MaxDatagramSize
+var ErrOversized = errors.New("datagram exceeds max datagram size")
+
+// UDPStats summarizes the datagrams a UDP socket has received
+type UDPStats struct {
+	Received  int64 // datagrams decoded into messages
+	Malformed int64 // datagrams that could not be decoded
+	Oversized int64 // datagrams larger than MaxDatagramSize
+}
+
+// UDPSocket reads one message per datagram from a unicast address or multicast group
+type UDPSocket struct {
+	conn      *net.UDPConn
+	format    framing.Format
+	received  int64
+	malformed int64
+	oversized int64
+}
+
+// NewUDP listens on the provided address, joining the group on the named interface when the address is multicast.
+// An empty interface name lets the system choose one.
+func NewUDP(addr string, iface string, format framing.Format) (*UDPSocket, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn *net.UDPConn
+	if udpAddr.IP != nil && udpAddr.IP.IsMulticast() {
+		var ifi *net.Interface
+		if iface != "" {
+			ifi, err = net.InterfaceByName(iface)
+			if err != nil {
+				return nil, err
+			}
+		}
+		conn, err = net.ListenMulticastUDP("udp", ifi, udpAddr)
+	} else {
+		conn, err = net.ListenUDP("udp", udpAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &UDPSocket{
+		conn:   conn,
+		format: format,
+	}, nil
+}
+
+// Read waits up to ReadTimeout for a datagram and decodes it into a message
+func (us *UDPSocket) Read() (constants.Message, error) {
+	buf := make([]byte, MaxDatagramSize+1)
+	us.conn.SetReadDeadline(time.Now().Add(ReadTimeout))
+	n, _, err := us.conn.ReadFromUDP(buf)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return constants.Message{}, ErrNoMessage
+		}
+		return constants.Message{}, err
+	}
+	if n > MaxDatagramSize {
+		atomic.AddInt64(&us.oversized, 1)
+		return constants.Message{}, ErrOversized
+	}
+	msg, err := decodeDatagram(buf[:n], us.format)
+	if err != nil {
+		atomic.AddInt64(&us.malformed, 1)
+		return constants.Message{}, err
+	}
+	atomic.AddInt64(&us.received, 1)
+	return msg, nil
+}
+
+// decodeDatagram decodes a datagram holding exactly one message. Length-prefixed datagrams omit the length
+// since the datagram already bounds it, leaving the 1 byte message type followed by the data.
+func decodeDatagram(datagram []byte, format framing.Format) (constants.Message, error) {
+	var msg constants.Message
+	if format == framing.JSONL {
+		decoded, err := framing.Decode(datagram)
+		if err != nil {
+			return constants.Message{}, err
+		}
+		msg = decoded
+	} else if len(datagram) > 0 {
+		msg = framing.DecodeLengthPrefixed(append([]byte(nil), datagram...))
+	}
+	if msg.Type != constants.StartNewRound && msg.Type != constants.ReceivedAnswer && msg.Type != constants.All {
+		return constants.Message{}, fmt.Errorf("malformed message: invalid message type %d", int(msg.Type))
+	}
+	return msg, nil
+}
+
+// Stats returns the datagram counters of the socket
+func (us *UDPSocket) Stats() UDPStats {
+	return UDPStats{
+		Received:  atomic.LoadInt64(&us.received),
+		Malformed: atomic.LoadInt64(&us.malformed),
+		Oversized: atomic.LoadInt64(&us.oversized),
+	}
+}
+
+// Addr returns the local address the socket is bound to
+func (us *UDPSocket) Addr() net.Addr {
+	return us.conn.LocalAddr()
+}
+
+// Close stops listening for datagrams
+func (us *UDPSocket) Close() error {
+	return us.conn.Close()
+}
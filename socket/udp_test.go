@@ -0,0 +1,90 @@
+package socket_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/socket"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestUDPSocketRead(t *testing.T) {
+	defer func(timeout time.Duration, size int) {
+		socket.ReadTimeout, socket.MaxDatagramSize = timeout, size
+	}(socket.ReadTimeout, socket.MaxDatagramSize)
+	socket.ReadTimeout = 200 * time.Millisecond
+	socket.MaxDatagramSize = 64
+	udp, err := socket.NewUDP("127.0.0.1:0", "", framing.JSONL)
+	assert.Nil(t, err, "listen err is nil")
+	defer udp.Close()
+	conn, err := net.Dial("udp", udp.Addr().String())
+	assert.Nil(t, err, "dial err is nil")
+	defer conn.Close()
+
+	conn.Write([]byte(`{"type": "StartNewRound", "data": "YQ=="}`))
+	msg, err := udp.Read()
+	assert.Nil(t, err, "read err is nil")
+	assert.Equal(t, constants.StartNewRound, msg.Type)
+	assert.Equal(t, "a", string(msg.Data))
+
+	conn.Write([]byte(`not json`))
+	_, err = udp.Read()
+	assert.NotNil(t, err, "malformed datagram")
+
+	conn.Write(make([]byte, 100))
+	_, err = udp.Read()
+	assert.Equal(t, socket.ErrOversized, err)
+
+	_, err = udp.Read()
+	assert.Equal(t, socket.ErrNoMessage, err)
+
+	stats := udp.Stats()
+	assert.Equal(t, int64(1), stats.Received, "received count")
+	assert.Equal(t, int64(1), stats.Malformed, "malformed count")
+	assert.Equal(t, int64(1), stats.Oversized, "oversized count")
+}
+
+func TestUDPSocketLengthPrefixed(t *testing.T) {
+	udp, err := socket.NewUDP("127.0.0.1:0", "", framing.LengthPrefixed)
+	assert.Nil(t, err, "listen err is nil")
+	defer udp.Close()
+	conn, err := net.Dial("udp", udp.Addr().String())
+	assert.Nil(t, err, "dial err is nil")
+	defer conn.Close()
+	conn.Write(append([]byte{byte(constants.ReceivedAnswer)}, "answer"...))
+	msg, err := udp.Read()
+	assert.Nil(t, err, "read err is nil")
+	assert.Equal(t, constants.ReceivedAnswer, msg.Type)
+	assert.Equal(t, "answer", string(msg.Data))
+}
+
+func TestUDPSocketMulticast(t *testing.T) {
+	defer func(timeout time.Duration) { socket.ReadTimeout = timeout }(socket.ReadTimeout)
+	socket.ReadTimeout = 500 * time.Millisecond
+	udp, err := socket.NewUDP("239.255.42.99:0", "lo", framing.JSONL)
+	if err != nil {
+		t.Skipf("multicast unavailable on loopback: %v", err)
+	}
+	defer udp.Close()
+	group := &net.UDPAddr{IP: net.ParseIP("239.255.42.99"), Port: udp.Addr().(*net.UDPAddr).Port}
+	// a sender bound to the loopback address sends multicast out of the loopback interface
+	conn, err := net.DialUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, group)
+	assert.Nil(t, err, "dial err is nil")
+	defer conn.Close()
+	if _, err := conn.Write([]byte(`{"type": "ReceivedAnswer", "data": "YQ=="}`)); err != nil {
+		t.Skipf("multicast unavailable on loopback: %v", err)
+	}
+	msg, err := udp.Read()
+	assert.Nil(t, err, "read err is nil")
+	assert.Equal(t, constants.ReceivedAnswer, msg.Type)
+	assert.Equal(t, "a", string(msg.Data))
+}
@@ -0,0 +1,182 @@
+package socket
+
+import (
+	"fmt"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/logging"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// UnixBufferSize is the number of decoded messages a unix socket holds until they are read
+var UnixBufferSize = 100
+
+// UnixSocket accepts connections on a unix domain socket and reads framed messages from each of them
+type UnixSocket struct {
+	path      string
+	format    framing.Format
+	listener  *net.UnixListener
+	msgs      chan constants.Message
+	closed    chan struct{} // closed by Close so connections blocked on a full buffer stop
+	closeOnce sync.Once
+	mu        sync.Mutex
+	conns     map[net.Conn]bool
+	logger    logging.Logger
+}
+
+// NewUnix listens on the unix domain socket at path with the provided file permissions, removing a stale
+// socket file left behind by a previous process. Its removal is logged through logging.Default() as the socket has
+// no logger yet.
+func NewUnix(path string, perm os.FileMode, format framing.Format) (*UnixSocket, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := listenRestricted(path, perm)
+	if err != nil {
+		return nil, err
+	}
+	us := &UnixSocket{
+		path:     path,
+		format:   format,
+		listener: listener,
+		msgs:     make(chan constants.Message, UnixBufferSize),
+		closed:   make(chan struct{}),
+		conns:    make(map[net.Conn]bool),
+		logger:   logging.Default(),
+	}
+	go us.accept()
+	return us, nil
+}
+
+// listenRestricted binds the socket in a private directory next to path and only moves it to path once it has
+// perm, so no other user can connect while it still has the permissions of the process umask
+func listenRestricted(path string, perm os.FileMode) (*net.UnixListener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "s")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the file is moved, Close removes it from path instead
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(private, perm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(private, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket file at path unless another process is still listening on it
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("refusing to remove %v: not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %v is in use by another process", path)
+	}
+	logging.Default().Info("removing stale socket", "path", path)
+	return os.Remove(path)
+}
+
+func (us *UnixSocket) accept() {
+	for {
+		conn, err := us.listener.Accept()
+		if err != nil {
+			return
+		}
+		us.mu.Lock()
+		select {
+		case <-us.closed:
+			// accepted while Close swept the connections
+			us.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		us.conns[conn] = true
+		us.mu.Unlock()
+		go us.readConn(conn)
+	}
+}
+
+func (us *UnixSocket) readConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		us.mu.Lock()
+		delete(us.conns, conn)
+		us.mu.Unlock()
+	}()
+	reader := framing.NewReader(conn, us.format)
+	for {
+		msg, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			us.mu.Lock()
+			logger := us.logger
+			us.mu.Unlock()
+			logger.Warn("closing unix socket connection", "path", us.path, logging.ErrorKey, err)
+			return
+		}
+		select {
+		case us.msgs <- msg:
+		case <-us.closed:
+			return
+		}
+	}
+}
+
+// Read waits up to ReadTimeout for a message from any connected peer
+func (us *UnixSocket) Read() (constants.Message, error) {
+	select {
+	case msg := <-us.msgs:
+		return msg, nil
+	case <-time.After(ReadTimeout):
+		return constants.Message{}, ErrNoMessage
+	}
+}
+
+// SetLogger replaces the logger of the socket, connections accepted before keep logging through the new one
+func (us *UnixSocket) SetLogger(logger logging.Logger) {
+	us.mu.Lock()
+	us.logger = logger
+	us.mu.Unlock()
+}
+
+// Close stops accepting connections, closes connected peers and removes the socket file
+func (us *UnixSocket) Close() error {
+	err := us.listener.Close()
+	us.closeOnce.Do(func() {
+		close(us.closed)
+		os.Remove(us.path)
+	})
+	us.mu.Lock()
+	for conn := range us.conns {
+		conn.Close()
+	}
+	us.mu.Unlock()
+	return err
+}
@@ -0,0 +1,87 @@
+package socket_test
+
+import (
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/socket"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixSocketRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relayer.sock")
+	unix, err := socket.NewUnix(path, 0600, framing.LengthPrefixed)
+	assert.Nil(t, err, "listen err is nil")
+	defer unix.Close()
+	info, err := os.Stat(path)
+	assert.Nil(t, err, "stat err is nil")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "socket permissions")
+
+	conn, err := net.Dial("unix", path)
+	assert.Nil(t, err, "dial err is nil")
+	defer conn.Close()
+	writer := framing.NewWriter(conn, framing.LengthPrefixed)
+	writer.Write(constants.Message{Type: constants.StartNewRound, Data: []byte("a")})
+	writer.Write(constants.Message{Type: constants.ReceivedAnswer, Data: []byte("b")})
+	for _, expected := range []string{"a", "b"} {
+		msg, err := unix.Read()
+		assert.Nil(t, err, "read err is nil")
+		assert.Equal(t, expected, string(msg.Data))
+	}
+}
+
+func TestUnixSocketRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relayer.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	assert.Nil(t, err, "listen err is nil")
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	unix, err := socket.NewUnix(path, 0660, framing.JSONL)
+	assert.Nil(t, err, "stale socket replaced")
+	defer unix.Close()
+
+	_, err = socket.NewUnix(path, 0660, framing.JSONL)
+	assert.NotNil(t, err, "live socket is not removed")
+}
+
+func TestUnixSocketRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relayer.sock")
+	os.WriteFile(path, []byte("not a socket"), 0600)
+	_, err := socket.NewUnix(path, 0600, framing.JSONL)
+	assert.NotNil(t, err, "regular file is not removed")
+}
+
+func TestUnixSocketCloseStopsBlockedConnections(t *testing.T) {
+	defer func(size int) { socket.UnixBufferSize = size }(socket.UnixBufferSize)
+	socket.UnixBufferSize = 1
+	dir := t.TempDir()
+	path := filepath.Join(dir, "relayer.sock")
+	goroutines := runtime.NumGoroutine()
+	unix, err := socket.NewUnix(path, 0600, framing.JSONL)
+	assert.Nil(t, err, "listen err is nil")
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, 1, len(entries), "only the socket is left in its directory")
+
+	conn, err := net.Dial("unix", path)
+	assert.Nil(t, err, "dial err is nil")
+	defer conn.Close()
+	writer := framing.NewWriter(conn, framing.JSONL)
+	for _, data := range []string{"a", "b", "c"} {
+		writer.Write(constants.Message{Type: constants.StartNewRound, Data: []byte(data)})
+	}
+	time.Sleep(100 * time.Millisecond) // artificial wait time to let the connection fill the buffer
+	unix.Close()
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines, "connection goroutines exit")
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "socket file is removed")
+}
@@ -0,0 +1,275 @@
+package subscriber
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/health"
+	"messagerelayer/logging"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// ExecRestartBackoff is the initial wait time before restarting an exited child process
+var ExecRestartBackoff = 1 * time.Second
+
+// ExecMaxRestartBackoff caps the exponential backoff between child process restarts
+var ExecMaxRestartBackoff = 30 * time.Second
+
+// ExecExitTimeout is how long a child whose stdin was closed after a failed write has to exit before it is killed
+var ExecExitTimeout = 5 * time.Second
+
+// ExecSubscriber spawns a command and writes each message it receives to the command's stdin
+type ExecSubscriber struct {
+	name           string
+	msgType        constants.MessageType
+	command        string
+	args           []string
+	format         framing.Format
+	processedCount atomic.Int64
+	msgQueues      QueueMap
+	acker          Acker
+	heartbeat      *health.Heartbeat
+	logger         logging.Logger
+	done           chan bool
+}
+
+// childProcess is a running instance of the configured command
+type childProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	writer *framing.Writer
+	exited chan error
+}
+
+// NewExec returns a subscriber that pipes messages to the provided command
+func NewExec(msgType constants.MessageType, queueSize int, name string, format framing.Format, command string, args ...string) Subscriber {
+	return &ExecSubscriber{
+		name:      name,
+		msgType:   msgType,
+		command:   command,
+		args:      args,
+		format:    format,
+		msgQueues: newQueueMap(msgType, queueSize),
+		heartbeat: health.NewHeartbeat(),
+		logger:    logging.Default(),
+		done:      make(chan bool),
+	}
+}
+
+// Start spawns the child process and begins piping messages to it, restarting it with backoff whenever it exits.
+// Once ctx is cancelled the messages still buffered are written for up to DrainTimeout, then the child's stdin is
+// closed and it is killed if it has not exited by the deadline.
+func (es *ExecSubscriber) Start(ctx context.Context) {
+	es.logger.Info("subscriber starting", logging.SubscriberKey, es.name)
+	es.heartbeat.Beat()
+	backoff := ExecRestartBackoff
+	for {
+		started := time.Now()
+		child, err := es.spawn()
+		if err != nil {
+			es.logger.Error("subscriber unable to start child process", logging.SubscriberKey, es.name, "command", es.command, logging.ErrorKey, err)
+		} else {
+			err = es.pipe(ctx, child)
+			if ctx.Err() != nil {
+				es.logger.Info("closing subscriber", logging.SubscriberKey, es.name, "processed", es.processedCount.Load())
+				es.done <- true
+				return
+			}
+			es.logger.Warn("subscriber child process exited", logging.SubscriberKey, es.name, "command", es.command, logging.ErrorKey, err)
+		}
+		if time.Since(started) > ExecMaxRestartBackoff {
+			backoff = ExecRestartBackoff // the child ran fine for a while, this is not a crash loop
+		}
+		es.logger.Info("subscriber restarting child process", logging.SubscriberKey, es.name, "command", es.command, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			if left := es.msgQueues.Len(); left > 0 {
+				es.logger.Warn("subscriber left messages unwritten after draining", logging.SubscriberKey, es.name, "count", left)
+			}
+			es.logger.Info("closing subscriber", logging.SubscriberKey, es.name, "processed", es.processedCount.Load())
+			es.done <- true
+			return
+		}
+		backoff *= 2
+		if backoff > ExecMaxRestartBackoff {
+			backoff = ExecMaxRestartBackoff
+		}
+	}
+}
+
+func (es *ExecSubscriber) spawn() (*childProcess, error) {
+	cmd := exec.Command(es.command, es.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &stderrLogger{name: es.name, logger: es.logger}
+	cmd.Stderr = stderr
+	// a process the child left behind may hold stderr open, Wait stops copying it once the child is gone for a while
+	cmd.WaitDelay = ExecExitTimeout
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait() // returns once stderr is fully copied
+		stderr.Flush()
+		exited <- err
+	}()
+	return &childProcess{
+		cmd:    cmd,
+		stdin:  stdin,
+		writer: framing.NewWriter(stdin, es.format),
+		exited: exited,
+	}, nil
+}
+
+// stderrLogger writes each line a child process prints to stderr to the log
+type stderrLogger struct {
+	name    string
+	logger  logging.Logger
+	pending []byte
+}
+
+func (sl *stderrLogger) Write(p []byte) (int, error) {
+	sl.pending = append(sl.pending, p...)
+	for {
+		i := bytes.IndexByte(sl.pending, '\n')
+		if i < 0 {
+			break
+		}
+		sl.logger.Warn("subscriber child process stderr", logging.SubscriberKey, sl.name, "line", string(sl.pending[:i]))
+		sl.pending = sl.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// pipe writes incoming messages to the child until it exits or the context is cancelled
+func (es *ExecSubscriber) pipe(ctx context.Context, child *childProcess) error {
+	for {
+		select {
+		case msg := <-es.msgQueues.Get(constants.StartNewRound):
+			if err := es.write(child, msg); err != nil {
+				return err
+			}
+		case msg := <-es.msgQueues.Get(constants.ReceivedAnswer):
+			if err := es.write(child, msg); err != nil {
+				return err
+			}
+		case err := <-child.exited:
+			return err
+		case <-ctx.Done():
+			es.drain(child)
+			return ctx.Err()
+		}
+	}
+}
+
+// drain writes the messages still buffered to the child, then closes its stdin and waits for it to exit, killing
+// it once DrainTimeout has passed
+func (es *ExecSubscriber) drain(child *childProcess) {
+	deadline := time.Now().Add(DrainTimeout)
+	exited := false
+	left := drain(es.msgQueues, deadline, func(msg constants.Message) error {
+		err := es.write(child, msg)
+		exited = err != nil
+		return err
+	})
+	if left > 0 {
+		es.logger.Warn("subscriber left messages unwritten after draining", logging.SubscriberKey, es.name, "count", left)
+	}
+	if exited {
+		return
+	}
+	child.stdin.Close()
+	es.wait(child, deadline, "subscriber killing child process that did not exit after draining")
+}
+
+// wait waits for the child to exit and returns its exit error, killing it with a warning once deadline has passed
+func (es *ExecSubscriber) wait(child *childProcess, deadline time.Time, warning string) error {
+	select {
+	case err := <-child.exited:
+		return err
+	case <-time.After(time.Until(deadline)):
+		es.logger.Warn(warning, logging.SubscriberKey, es.name, "command", es.command)
+		child.cmd.Process.Kill()
+		return <-child.exited
+	}
+}
+
+func (es *ExecSubscriber) write(child *childProcess, msg constants.Message) error {
+	msg.DequeuedAt = time.Now()
+	if err := child.writer.Write(msg); err != nil {
+		es.logger.Warn("subscriber unable to write message to child process", logging.SubscriberKey, es.name, logging.MessageIDKey, msg.ID, logging.ErrorKey, err)
+		child.stdin.Close()
+		exitErr := es.wait(child, time.Now().Add(ExecExitTimeout), "subscriber killing child process that did not exit after a failed write")
+		// a child that exited cleanly still failed the write
+		if exitErr != nil {
+			return exitErr
+		}
+		return err
+	}
+	es.processedCount.Add(1)
+	if es.acker != nil {
+		es.acker.Ack(es.name, msg)
+	}
+	return nil
+}
+
+// Flush logs a last line the child printed without a trailing newline
+func (sl *stderrLogger) Flush() {
+	if len(sl.pending) > 0 {
+		sl.logger.Warn("subscriber child process stderr", logging.SubscriberKey, sl.name, "line", string(sl.pending))
+		sl.pending = nil
+	}
+}
+
+// SetLogger replaces the logger of the subscriber and its child processes' stderr, it must be called before Start
+func (es *ExecSubscriber) SetLogger(logger logging.Logger) {
+	es.logger = logger
+}
+
+// AckTo makes the subscriber acknowledge every message it writes to the child process to acker
+func (es *ExecSubscriber) AckTo(acker Acker) {
+	es.acker = acker
+}
+
+// Name returns the subscribers name
+func (es *ExecSubscriber) Name() string {
+	return es.name
+}
+
+// ProcessedCount returns the number of messages written to the child process
+func (es *ExecSubscriber) ProcessedCount() int {
+	return int(es.processedCount.Load())
+}
+
+// WaitTime returns the duration for the subscriber to wait inbetween reading messages that have been broadcasted to it
+func (es *ExecSubscriber) WaitTime() time.Duration {
+	return 0 * time.Second
+}
+
+// DoneChannel returns the subscribers done channel so the parent process can wait until it completes to exit
+func (es *ExecSubscriber) DoneChannel() chan bool {
+	return es.done
+}
+
+// Type returns the message type the subscriber was registered with
+func (es *ExecSubscriber) Type() constants.MessageType {
+	return es.msgType
+}
+
+// Heartbeat returns the probe the subscriber beats once it starts
+func (es *ExecSubscriber) Heartbeat() *health.Heartbeat {
+	return es.heartbeat
+}
+
+// Channel returns the subscribers associated channel
+func (es *ExecSubscriber) Channel(msgType constants.MessageType) chan constants.Message {
+	return es.msgQueues.Get(msgType)
+}
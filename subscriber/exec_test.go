@@ -0,0 +1,130 @@
+package subscriber_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/logging"
+	"messagerelayer/subscriber"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecSubscriberWritesJSONL(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	s := subscriber.NewExec(constants.All, 5, "exec subscriber", framing.JSONL, "sh", "-c", "cat >> "+out)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	s.Channel(constants.StartNewRound) <- constants.Message{Type: constants.StartNewRound, Data: []byte("a")}
+	s.Channel(constants.ReceivedAnswer) <- constants.Message{Type: constants.ReceivedAnswer, Data: []byte("b")}
+	time.Sleep(500 * time.Millisecond) // artificial wait time to allow messages to get written
+	cancel()
+	<-s.DoneChannel()
+	contents, err := os.ReadFile(out)
+	assert.Nil(t, err, "read err is nil")
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Equal(t, 2, len(lines), "one line per message")
+	assert.Equal(t, 2, s.ProcessedCount(), "processed count")
+	for _, line := range lines {
+		msg, err := framing.Decode([]byte(line))
+		assert.Nil(t, err, "decode err is nil")
+		assert.Contains(t, []string{"a", "b"}, string(msg.Data))
+	}
+}
+
+func TestExecSubscriberRestartsChild(t *testing.T) {
+	subscriber.ExecRestartBackoff = 10 * time.Millisecond
+	defer func() { subscriber.ExecRestartBackoff = 1 * time.Second }()
+	out := filepath.Join(t.TempDir(), "out")
+	// the child exits after reading a single frame
+	s := subscriber.NewExec(constants.StartNewRound, 5, "exec subscriber", framing.JSONL, "sh", "-c", "head -n 1 >> "+out)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	for i := 0; i < 3; i++ {
+		s.Channel(constants.StartNewRound) <- constants.Message{Type: constants.StartNewRound, Data: []byte("a")}
+		time.Sleep(300 * time.Millisecond)
+	}
+	cancel()
+	<-s.DoneChannel()
+	contents, err := os.ReadFile(out)
+	assert.Nil(t, err, "read err is nil")
+	assert.Equal(t, 3, strings.Count(string(contents), "\n"), "each restarted child read a message")
+}
+
+func TestExecSubscriberDrainsOnCancel(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	s := subscriber.NewExec(constants.ReceivedAnswer, 5, "exec subscriber", framing.JSONL, "sh", "-c", "cat >> "+out)
+	for i := 0; i < 5; i++ {
+		s.Channel(constants.ReceivedAnswer) <- constants.Message{Type: constants.ReceivedAnswer, Data: []byte("a")}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	go s.Start(ctx)
+	<-s.DoneChannel()
+	contents, err := os.ReadFile(out)
+	assert.Nil(t, err, "read err is nil")
+	assert.Equal(t, 5, strings.Count(string(contents), "\n"), "buffered messages are written before the child is stopped")
+	assert.Equal(t, 5, s.ProcessedCount(), "processed count")
+}
+
+func TestExecSubscriberFlushesPartialStderrLine(t *testing.T) {
+	var logs bytes.Buffer
+	s := subscriber.NewExec(constants.ReceivedAnswer, 5, "exec subscriber", framing.JSONL, "sh", "-c", "printf 'line\\npartial' >&2; cat > /dev/null")
+	s.SetLogger(logging.New(&logs, slog.LevelInfo, logging.Text))
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	time.Sleep(300 * time.Millisecond) // artificial wait time to allow the child to start
+	cancel()
+	<-s.DoneChannel()
+	assert.Contains(t, logs.String(), "line=line", "complete lines are logged")
+	assert.Contains(t, logs.String(), "line=partial", "the trailing partial line is logged once the child exits")
+}
+
+func TestExecSubscriberResetsBackoffAfterHealthyRun(t *testing.T) {
+	defer func(backoff time.Duration, max time.Duration) {
+		subscriber.ExecRestartBackoff, subscriber.ExecMaxRestartBackoff = backoff, max
+	}(subscriber.ExecRestartBackoff, subscriber.ExecMaxRestartBackoff)
+	subscriber.ExecRestartBackoff = 10 * time.Millisecond
+	subscriber.ExecMaxRestartBackoff = 100 * time.Millisecond
+	var logs bytes.Buffer
+	// every run of the child outlasts the max backoff
+	s := subscriber.NewExec(constants.StartNewRound, 5, "exec subscriber", framing.JSONL, "sh", "-c", "sleep 0.2")
+	s.SetLogger(logging.New(&logs, slog.LevelInfo, logging.Text))
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	time.Sleep(700 * time.Millisecond) // artificial wait time to allow the child to be restarted a few times
+	cancel()
+	<-s.DoneChannel()
+	restarts := strings.Count(logs.String(), "subscriber restarting child process")
+	assert.GreaterOrEqual(t, restarts, 2, "the child was restarted")
+	assert.Equal(t, restarts, strings.Count(logs.String(), "backoff=10ms"), "the backoff is reset after each healthy run")
+}
+
+func TestExecSubscriberKillsChildAfterFailedWrite(t *testing.T) {
+	defer func(backoff time.Duration, timeout time.Duration) {
+		subscriber.ExecRestartBackoff, subscriber.ExecExitTimeout = backoff, timeout
+	}(subscriber.ExecRestartBackoff, subscriber.ExecExitTimeout)
+	subscriber.ExecRestartBackoff = time.Hour
+	subscriber.ExecExitTimeout = 100 * time.Millisecond
+	// the child stops reading its stdin but keeps running
+	s := subscriber.NewExec(constants.StartNewRound, 5, "exec subscriber", framing.JSONL, "sh", "-c", "exec sleep 30 0<&-")
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	time.Sleep(200 * time.Millisecond) // artificial wait time to allow the child to close its stdin
+	s.Channel(constants.StartNewRound) <- constants.Message{Type: constants.StartNewRound, Data: []byte("a")}
+	time.Sleep(300 * time.Millisecond) // artificial wait time to allow the write to fail and the child to be killed
+	cancel()
+	select {
+	case <-s.DoneChannel():
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber hangs on a child that does not exit")
+	}
+	assert.Equal(t, 0, s.ProcessedCount(), "processed count")
+}
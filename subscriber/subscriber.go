@@ -2,30 +2,52 @@ package subscriber
 
 import (
 	"context"
-	"log"
 	"messagerelayer/constants"
+	"messagerelayer/health"
+	"messagerelayer/logging"
+	"sync/atomic"
 	"time"
 )
 
+// DrainTimeout is how long a subscriber keeps processing the messages buffered in its channels once its context is
+// cancelled
+var DrainTimeout = 5 * time.Second
+
 // Subscriber reads messages sent from a message relayer
 type Subscriber interface {
 	Start(context.Context)
 	Channel(constants.MessageType) chan constants.Message
 	DoneChannel() chan bool
 	Type() constants.MessageType
+	Heartbeat() *health.Heartbeat
+	SetLogger(logging.Logger)
 	// helper methods for testing
 	Name() string
 	ProcessedCount() int
 	WaitTime() time.Duration
 }
 
+// Acker is notified once a subscriber has finished processing a message, relayer.Relayer implements it
+type Acker interface {
+	Ack(subscriber string, msg constants.Message)
+}
+
+// Acking is implemented by subscribers that acknowledge the messages they process
+type Acking interface {
+	AckTo(Acker)
+}
+
 // MockSubscriber is a noop subscriber that just reads and prints the incoming messages
 type MockSubscriber struct {
 	name           string
 	msgType        constants.MessageType
-	processedCount int
+	processedCount atomic.Int64
 	waitTime       func() time.Duration
 	msgQueues      QueueMap
+	acker          Acker
+	heartbeat      *health.Heartbeat
+	logger         logging.Logger
+	hotLogger      logging.Logger // sampled logger for records written per message
 	done           chan bool
 }
 
@@ -41,8 +63,37 @@ func (q QueueMap) Get(msgType constants.MessageType) chan constants.Message {
 	return c
 }
 
-// New returns a new subscriber
-func New(msgType constants.MessageType, waitTime func() time.Duration, queueSize int, name string) Subscriber {
+// Len returns the number of messages buffered across every channel
+func (q QueueMap) Len() int {
+	n := 0
+	for _, c := range q {
+		n += len(c)
+	}
+	return n
+}
+
+// drain hands the messages buffered in queues to process until they are empty, process fails or deadline passes,
+// returning how many were left unprocessed
+func drain(queues QueueMap, deadline time.Time, process func(constants.Message) error) int {
+	expired := time.After(time.Until(deadline))
+	for {
+		var msg constants.Message
+		select {
+		case msg = <-queues.Get(constants.StartNewRound):
+		case msg = <-queues.Get(constants.ReceivedAnswer):
+		case <-expired:
+			return queues.Len()
+		default:
+			return 0
+		}
+		if err := process(msg); err != nil {
+			return queues.Len()
+		}
+	}
+}
+
+// newQueueMap creates buffered channels for each message type covered by msgType
+func newQueueMap(msgType constants.MessageType, queueSize int) QueueMap {
 	queues := QueueMap{}
 	if msgType == constants.ReceivedAnswer || msgType == constants.All {
 		queues[constants.ReceivedAnswer] = make(chan constants.Message, queueSize)
@@ -50,59 +101,80 @@ func New(msgType constants.MessageType, waitTime func() time.Duration, queueSize
 	if msgType == constants.StartNewRound || msgType == constants.All {
 		queues[constants.StartNewRound] = make(chan constants.Message, queueSize)
 	}
+	return queues
+}
+
+// New returns a new subscriber
+func New(msgType constants.MessageType, waitTime func() time.Duration, queueSize int, name string) Subscriber {
 	return &MockSubscriber{
-		name:           name,
-		processedCount: 0,
-		waitTime:       waitTime,
-		msgQueues:      queues,
-		msgType:        msgType,
-		done:           make(chan bool),
+		name:      name,
+		waitTime:  waitTime,
+		msgQueues: newQueueMap(msgType, queueSize),
+		msgType:   msgType,
+		heartbeat: health.NewHeartbeat(),
+		logger:    logging.Default(),
+		hotLogger: logging.Sampled(logging.Default()),
+		done:      make(chan bool),
 	}
 }
 
 // Name returns the subscribers name
-func (ms MockSubscriber) Name() string {
+func (ms *MockSubscriber) Name() string {
 	return ms.name
 }
 
 // ProcessedCount returns the number of messages a subscriber processed
-func (ms MockSubscriber) ProcessedCount() int {
-	return ms.processedCount
+func (ms *MockSubscriber) ProcessedCount() int {
+	return int(ms.processedCount.Load())
 }
 
 // WaitTime returns the duration for the subscriber to wait inbetween reading messages that have been broadcasted to it
-func (ms MockSubscriber) WaitTime() time.Duration {
+func (ms *MockSubscriber) WaitTime() time.Duration {
 	return ms.waitTime()
 }
 
 // DoneChannel returns the subscribers done channel so the parent process can wait until it completes to exit
-func (ms MockSubscriber) DoneChannel() chan bool {
+func (ms *MockSubscriber) DoneChannel() chan bool {
 	return ms.done
 }
 
 // Type returns the message type the subscriber was registered with
-func (ms MockSubscriber) Type() constants.MessageType {
+func (ms *MockSubscriber) Type() constants.MessageType {
 	return ms.msgType
 }
 
+// Heartbeat returns the probe the subscriber beats once it starts listening
+func (ms *MockSubscriber) Heartbeat() *health.Heartbeat {
+	return ms.heartbeat
+}
+
 // Channel returns the subscribers associated channel
-func (ms MockSubscriber) Channel(msgType constants.MessageType) chan constants.Message {
+func (ms *MockSubscriber) Channel(msgType constants.MessageType) chan constants.Message {
 	return ms.msgQueues.Get(msgType)
 }
 
-// Start begins the subscriber to listen for new messages from the message relayer
+// Start begins the subscriber to listen for new messages from the message relayer, once ctx is cancelled it processes
+// the messages still buffered for up to DrainTimeout before closing
 func (ms *MockSubscriber) Start(ctx context.Context) {
-	log.Printf("subscriber %v starting", ms.name)
+	ms.logger.Info("subscriber starting", logging.SubscriberKey, ms.name)
+	ms.heartbeat.Beat()
 	for {
 		select {
 		case msg := <-ms.msgQueues.Get(constants.StartNewRound):
-			log.Printf("👨 %v reading new start round message: %+v", ms.name, string(msg.Data))
-			ms.processedCount++
+			ms.hotLogger.Debug("reading new message", logging.SubscriberKey, ms.name, logging.TypeKey, constants.StartNewRound, logging.MessageIDKey, msg.ID)
+			ms.processed(msg)
 		case msg := <-ms.msgQueues.Get(constants.ReceivedAnswer):
-			log.Printf("👨 %v reading new recieved answer message: %+v", ms.name, string(msg.Data))
-			ms.processedCount++
+			ms.hotLogger.Debug("reading new message", logging.SubscriberKey, ms.name, logging.TypeKey, constants.ReceivedAnswer, logging.MessageIDKey, msg.ID)
+			ms.processed(msg)
 		case <-ctx.Done():
-			log.Printf("closing subscriber %v who processed %v messages", ms.name, ms.processedCount)
+			left := drain(ms.msgQueues, time.Now().Add(DrainTimeout), func(msg constants.Message) error {
+				ms.processed(msg)
+				return nil
+			})
+			if left > 0 {
+				ms.logger.Warn("subscriber left messages unprocessed after draining", logging.SubscriberKey, ms.name, "count", left)
+			}
+			ms.logger.Info("closing subscriber", logging.SubscriberKey, ms.name, "processed", ms.processedCount.Load())
 			ms.done <- true
 			return
 		default:
@@ -111,10 +183,31 @@ func (ms *MockSubscriber) Start(ctx context.Context) {
 	}
 }
 
+// AckTo makes the subscriber acknowledge every message it processes to acker
+func (ms *MockSubscriber) AckTo(acker Acker) {
+	ms.acker = acker
+}
+
+// SetLogger replaces the logger of the subscriber, records written for every message are sampled. It must be
+// called before Start.
+func (ms *MockSubscriber) SetLogger(logger logging.Logger) {
+	ms.logger = logger
+	ms.hotLogger = logging.Sampled(logger)
+}
+
+func (ms *MockSubscriber) processed(msg constants.Message) {
+	msg.DequeuedAt = time.Now()
+	ms.processedCount.Add(1)
+	if ms.acker != nil {
+		ms.acker.Ack(ms.name, msg)
+	}
+}
+
 // NoopSubscriber doesn't read any messages from its queues
 type NoopSubscriber struct {
 	done      chan bool
 	msgQueues QueueMap
+	heartbeat *health.Heartbeat
 }
 
 // NewNoop returns a new instance a NoopSubsciber
@@ -124,42 +217,52 @@ func NewNoop(queueSize int) Subscriber {
 	queues[constants.StartNewRound] = make(chan constants.Message, queueSize)
 	return &NoopSubscriber{
 		msgQueues: queues,
+		heartbeat: health.NewHeartbeat(),
 		done:      make(chan bool),
 	}
 }
 
 // Start begins the subscriber to listen for new messages from the message relayer
 func (ns *NoopSubscriber) Start(ctx context.Context) {
+	ns.heartbeat.Beat()
 	<-ctx.Done()
 	ns.done <- true
 }
 
 // Name returns the subscribers name
-func (ns NoopSubscriber) Name() string {
+func (ns *NoopSubscriber) Name() string {
 	return "noop subscriber"
 }
 
 // ProcessedCount returns the number of messages a subscriber processed
-func (ns NoopSubscriber) ProcessedCount() int {
+func (ns *NoopSubscriber) ProcessedCount() int {
 	return 0
 }
 
 // WaitTime returns the duration for the subscriber to wait inbetween reading messages that have been broadcasted to it
-func (ns NoopSubscriber) WaitTime() time.Duration {
+func (ns *NoopSubscriber) WaitTime() time.Duration {
 	return 0 * time.Second
 }
 
 // DoneChannel returns the subscribers done channel so the parent process can wait until it completes to exit
-func (ns NoopSubscriber) DoneChannel() chan bool {
+func (ns *NoopSubscriber) DoneChannel() chan bool {
 	return ns.done
 }
 
 // Type returns the message type the subscriber was registered with
-func (ns NoopSubscriber) Type() constants.MessageType {
+func (ns *NoopSubscriber) Type() constants.MessageType {
 	return constants.All
 }
 
+// SetLogger is a noop, the subscriber never logs
+func (ns *NoopSubscriber) SetLogger(logger logging.Logger) {}
+
+// Heartbeat returns the probe the subscriber beats once it starts
+func (ns *NoopSubscriber) Heartbeat() *health.Heartbeat {
+	return ns.heartbeat
+}
+
 // Channel returns the subscribers associated channel
-func (ns NoopSubscriber) Channel(msgType constants.MessageType) chan constants.Message {
+func (ns *NoopSubscriber) Channel(msgType constants.MessageType) chan constants.Message {
 	return ns.msgQueues.Get(msgType)
 }
@@ -0,0 +1,174 @@
+package subscriber
+
+import (
+	"context"
+	"messagerelayer/compress"
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/health"
+	"messagerelayer/logging"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// UnixReconnectBackoff is the wait time before redialing a unix socket after a failed dial or write
+var UnixReconnectBackoff = 1 * time.Second
+
+// UnixWriteTimeout bounds each write to the unix socket, a peer that stops reading loses its connection
+var UnixWriteTimeout = 5 * time.Second
+
+// UnixSubscriber writes each message it receives to a unix domain socket owned by a co-located process
+type UnixSubscriber struct {
+	name           string
+	msgType        constants.MessageType
+	path           string
+	format         framing.Format
+	compressor     *compress.Compressor
+	processedCount atomic.Int64
+	droppedCount   atomic.Int64
+	conn           net.Conn
+	writer         *framing.Writer
+	nextDial       time.Time
+	msgQueues      QueueMap
+	acker          Acker
+	heartbeat      *health.Heartbeat
+	logger         logging.Logger
+	done           chan bool
+}
+
+// NewUnix returns a subscriber that writes framed messages to the unix domain socket at path
+func NewUnix(msgType constants.MessageType, queueSize int, name string, path string, format framing.Format) Subscriber {
+	return &UnixSubscriber{
+		name:      name,
+		msgType:   msgType,
+		path:      path,
+		format:    format,
+		msgQueues: newQueueMap(msgType, queueSize),
+		heartbeat: health.NewHeartbeat(),
+		logger:    logging.Default(),
+		done:      make(chan bool),
+	}
+}
+
+// NewCompressedUnix returns a unix socket subscriber compressing messages with compressor before writing them,
+// messages below its threshold are written as is
+func NewCompressedUnix(msgType constants.MessageType, queueSize int, name string, path string, format framing.Format, compressor *compress.Compressor) Subscriber {
+	us := NewUnix(msgType, queueSize, name, path, format).(*UnixSubscriber)
+	us.compressor = compressor
+	return us
+}
+
+// Start begins forwarding messages to the unix socket, redialing it whenever the connection is lost
+func (us *UnixSubscriber) Start(ctx context.Context) {
+	us.logger.Info("subscriber starting", logging.SubscriberKey, us.name)
+	us.heartbeat.Beat()
+	for {
+		select {
+		case msg := <-us.msgQueues.Get(constants.StartNewRound):
+			us.write(msg)
+		case msg := <-us.msgQueues.Get(constants.ReceivedAnswer):
+			us.write(msg)
+		case <-ctx.Done():
+			left := drain(us.msgQueues, time.Now().Add(DrainTimeout), func(msg constants.Message) error {
+				us.write(msg)
+				return nil
+			})
+			if left > 0 {
+				us.logger.Warn("subscriber left messages unwritten after draining", logging.SubscriberKey, us.name, "count", left)
+			}
+			if us.conn != nil {
+				us.conn.Close()
+			}
+			us.logger.Info("closing subscriber", logging.SubscriberKey, us.name, "processed", us.processedCount.Load(), "dropped", us.droppedCount.Load())
+			if us.compressor != nil {
+				stats := us.compressor.Stats()
+				us.logger.Info("subscriber compression", logging.SubscriberKey, us.name, "compressed", stats.Compressed,
+					"ratio", stats.Ratio(), "duration", stats.CompressTime)
+			}
+			us.done <- true
+			return
+		}
+	}
+}
+
+// write sends the message over the current connection, dropping it when the socket is unreachable
+func (us *UnixSubscriber) write(msg constants.Message) {
+	msg.DequeuedAt = time.Now()
+	if us.conn == nil {
+		if time.Now().Before(us.nextDial) {
+			us.droppedCount.Add(1)
+			return
+		}
+		conn, err := net.Dial("unix", us.path)
+		if err != nil {
+			us.logger.Warn("subscriber unable to dial socket", logging.SubscriberKey, us.name, "path", us.path, logging.ErrorKey, err)
+			us.nextDial = time.Now().Add(UnixReconnectBackoff)
+			us.droppedCount.Add(1)
+			return
+		}
+		us.conn = conn
+		us.writer = framing.NewWriter(conn, us.format)
+		if us.compressor != nil {
+			us.writer.Compress(us.compressor)
+		}
+	}
+	us.conn.SetWriteDeadline(time.Now().Add(UnixWriteTimeout))
+	if err := us.writer.Write(msg); err != nil {
+		us.logger.Warn("subscriber lost connection to socket", logging.SubscriberKey, us.name, "path", us.path, logging.ErrorKey, err)
+		us.conn.Close()
+		us.conn = nil
+		us.nextDial = time.Now().Add(UnixReconnectBackoff)
+		us.droppedCount.Add(1)
+		return
+	}
+	us.processedCount.Add(1)
+	if us.acker != nil {
+		us.acker.Ack(us.name, msg)
+	}
+}
+
+// SetLogger replaces the logger of the subscriber, it must be called before Start
+func (us *UnixSubscriber) SetLogger(logger logging.Logger) {
+	us.logger = logger
+}
+
+// AckTo makes the subscriber acknowledge every message it writes to the socket to acker
+func (us *UnixSubscriber) AckTo(acker Acker) {
+	us.acker = acker
+}
+
+// Name returns the subscribers name
+func (us *UnixSubscriber) Name() string {
+	return us.name
+}
+
+// ProcessedCount returns the number of messages written to the unix socket
+func (us *UnixSubscriber) ProcessedCount() int {
+	return int(us.processedCount.Load())
+}
+
+// WaitTime returns the duration for the subscriber to wait inbetween reading messages that have been broadcasted to it
+func (us *UnixSubscriber) WaitTime() time.Duration {
+	return 0 * time.Second
+}
+
+// DoneChannel returns the subscribers done channel so the parent process can wait until it completes to exit
+func (us *UnixSubscriber) DoneChannel() chan bool {
+	return us.done
+}
+
+// Type returns the message type the subscriber was registered with
+func (us *UnixSubscriber) Type() constants.MessageType {
+	return us.msgType
+}
+
+// Heartbeat returns the probe the subscriber beats once it starts
+func (us *UnixSubscriber) Heartbeat() *health.Heartbeat {
+	return us.heartbeat
+}
+
+// Channel returns the subscribers associated channel
+func (us *UnixSubscriber) Channel(msgType constants.MessageType) chan constants.Message {
+	return us.msgQueues.Get(msgType)
+}
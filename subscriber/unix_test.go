@@ -0,0 +1,104 @@
+package subscriber_test
+
+import (
+	"bytes"
+	"context"
+	"messagerelayer/compress"
+	"messagerelayer/constants"
+	"messagerelayer/framing"
+	"messagerelayer/socket"
+	"messagerelayer/subscriber"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixSubscriberWritesToSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sink.sock")
+	sink, err := socket.NewUnix(path, 0600, framing.JSONL)
+	assert.Nil(t, err, "listen err is nil")
+	defer sink.Close()
+	s := subscriber.NewUnix(constants.All, 5, "unix subscriber", path, framing.JSONL)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	s.Channel(constants.StartNewRound) <- constants.Message{Type: constants.StartNewRound, Data: []byte("a")}
+	msg, err := sink.Read()
+	assert.Nil(t, err, "read err is nil")
+	assert.Equal(t, "a", string(msg.Data))
+	cancel()
+	<-s.DoneChannel()
+	assert.Equal(t, 1, s.ProcessedCount(), "processed count")
+}
+
+func TestUnixSubscriberDropsWhenUnreachable(t *testing.T) {
+	defer func(backoff time.Duration) { subscriber.UnixReconnectBackoff = backoff }(subscriber.UnixReconnectBackoff)
+	subscriber.UnixReconnectBackoff = time.Hour
+	s := subscriber.NewUnix(constants.StartNewRound, 5, "unix subscriber", filepath.Join(t.TempDir(), "missing.sock"), framing.JSONL)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	s.Channel(constants.StartNewRound) <- constants.Message{Type: constants.StartNewRound, Data: []byte("a")}
+	time.Sleep(100 * time.Millisecond) // artificial wait time to allow the message to be processed
+	cancel()
+	<-s.DoneChannel()
+	assert.Equal(t, 0, s.ProcessedCount(), "processed count")
+}
+
+func TestCompressedUnixSubscriber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sink.sock")
+	sink, err := socket.NewUnix(path, 0600, framing.LengthPrefixed)
+	assert.Nil(t, err, "listen err is nil")
+	defer sink.Close()
+	compressor := compress.New(compress.Deflate, 10)
+	s := subscriber.NewCompressedUnix(constants.All, 5, "unix subscriber", path, framing.LengthPrefixed, compressor)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	data := bytes.Repeat([]byte("a"), 100)
+	s.Channel(constants.StartNewRound) <- constants.Message{Type: constants.StartNewRound, Data: data}
+	msg, err := sink.Read()
+	assert.Nil(t, err, "read err is nil")
+	assert.Equal(t, constants.StartNewRound, msg.Type, "type survives the compression flag")
+	assert.Equal(t, "deflate", msg.Headers[compress.EncodingHeader])
+	decompressed, err := compressor.Decompress(msg)
+	assert.Nil(t, err, "decompress err is nil")
+	assert.Equal(t, data, decompressed.Data)
+	cancel()
+	<-s.DoneChannel()
+	assert.Equal(t, int64(1), compressor.Stats().Compressed)
+}
+
+func TestUnixSubscriberTimesOutOnStalledPeer(t *testing.T) {
+	defer func(timeout time.Duration, backoff time.Duration) {
+		subscriber.UnixWriteTimeout, subscriber.UnixReconnectBackoff = timeout, backoff
+	}(subscriber.UnixWriteTimeout, subscriber.UnixReconnectBackoff)
+	subscriber.UnixWriteTimeout = 100 * time.Millisecond
+	subscriber.UnixReconnectBackoff = time.Hour
+	path := filepath.Join(t.TempDir(), "stalled.sock")
+	// the peer accepts the connection but never reads from it
+	listener, err := net.Listen("unix", path)
+	assert.Nil(t, err, "listen err is nil")
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	s := subscriber.NewUnix(constants.StartNewRound, 5, "unix subscriber", path, framing.LengthPrefixed)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	for i := 0; i < 5; i++ {
+		s.Channel(constants.StartNewRound) <- constants.Message{Type: constants.StartNewRound, Data: bytes.Repeat([]byte("a"), 1<<20)}
+	}
+	time.Sleep(300 * time.Millisecond) // artificial wait time to allow the write to time out
+	cancel()
+	select {
+	case <-s.DoneChannel():
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber blocks on a peer that stopped reading")
+	}
+	assert.Equal(t, 0, s.ProcessedCount(), "processed count")
+}
@@ -0,0 +1,319 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"messagerelayer/logging"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ShutdownTimeout is how long a component may take to signal its done channel once it is stopped, unless it was
+// added with StopTimeout
+var ShutdownTimeout = 10 * time.Second
+
+// RestartBackoff is the initial wait time before restarting a crashed component
+var RestartBackoff = 1 * time.Second
+
+// MaxRestartBackoff caps the exponential backoff between restarts, a component that ran longer than it before
+// crashing starts over from RestartBackoff
+var MaxRestartBackoff = 30 * time.Second
+
+// Component is run by the supervisor, Start blocks until the context is cancelled and signals the done channel
+// before returning
+type Component interface {
+	Start(context.Context)
+	DoneChannel() chan bool
+}
+
+// ComponentFunc adapts a start function and its done channel, like a poller started with its relayer, to a Component
+func ComponentFunc(start func(context.Context), done chan bool) Component {
+	return &funcComponent{start: start, done: done}
+}
+
+type funcComponent struct {
+	start func(context.Context)
+	done  chan bool
+}
+
+func (fc *funcComponent) Start(ctx context.Context) {
+	fc.start(ctx)
+}
+
+func (fc *funcComponent) DoneChannel() chan bool {
+	return fc.done
+}
+
+// State is the lifecycle state of a supervised component
+type State string
+
+const (
+	Pending  State = "pending"   // not started yet
+	Running  State = "running"   // started, or waiting to be restarted
+	Stopped  State = "stopped"   // signalled done after being stopped
+	TimedOut State = "timed_out" // did not signal done within its shutdown timeout
+)
+
+// Status reports the state of a component, how often it was restarted and why it last crashed
+type Status struct {
+	Name      string `json:"name"`
+	State     State  `json:"state"`
+	Restarts  int    `json:"restarts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Option configures a component added to the supervisor
+type Option func(*entry)
+
+// DependsOn makes the component start after and stop before the named components
+func DependsOn(names ...string) Option {
+	return func(e *entry) {
+		e.dependsOn = append(e.dependsOn, names...)
+	}
+}
+
+// StopTimeout overrides ShutdownTimeout for the component
+func StopTimeout(timeout time.Duration) Option {
+	return func(e *entry) {
+		e.timeout = timeout
+	}
+}
+
+type entry struct {
+	name      string
+	component Component
+	dependsOn []string
+	timeout   time.Duration
+	cancel    context.CancelFunc
+	finished  chan struct{} // closed once the component is stopped for good
+	status    Status
+}
+
+// Supervisor starts components in dependency order, restarts the ones that crash and stops them in reverse order
+type Supervisor struct {
+	entries []*entry
+	mu      sync.Mutex // guards the status of every entry
+	logger  logging.Logger
+}
+
+// New returns a supervisor without any components
+func New() *Supervisor {
+	return &Supervisor{logger: logging.Default()}
+}
+
+// SetLogger replaces the logger of the supervisor, it must be called before Run
+func (s *Supervisor) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+// Add registers a component under a unique name, it must be called before Run
+func (s *Supervisor) Add(name string, component Component, opts ...Option) {
+	e := &entry{
+		name:      name,
+		component: component,
+		timeout:   ShutdownTimeout,
+		finished:  make(chan struct{}),
+		status:    Status{Name: name, State: Pending},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	s.entries = append(s.entries, e)
+}
+
+// Run starts every component, dependencies first, and blocks until ctx is cancelled. It then stops them dependents
+// first, components that do not depend on each other concurrently, giving each its shutdown timeout to signal done,
+// and returns the final status of every component in start order. It fails without starting anything when a
+// dependency is unknown or the dependencies form a cycle.
+func (s *Supervisor) Run(ctx context.Context) ([]Status, error) {
+	levels, err := s.levels()
+	if err != nil {
+		return nil, err
+	}
+	for _, level := range levels {
+		for _, e := range level {
+			componentCtx, cancel := context.WithCancel(context.Background())
+			e.cancel = cancel
+			s.setState(e, Running)
+			s.logger.Info("starting component", "component", e.name)
+			go s.run(componentCtx, e)
+		}
+	}
+	<-ctx.Done()
+	for i := len(levels) - 1; i >= 0; i-- {
+		var wg sync.WaitGroup
+		for _, e := range levels[i] {
+			wg.Add(1)
+			go func(e *entry) {
+				defer wg.Done()
+				s.stop(e)
+			}(e)
+		}
+		wg.Wait()
+	}
+	statuses := make([]Status, 0, len(s.entries))
+	for _, level := range levels {
+		for _, e := range level {
+			statuses = append(statuses, s.status(e))
+		}
+	}
+	s.report(statuses)
+	return statuses, nil
+}
+
+// Status returns the current status of every component in the order they were added
+func (s *Supervisor) Status() []Status {
+	statuses := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, s.status(e))
+	}
+	return statuses
+}
+
+// levels groups the components by how deep they sit in the dependency graph, every component comes in a later
+// level than its dependencies and in the order they were added within a level
+func (s *Supervisor) levels() ([][]*entry, error) {
+	byName := make(map[string]*entry, len(s.entries))
+	for _, e := range s.entries {
+		if _, ok := byName[e.name]; ok {
+			return nil, fmt.Errorf("component %v added twice", e.name)
+		}
+		byName[e.name] = e
+	}
+	for _, e := range s.entries {
+		for _, dep := range e.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("component %v depends on unknown component %v", e.name, dep)
+			}
+		}
+	}
+	levels := [][]*entry{}
+	placed := make(map[string]bool, len(s.entries))
+	for len(placed) < len(s.entries) {
+		level := []*entry{}
+		for _, e := range s.entries {
+			if !placed[e.name] && dependenciesPlaced(e, placed) {
+				level = append(level, e)
+			}
+		}
+		if len(level) == 0 {
+			return nil, fmt.Errorf("components have a dependency cycle")
+		}
+		for _, e := range level {
+			placed[e.name] = true
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func dependenciesPlaced(e *entry, placed map[string]bool) bool {
+	for _, dep := range e.dependsOn {
+		if !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// run starts the component and restarts it with backoff whenever it panics or signals done before being stopped
+func (s *Supervisor) run(ctx context.Context, e *entry) {
+	defer close(e.finished)
+	backoff := RestartBackoff
+	for {
+		started := time.Now()
+		crashed := s.launch(ctx, e)
+		var reason string
+		select {
+		case <-e.component.DoneChannel():
+			if ctx.Err() != nil {
+				return
+			}
+			reason = "exited before being stopped"
+		case reason = <-crashed:
+		}
+		s.crashed(e, reason)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > MaxRestartBackoff {
+			backoff = RestartBackoff
+		}
+		s.logger.Error("component crashed, restarting", "component", e.name, logging.ErrorKey, reason, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		s.restarted(e)
+		backoff *= 2
+		if backoff > MaxRestartBackoff {
+			backoff = MaxRestartBackoff
+		}
+	}
+}
+
+// launch runs the component's Start in a goroutine, the returned channel receives the panic if it panics
+func (s *Supervisor) launch(ctx context.Context, e *entry) chan string {
+	crashed := make(chan string, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Error("component panicked", "component", e.name, "panic", r, "stack", string(debug.Stack()))
+				crashed <- fmt.Sprintf("panic: %v", r)
+			}
+		}()
+		e.component.Start(ctx)
+	}()
+	return crashed
+}
+
+// stop cancels the component and waits up to its shutdown timeout for it to signal done
+func (s *Supervisor) stop(e *entry) {
+	s.logger.Info("stopping component", "component", e.name)
+	e.cancel()
+	select {
+	case <-e.finished:
+		s.setState(e, Stopped)
+	case <-time.After(e.timeout):
+		s.setState(e, TimedOut)
+		s.logger.Warn("component did not stop in time", "component", e.name, "timeout", e.timeout)
+	}
+}
+
+// report logs the final status of every component
+func (s *Supervisor) report(statuses []Status) {
+	for _, status := range statuses {
+		args := []interface{}{"component", status.Name, "state", status.State, "restarts", status.Restarts}
+		if status.State == TimedOut || status.Restarts > 0 {
+			s.logger.Warn("component final status", args...)
+			continue
+		}
+		s.logger.Info("component final status", args...)
+	}
+}
+
+func (s *Supervisor) status(e *entry) Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return e.status
+}
+
+func (s *Supervisor) setState(e *entry, state State) {
+	s.mu.Lock()
+	e.status.State = state
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) crashed(e *entry, reason string) {
+	s.mu.Lock()
+	e.status.LastError = reason
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) restarted(e *entry) {
+	s.mu.Lock()
+	e.status.Restarts++
+	s.mu.Unlock()
+}
@@ -0,0 +1,152 @@
+package supervisor_test
+
+import (
+	"context"
+	"messagerelayer/logging"
+	"messagerelayer/supervisor"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder collects the order components start and stop in
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *recorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.events...)
+}
+
+// fakeComponent records its lifecycle, panics the first `panics` times it starts and never signals done when stuck
+type fakeComponent struct {
+	name     string
+	recorder *recorder
+	panics   int
+	stuck    bool
+	starts   int
+	done     chan bool
+}
+
+func newFake(name string, r *recorder) *fakeComponent {
+	return &fakeComponent{name: name, recorder: r, done: make(chan bool)}
+}
+
+func (fc *fakeComponent) Start(ctx context.Context) {
+	fc.recorder.record("start " + fc.name)
+	fc.starts++
+	if fc.starts <= fc.panics {
+		panic("boom")
+	}
+	<-ctx.Done()
+	if fc.stuck {
+		select {}
+	}
+	fc.recorder.record("stop " + fc.name)
+	fc.done <- true
+}
+
+func (fc *fakeComponent) DoneChannel() chan bool {
+	return fc.done
+}
+
+func newSupervisor() *supervisor.Supervisor {
+	s := supervisor.New()
+	s.SetLogger(logging.Discard())
+	return s
+}
+
+// runFor runs the supervisor for the duration before cancelling it
+func runFor(s *supervisor.Supervisor, d time.Duration) ([]supervisor.Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return s.Run(ctx)
+}
+
+func TestDependencyOrder(t *testing.T) {
+	r := &recorder{}
+	s := newSupervisor()
+	s.Add("poller", newFake("poller", r), supervisor.DependsOn("relayer"))
+	s.Add("relayer", newFake("relayer", r), supervisor.DependsOn("subscriber"))
+	s.Add("subscriber", newFake("subscriber", r))
+	statuses, err := runFor(s, 100*time.Millisecond)
+	assert.Nil(t, err, "run err is nil")
+	assert.Equal(t, []string{"stop poller", "stop relayer", "stop subscriber"}, r.recorded()[3:], "dependents stop first")
+	assert.ElementsMatch(t, []string{"start poller", "start relayer", "start subscriber"}, r.recorded()[:3])
+	for i, name := range []string{"subscriber", "relayer", "poller"} {
+		assert.Equal(t, name, statuses[i].Name, "statuses are in start order")
+		assert.Equal(t, supervisor.Stopped, statuses[i].State)
+	}
+}
+
+func TestInvalidDependencies(t *testing.T) {
+	s := newSupervisor()
+	s.Add("relayer", newFake("relayer", &recorder{}), supervisor.DependsOn("missing"))
+	_, err := runFor(s, 0)
+	assert.EqualError(t, err, "component relayer depends on unknown component missing")
+
+	s = newSupervisor()
+	s.Add("a", newFake("a", &recorder{}), supervisor.DependsOn("b"))
+	s.Add("b", newFake("b", &recorder{}), supervisor.DependsOn("a"))
+	_, err = runFor(s, 0)
+	assert.EqualError(t, err, "components have a dependency cycle")
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	r := &recorder{}
+	stuck := newFake("stuck", r)
+	stuck.stuck = true
+	s := newSupervisor()
+	s.Add("stuck", stuck, supervisor.StopTimeout(50*time.Millisecond))
+	s.Add("healthy", newFake("healthy", r))
+	start := time.Now()
+	statuses, err := runFor(s, 50*time.Millisecond)
+	assert.Nil(t, err, "run err is nil")
+	assert.Less(t, time.Since(start), time.Second, "a stuck component does not hang shutdown")
+	assert.Equal(t, supervisor.TimedOut, statuses[0].State)
+	assert.Equal(t, supervisor.Stopped, statuses[1].State, "components after a stuck one are still stopped")
+}
+
+func TestRestartAfterPanic(t *testing.T) {
+	supervisor.RestartBackoff = 10 * time.Millisecond
+	defer func() { supervisor.RestartBackoff = 1 * time.Second }()
+	r := &recorder{}
+	crashing := newFake("crashing", r)
+	crashing.panics = 2
+	s := newSupervisor()
+	s.Add("crashing", crashing)
+	statuses, err := runFor(s, 200*time.Millisecond)
+	assert.Nil(t, err, "run err is nil")
+	assert.Equal(t, supervisor.Stopped, statuses[0].State)
+	assert.Equal(t, 2, statuses[0].Restarts, "restarted after each panic")
+	assert.Equal(t, "panic: boom", statuses[0].LastError)
+	assert.Equal(t, []string{"start crashing", "start crashing", "start crashing", "stop crashing"}, r.recorded())
+}
+
+func TestIndependentComponentsStopConcurrently(t *testing.T) {
+	r := &recorder{}
+	s := newSupervisor()
+	for _, name := range []string{"a", "b", "c"} {
+		stuck := newFake(name, r)
+		stuck.stuck = true
+		s.Add(name, stuck, supervisor.StopTimeout(100*time.Millisecond))
+	}
+	start := time.Now()
+	statuses, err := runFor(s, 10*time.Millisecond)
+	assert.Nil(t, err, "run err is nil")
+	assert.Less(t, time.Since(start), 250*time.Millisecond, "shutdown timeouts of independent components overlap")
+	for _, status := range statuses {
+		assert.Equal(t, supervisor.TimedOut, status.State)
+	}
+}
@@ -0,0 +1,73 @@
+package topic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Separator splits a topic into its tokens
+const Separator = "."
+
+// wildcards usable in subscription patterns
+const (
+	// SingleWildcard matches exactly one token
+	SingleWildcard = "*"
+	// MultiWildcard matches one or more trailing tokens, it must be the last token of a pattern
+	MultiWildcard = ">"
+)
+
+// Split returns the tokens of a topic or pattern
+func Split(topic string) []string {
+	return strings.Split(topic, Separator)
+}
+
+// Validate checks a topic messages are published to, it must have no empty tokens and no wildcards
+func Validate(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("empty topic")
+	}
+	for _, token := range Split(topic) {
+		if token == "" {
+			return fmt.Errorf("topic %q has an empty token", topic)
+		}
+		if token == SingleWildcard || token == MultiWildcard {
+			return fmt.Errorf("topic %q contains a wildcard", topic)
+		}
+	}
+	return nil
+}
+
+// ValidatePattern checks a subscription pattern, wildcards must be whole tokens and > may only appear last
+func ValidatePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty topic pattern")
+	}
+	tokens := Split(pattern)
+	for i, token := range tokens {
+		if token == "" {
+			return fmt.Errorf("topic pattern %q has an empty token", pattern)
+		}
+		if token == MultiWildcard && i != len(tokens)-1 {
+			return fmt.Errorf("topic pattern %q has %v before its last token", pattern, MultiWildcard)
+		}
+		if token != SingleWildcard && token != MultiWildcard && strings.ContainsAny(token, SingleWildcard+MultiWildcard) {
+			return fmt.Errorf("topic pattern %q has a wildcard inside a token", pattern)
+		}
+	}
+	return nil
+}
+
+// Match reports whether topic is matched by pattern
+func Match(pattern string, topic string) bool {
+	patternTokens := Split(pattern)
+	topicTokens := Split(topic)
+	for i, token := range patternTokens {
+		if token == MultiWildcard {
+			return len(topicTokens) > i
+		}
+		if i >= len(topicTokens) || (token != SingleWildcard && token != topicTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(topicTokens)
+}
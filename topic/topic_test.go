@@ -0,0 +1,44 @@
+package topic_test
+
+import (
+	"messagerelayer/topic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		topic    string
+		expected bool
+	}{
+		{"round.start", "round.start", true},
+		{"round.start", "round.start.eth-usd", false},
+		{"round.*", "round.start", true},
+		{"round.*", "round.start.eth-usd", false},
+		{"round.*.eth-usd", "round.answer.eth-usd", true},
+		{"round.*.eth-usd", "round.answer.btc-usd", false},
+		{"round.>", "round.answer.eth-usd.node7", true},
+		{"round.>", "round", false},
+		{"round.answer.>", "round.answer", false},
+		{">", "round", true},
+		{"*.answer.>", "round.answer.eth-usd.node7", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, topic.Match(tt.pattern, tt.topic), tt.pattern+" "+tt.topic)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, topic.Validate("round.answer.eth-usd"), "plain topic is valid")
+	for _, invalid := range []string{"", "round..answer", "round.*", "round.>", ".round"} {
+		assert.NotNil(t, topic.Validate(invalid), invalid)
+	}
+	for _, valid := range []string{"round", "round.*", "round.>", "*.answer.*", ">"} {
+		assert.Nil(t, topic.ValidatePattern(valid), valid)
+	}
+	for _, invalid := range []string{"", "round.>.eth", "round.eth*", "round..*"} {
+		assert.NotNil(t, topic.ValidatePattern(invalid), invalid)
+	}
+}
@@ -0,0 +1,249 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileExporter appends spans to a file as JSON lines
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter opens or creates the span file at path for appending
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+// Export appends span to the file
+func (fe *FileExporter) Export(span Span) error {
+	encoded, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	_, err = fe.file.Write(append(encoded, '\n'))
+	return err
+}
+
+// Close closes the span file
+func (fe *FileExporter) Close() error {
+	return fe.file.Close()
+}
+
+// ServiceName is the service.name resource attribute of exported spans
+var ServiceName = "messagerelayer"
+
+// OTLPBatchSize is how many spans the OTLP exporter buffers before sending them
+var OTLPBatchSize = 100
+
+// OTLPFlushInterval is the longest the OTLP exporter holds a span before sending it
+var OTLPFlushInterval = 5 * time.Second
+
+// OTLPQueueSize is how many full batches wait for the background sender before the exporter drops new ones
+var OTLPQueueSize = 10
+
+// OTLPExporter posts spans to an OpenTelemetry collector, or anything accepting the OTLP/HTTP JSON encoding, in
+// batches of OTLPBatchSize or every OTLPFlushInterval. Batches are sent from a background goroutine so a slow or
+// unreachable collector never blocks the code ending spans, they are dropped once OTLPQueueSize batches are waiting.
+type OTLPExporter struct {
+	endpoint string
+	client   *http.Client
+	mu       sync.Mutex
+	pending  []Span
+	batches  chan []Span // full batches waiting to be sent
+	dropped  atomic.Int64
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+// NewOTLPExporter returns an exporter posting to endpoint, usually http://<collector>:4318/v1/traces
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	oe := &OTLPExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		batches:  make(chan []Span, OTLPQueueSize),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go oe.flushPeriodically()
+	return oe
+}
+
+// Export buffers span, handing the batch to the background sender once it is full. It fails without blocking when
+// the sender is too far behind, dropping the batch.
+func (oe *OTLPExporter) Export(span Span) error {
+	oe.mu.Lock()
+	oe.pending = append(oe.pending, span)
+	var batch []Span
+	if len(oe.pending) >= OTLPBatchSize {
+		batch = oe.pending
+		oe.pending = nil
+	}
+	oe.mu.Unlock()
+	if batch == nil {
+		return nil
+	}
+	select {
+	case oe.batches <- batch:
+		return nil
+	default:
+		oe.dropped.Add(int64(len(batch)))
+		return fmt.Errorf("otlp export queue is full, dropped %d spans", len(batch))
+	}
+}
+
+// Dropped returns how many spans were dropped because the export queue was full or the collector failed
+func (oe *OTLPExporter) Dropped() int {
+	return int(oe.dropped.Load())
+}
+
+// Flush sends the buffered spans that don't fill a batch yet
+func (oe *OTLPExporter) Flush() error {
+	oe.mu.Lock()
+	spans := oe.pending
+	oe.pending = nil
+	oe.mu.Unlock()
+	return oe.send(spans)
+}
+
+func (oe *OTLPExporter) send(spans []Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := oe.client.Post(oe.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with %v", resp.Status)
+	}
+	return nil
+}
+
+// Close stops the background sender once the queued batches are sent and sends the remaining spans
+func (oe *OTLPExporter) Close() error {
+	close(oe.closing)
+	<-oe.done
+	return oe.Flush()
+}
+
+// flushPeriodically sends full batches as they are queued and the partial one every OTLPFlushInterval
+func (oe *OTLPExporter) flushPeriodically() {
+	ticker := time.NewTicker(OTLPFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case batch := <-oe.batches:
+			oe.sendBackground(batch)
+		case <-ticker.C:
+			oe.mu.Lock()
+			spans := oe.pending
+			oe.pending = nil
+			oe.mu.Unlock()
+			oe.sendBackground(spans)
+		case <-oe.closing:
+			for {
+				select {
+				case batch := <-oe.batches:
+					oe.sendBackground(batch)
+				default:
+					close(oe.done)
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendBackground sends spans, counting them as dropped when the collector can't be reached
+func (oe *OTLPExporter) sendBackground(spans []Span) {
+	if err := oe.send(spans); err != nil {
+		oe.dropped.Add(int64(len(spans)))
+	}
+}
+
+// the subset of the OTLP ExportTraceServiceRequest JSON encoding the exporter writes
+type (
+	otlpAttribute struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpResourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+)
+
+// otlpInternalKind is SPAN_KIND_INTERNAL
+const otlpInternalKind = 1
+
+func attribute(key string, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+func otlpRequest(spans []Span) otlpTraces {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = ServiceName
+	for _, span := range spans {
+		converted := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              otlpInternalKind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		for key, value := range span.Attributes {
+			converted.Attributes = append(converted.Attributes, attribute(key, value))
+		}
+		scope.Spans = append(scope.Spans, converted)
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttribute{attribute("service.name", ServiceName)}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{resource}}
+}
@@ -0,0 +1,186 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"messagerelayer/constants"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the message header carrying the W3C trace context of a message
+const TraceparentHeader = "traceparent"
+
+// SampledFlag is the trace flag marking a trace as recorded
+const SampledFlag byte = 0x01
+
+// SpanContext identifies a span and the trace it belongs to
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// Valid reports whether the trace and span IDs are set, the W3C spec forbids all zero IDs
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Sampled reports whether spans of the trace should be recorded
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&SampledFlag != 0
+}
+
+// String returns the context as a version 00 traceparent header value
+func (sc SpanContext) String() string {
+	return fmt.Sprintf("00-%x-%x-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// Parse decodes a traceparent header value, 00-<32 hex trace id>-<16 hex span id>-<2 hex flags>. Values of later
+// versions are accepted as long as they start with the version 00 fields.
+func Parse(traceparent string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", traceparent)
+	}
+	var sc SpanContext
+	var flags [1]byte
+	for _, field := range []struct {
+		hex string
+		dst []byte
+	}{{parts[1], sc.TraceID[:]}, {parts[2], sc.SpanID[:]}, {parts[3], flags[:]}} {
+		if len(field.hex) != 2*len(field.dst) || strings.ToLower(field.hex) != field.hex {
+			return SpanContext{}, fmt.Errorf("malformed traceparent %q", traceparent)
+		}
+		if _, err := hex.Decode(field.dst, []byte(field.hex)); err != nil {
+			return SpanContext{}, fmt.Errorf("malformed traceparent %q", traceparent)
+		}
+	}
+	sc.Flags = flags[0]
+	if !sc.Valid() {
+		return SpanContext{}, fmt.Errorf("traceparent %q has a zero id", traceparent)
+	}
+	return sc, nil
+}
+
+// Extract returns the span context carried by msg, ok is false when it has none or it is malformed
+func Extract(msg constants.Message) (sc SpanContext, ok bool) {
+	value, ok := msg.Headers[TraceparentHeader]
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc, err := Parse(value)
+	return sc, err == nil
+}
+
+// Inject returns msg carrying sc in its TraceparentHeader. The header map may be shared with other copies of the
+// message so it is copied before writing.
+func Inject(msg constants.Message, sc SpanContext) constants.Message {
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[TraceparentHeader] = sc.String()
+	msg.Headers = headers
+	return msg
+}
+
+// Span is a finished unit of work of a trace
+type Span struct {
+	Name       string            `json:"name"`
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_span_id,omitempty"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Exporter sends finished spans to a backend
+type Exporter interface {
+	Export(Span) error
+	Close() error
+}
+
+// Tracer starts spans and hands the sampled ones to an exporter once they end
+type Tracer struct {
+	exporter Exporter
+	mu       sync.Mutex
+	errors   int
+}
+
+// NewTracer returns a tracer exporting to exporter
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// ActiveSpan is a span that has started and not ended yet
+type ActiveSpan struct {
+	tracer     *Tracer
+	name       string
+	context    SpanContext
+	parent     SpanContext
+	start      time.Time
+	attributes map[string]string
+}
+
+// Start begins a span named name at start. The span is a child of parent when it is valid, otherwise it starts a
+// new sampled trace.
+func (t *Tracer) Start(name string, parent SpanContext, start time.Time) *ActiveSpan {
+	sc := SpanContext{Flags: SampledFlag}
+	if parent.Valid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	return &ActiveSpan{tracer: t, name: name, context: sc, parent: parent, start: start, attributes: map[string]string{}}
+}
+
+// Context returns the span's context, to be injected into the messages it hands on
+func (s *ActiveSpan) Context() SpanContext {
+	return s.context
+}
+
+// SetAttribute records a key value pair on the span
+func (s *ActiveSpan) SetAttribute(key string, value string) {
+	s.attributes[key] = value
+}
+
+// End finishes the span now and exports it when its trace is sampled
+func (s *ActiveSpan) End() {
+	if !s.context.Sampled() {
+		return
+	}
+	span := Span{
+		Name:       s.name,
+		TraceID:    hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:     hex.EncodeToString(s.context.SpanID[:]),
+		Start:      s.start,
+		End:        time.Now(),
+		Attributes: s.attributes,
+	}
+	if s.parent.Valid() {
+		span.ParentID = hex.EncodeToString(s.parent.SpanID[:])
+	}
+	if err := s.tracer.exporter.Export(span); err != nil {
+		s.tracer.mu.Lock()
+		s.tracer.errors++
+		s.tracer.mu.Unlock()
+	}
+}
+
+// ExportErrors returns how many spans the exporter failed to export
+func (t *Tracer) ExportErrors() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.errors
+}
+
+// Close closes the exporter, flushing spans it buffers
+func (t *Tracer) Close() error {
+	return t.exporter.Close()
+}
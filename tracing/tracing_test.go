@@ -0,0 +1,153 @@
+package tracing_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"messagerelayer/constants"
+	"messagerelayer/tracing"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParse(t *testing.T) {
+	sc, err := tracing.Parse(traceparent)
+	assert.Nil(t, err, "parse err is nil")
+	assert.True(t, sc.Sampled(), "sampled flag")
+	assert.Equal(t, traceparent, sc.String(), "round trips")
+	_, err = tracing.Parse("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future")
+	assert.Nil(t, err, "later versions may add fields")
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		_, err := tracing.Parse(value)
+		assert.NotNil(t, err, "invalid traceparent %q", value)
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	headers := map[string]string{"source": "test"}
+	msg := constants.Message{Headers: headers}
+	_, ok := tracing.Extract(msg)
+	assert.False(t, ok, "no context")
+	sc, _ := tracing.Parse(traceparent)
+	injected := tracing.Inject(msg, sc)
+	extracted, ok := tracing.Extract(injected)
+	assert.True(t, ok, "context extracted")
+	assert.Equal(t, sc, extracted, "same context")
+	assert.Equal(t, "test", injected.Headers["source"], "other headers kept")
+	assert.NotContains(t, headers, tracing.TraceparentHeader, "original headers untouched")
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := tracing.NewFileExporter(path)
+	assert.Nil(t, err, "open err is nil")
+	tracer := tracing.NewTracer(exporter)
+	parent, _ := tracing.Parse(traceparent)
+	root := tracer.Start("root", tracing.SpanContext{}, time.Now())
+	child := tracer.Start("child", parent, time.Now())
+	child.SetAttribute("key", "value")
+	child.End()
+	root.End()
+	tracer.Start("unsampled", tracing.SpanContext{TraceID: parent.TraceID, SpanID: parent.SpanID}, time.Now()).End()
+	assert.Nil(t, tracer.Close(), "close err is nil")
+
+	file, err := os.Open(path)
+	assert.Nil(t, err, "open err is nil")
+	defer file.Close()
+	spans := []tracing.Span{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var span tracing.Span
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &span), "span decodes")
+		spans = append(spans, span)
+	}
+	assert.Equal(t, 2, len(spans), "sampled spans exported")
+	assert.Equal(t, "child", spans[0].Name, "child first")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID, "child continues the trace")
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentID, "child parent")
+	assert.Equal(t, "value", spans[0].Attributes["key"], "attribute")
+	assert.Equal(t, "", spans[1].ParentID, "root has no parent")
+	assert.NotEqual(t, spans[0].TraceID, spans[1].TraceID, "root starts a new trace")
+}
+
+func TestOTLPExporter(t *testing.T) {
+	bodies := make(chan []byte, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer collector.Close()
+	tracing.OTLPBatchSize = 2
+	defer func() { tracing.OTLPBatchSize = 100 }()
+	exporter := tracing.NewOTLPExporter(collector.URL + "/v1/traces")
+	tracer := tracing.NewTracer(exporter)
+	parent, _ := tracing.Parse(traceparent)
+	for _, name := range []string{"first", "second", "third"} {
+		tracer.Start(name, parent, time.Now()).End()
+	}
+	assert.Eventually(t, func() bool { return len(bodies) == 1 }, time.Second, 10*time.Millisecond, "full batch sent")
+	assert.Nil(t, tracer.Close(), "close err is nil")
+	assert.Equal(t, 2, len(bodies), "remaining spans flushed on close")
+	assert.Equal(t, 0, tracer.ExportErrors(), "no export errors")
+
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	assert.Nil(t, json.Unmarshal(<-bodies, &request), "request decodes")
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Equal(t, 2, len(spans), "batch size")
+	assert.Equal(t, "first", spans[0].Name, "span name")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID, "trace id")
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanID, "parent span id")
+}
+
+func TestOTLPExporterNeverBlocks(t *testing.T) {
+	release := make(chan struct{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer collector.Close()
+	tracing.OTLPBatchSize = 1
+	tracing.OTLPQueueSize = 1
+	defer func() {
+		tracing.OTLPBatchSize = 100
+		tracing.OTLPQueueSize = 10
+	}()
+	exporter := tracing.NewOTLPExporter(collector.URL + "/v1/traces")
+	tracer := tracing.NewTracer(exporter)
+	parent, _ := tracing.Parse(traceparent)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		tracer.Start("span", parent, time.Now()).End()
+	}
+	assert.Less(t, time.Since(start), time.Second, "a stalled collector does not block ending spans")
+	assert.Greater(t, exporter.Dropped(), 0, "spans past the queue are dropped")
+	assert.Equal(t, exporter.Dropped(), tracer.ExportErrors(), "drops are export errors")
+	close(release)
+	assert.Nil(t, tracer.Close(), "close err is nil")
+}